@@ -1,14 +1,107 @@
 package config
 
 import (
+	"AiDemo/models"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 var APIKey string
 
+// 大模型服务配置
+var (
+	LLMProvider string // 服务提供方：doubao / openai / ollama
+	LLMBaseURL  string // 服务地址，为空时使用提供方默认地址
+	LLMModel    string // 模型 ID（豆包为推理接入点 ID）
+)
+
+// 向量化服务配置
+var (
+	EmbeddingProvider string // 向量化提供方：local（本地 n-gram，默认）/ openai（OpenAI 兼容 /embeddings 接口）
+	EmbeddingBaseURL  string // 向量化服务地址，为空时使用提供方默认地址
+	EmbeddingModel    string // 向量化模型 ID
+	EmbeddingAPIKey   string // 向量化服务密钥，为空时沿用大模型密钥
+	EmbeddingDim      int    // 向量维度，0 表示使用提供方默认值
+)
+
+// 文档切分与入库配置
+var (
+	ChunkStrategy      string // 默认切分策略：recursive（默认，按标题/段落/句子递归切分）/ fixed
+	ChunkSize          int    // 每个片段的 token 上限
+	ChunkOverlap       int    // 相邻片段重叠的 token 数
+	UploadMaxMB        int    // 上传文件的单个大小上限（MB）
+	UploadMaxRequestMB int    // 单次上传请求体（全部文件与表单字段）及携带幂等键的入库请求体的大小上限（MB），读取请求体前生效
+	IngestWorkers      int    // 异步入库任务的 worker 数
+	ImportMaxLineMB    int    // JSONL 导入时单行记录的大小上限（MB），超过的行记为失败并跳过
+
+	IdempotencyTTL time.Duration // Idempotency-Key 的保留时长，过期后相同的键视为新请求
+)
+
+// 向量索引配置
+var (
+	VectorIndex        string // 向量索引类型：hnsw（默认，内存近似最近邻索引）/ flat（SQLite 精确检索）
+	VectorIndexPath    string // HNSW 索引持久化文件
+	HNSWM              int    // 每个节点的邻居数
+	HNSWEfConstruction int    // 建图候选集大小
+	HNSWEfSearch       int    // 查询候选集大小
+)
+
+// 检索配置
+var (
+	RetrievalMode    string  // 默认检索模式：vector（默认）/ keyword / hybrid
+	Reranker         string  // 默认重排器：none（默认）/ lexical / llm
+	RerankOverfetch  int     // 重排时召回 topK 的倍数
+	RerankMaxContent int     // 大模型重排时每个候选发送的最大字符数
+	MMRLambda        float64 // MMR 相关性权重，越小结果越多样，>= 1 时不做多样化
+	MaxChunksPerDoc  int     // 同一文档最多返回的片段数，0 表示不限制
+
+	QueryStrategy   string // 默认查询扩展策略：none（默认）/ multi_query / hyde
+	MultiQueryCount int    // multi_query 生成的改写问题数
+
+	RAGMinScore      float64 // 命中片段的默认最低向量相似度（0-1），可按命名空间覆盖
+	RAGMinHits       int     // 达到最低得分的片段少于该数量时触发兜底策略
+	RAGFallback      string  // 默认兜底策略：general_answer（默认）/ refuse / ask_clarifying_question
+	RAGRefuseMessage string  // refuse 策略的默认话术
+
+	RAGHistoryMessages int // 会话式 RAG 用于改写追问的最近消息条数，0 表示不改写、不带历史（提示词中的历史按上下文预算构建）
+)
+
+// 超时配置，0 表示不限制
+var (
+	LLMCallTimeout   time.Duration // 单次非流式上游调用的截止时间
+	LLMStreamTimeout time.Duration // 单次流式上游调用的截止时间
+	RequestTimeout   time.Duration // 单个 HTTP 请求的全局截止时间
+)
+
+// 重试与熔断配置
+var (
+	LLMMaxRetries       int           // 429/5xx 时的最大重试次数
+	LLMRetryBaseDelay   time.Duration // 指数退避基准时长
+	LLMRetryMaxDelay    time.Duration // 单次退避上限
+	LLMBreakerThreshold int           // 连续失败多少次后熔断，0 表示不启用
+	LLMBreakerCooldown  time.Duration // 熔断后的冷却时长
+)
+
+// 上下文窗口配置
+var (
+	ContextTokenBudget   int  // 发送给模型的历史消息 token 预算（含系统提示词与摘要）
+	ContextMinRecent     int  // 至少保留的最近消息条数（在预算允许时）
+	ContextSummaryTokens int  // 摘要的 token 上限
+	ContextSummarize     bool // 超出预算时是否摘要早期对话，否则直接丢弃
+)
+
+// 费用估算配置
+var (
+	PriceTable    map[string]models.ModelPrice // 模型 ID -> 每 1000 token 单价
+	PriceCurrency string                       // 计价币种
+)
+
 func LoadEnv() error {
 	// 尝试加载init/initApi.env文件
 	err := godotenv.Load("init/initApi.env")
@@ -16,10 +109,186 @@ func LoadEnv() error {
 		return fmt.Errorf("加载.env文件失败: %w", err)
 	}
 
-	APIKey = os.Getenv("DOUBAO_API_KEY")
-	if APIKey == "" {
-		return fmt.Errorf("请在.env文件中设置 DOUBAO_API_KEY")
+	LLMProvider = strings.ToLower(getEnv("LLM_PROVIDER", "doubao"))
+	LLMBaseURL = os.Getenv("LLM_BASE_URL")
+	LLMModel = getEnv("LLM_MODEL", "ep-20250811150312-h4mvh")
+
+	EmbeddingProvider = strings.ToLower(getEnv("EMBEDDING_PROVIDER", "local"))
+	EmbeddingBaseURL = os.Getenv("EMBEDDING_BASE_URL")
+	EmbeddingModel = getEnv("EMBEDDING_MODEL", "text-embedding-3-small")
+	if EmbeddingDim, err = getIntEnv("EMBEDDING_DIM", 0); err != nil {
+		return err
+	}
+
+	ChunkStrategy = strings.ToLower(getEnv("CHUNK_STRATEGY", "recursive"))
+	if ChunkSize, err = getIntEnv("CHUNK_SIZE", 300); err != nil {
+		return err
+	}
+	if ChunkOverlap, err = getIntEnv("CHUNK_OVERLAP", 50); err != nil {
+		return err
+	}
+	if UploadMaxMB, err = getIntEnv("UPLOAD_MAX_MB", 20); err != nil {
+		return err
+	}
+	if UploadMaxRequestMB, err = getIntEnv("UPLOAD_MAX_REQUEST_MB", 100); err != nil {
+		return err
+	}
+	if IngestWorkers, err = getIntEnv("INGEST_WORKERS", 2); err != nil {
+		return err
+	}
+	if ImportMaxLineMB, err = getIntEnv("IMPORT_MAX_LINE_MB", 16); err != nil {
+		return err
+	}
+	if IdempotencyTTL, err = getDurationEnv("IDEMPOTENCY_TTL", 24*time.Hour); err != nil {
+		return err
 	}
 
+	RetrievalMode = strings.ToLower(getEnv("RETRIEVAL_MODE", "vector"))
+	Reranker = strings.ToLower(getEnv("RERANKER", "none"))
+	if RerankOverfetch, err = getIntEnv("RERANK_OVERFETCH", 5); err != nil {
+		return err
+	}
+	if RerankMaxContent, err = getIntEnv("RERANK_MAX_CONTENT", 400); err != nil {
+		return err
+	}
+	if MMRLambda, err = getFloatEnv("MMR_LAMBDA", 1); err != nil {
+		return err
+	}
+	if MaxChunksPerDoc, err = getIntEnv("MAX_CHUNKS_PER_DOC", 0); err != nil {
+		return err
+	}
+	QueryStrategy = strings.ToLower(getEnv("QUERY_STRATEGY", "none"))
+	if MultiQueryCount, err = getIntEnv("MULTI_QUERY_COUNT", 3); err != nil {
+		return err
+	}
+	if RAGMinScore, err = getFloatEnv("RAG_MIN_SCORE", 0); err != nil {
+		return err
+	}
+	if RAGMinScore < 0 || RAGMinScore > 1 || (RAGMinScore > 0 && RetrievalMode == "keyword") {
+		return fmt.Errorf("环境变量 RAG_MIN_SCORE 取值错误: %g（向量余弦相似度，取值范围为 0-1，RETRIEVAL_MODE=keyword 时只能为 0）", RAGMinScore)
+	}
+	if RAGMinHits, err = getIntEnv("RAG_MIN_HITS", 1); err != nil {
+		return err
+	}
+	RAGFallback = strings.ToLower(getEnv("RAG_FALLBACK", models.FallbackGeneralAnswer))
+	switch RAGFallback {
+	case models.FallbackGeneralAnswer, models.FallbackRefuse, models.FallbackAskClarifying:
+	default:
+		return fmt.Errorf("环境变量 RAG_FALLBACK 取值错误: %s", RAGFallback)
+	}
+	RAGRefuseMessage = getEnv("RAG_REFUSE_MESSAGE", "抱歉，知识库中没有找到与您的问题相关的内容，暂时无法回答。")
+	if RAGHistoryMessages, err = getIntEnv("RAG_HISTORY_MESSAGES", 6); err != nil {
+		return err
+	}
+	VectorIndex = strings.ToLower(getEnv("VECTOR_INDEX", "hnsw"))
+	VectorIndexPath = getEnv("VECTOR_INDEX_PATH", "data/hnsw.index")
+	if HNSWM, err = getIntEnv("HNSW_M", 16); err != nil {
+		return err
+	}
+	if HNSWEfConstruction, err = getIntEnv("HNSW_EF_CONSTRUCTION", 100); err != nil {
+		return err
+	}
+	if HNSWEfSearch, err = getIntEnv("HNSW_EF_SEARCH", 64); err != nil {
+		return err
+	}
+
+	if LLMCallTimeout, err = getDurationEnv("LLM_CALL_TIMEOUT", 60*time.Second); err != nil {
+		return err
+	}
+	if LLMStreamTimeout, err = getDurationEnv("LLM_STREAM_TIMEOUT", 3*time.Minute); err != nil {
+		return err
+	}
+	if RequestTimeout, err = getDurationEnv("REQUEST_TIMEOUT", 5*time.Minute); err != nil {
+		return err
+	}
+
+	if LLMMaxRetries, err = getIntEnv("LLM_MAX_RETRIES", 2); err != nil {
+		return err
+	}
+	if LLMRetryBaseDelay, err = getDurationEnv("LLM_RETRY_BASE_DELAY", 500*time.Millisecond); err != nil {
+		return err
+	}
+	if LLMRetryMaxDelay, err = getDurationEnv("LLM_RETRY_MAX_DELAY", 8*time.Second); err != nil {
+		return err
+	}
+	if LLMBreakerThreshold, err = getIntEnv("LLM_BREAKER_THRESHOLD", 5); err != nil {
+		return err
+	}
+	if LLMBreakerCooldown, err = getDurationEnv("LLM_BREAKER_COOLDOWN", 30*time.Second); err != nil {
+		return err
+	}
+
+	if ContextTokenBudget, err = getIntEnv("CONTEXT_TOKEN_BUDGET", 6000); err != nil {
+		return err
+	}
+	if ContextMinRecent, err = getIntEnv("CONTEXT_MIN_RECENT", 4); err != nil {
+		return err
+	}
+	if ContextSummaryTokens, err = getIntEnv("CONTEXT_SUMMARY_TOKENS", 500); err != nil {
+		return err
+	}
+	ContextSummarize = getEnv("CONTEXT_SUMMARIZE", "true") == "true"
+
+	PriceCurrency = getEnv("LLM_PRICE_CURRENCY", "CNY")
+	PriceTable = map[string]models.ModelPrice{}
+	if v := os.Getenv("LLM_PRICE_TABLE"); v != "" {
+		if err := json.Unmarshal([]byte(v), &PriceTable); err != nil {
+			return fmt.Errorf("环境变量 LLM_PRICE_TABLE 格式错误: %w", err)
+		}
+	}
+
+	APIKey = getEnv("LLM_API_KEY", os.Getenv("DOUBAO_API_KEY"))
+	if APIKey == "" && LLMProvider != "ollama" {
+		return fmt.Errorf("请在.env文件中设置 DOUBAO_API_KEY 或 LLM_API_KEY")
+	}
+	EmbeddingAPIKey = getEnv("EMBEDDING_API_KEY", APIKey)
+
 	return nil
 }
+
+// getEnv 读取环境变量，未设置时返回默认值
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// getDurationEnv 读取时长类环境变量（如 30s、2m），未设置时返回默认值
+func getDurationEnv(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("环境变量 %s 格式错误: %w", key, err)
+	}
+	return d, nil
+}
+
+// getIntEnv 读取整数类环境变量，未设置时返回默认值
+func getIntEnv(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("环境变量 %s 格式错误: %w", key, err)
+	}
+	return n, nil
+}
+
+// getFloatEnv 读取浮点数类环境变量，未设置时返回默认值
+func getFloatEnv(key string, fallback float64) (float64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("环境变量 %s 格式错误: %w", key, err)
+	}
+	return f, nil
+}
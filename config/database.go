@@ -22,8 +22,8 @@ func InitDatabase() error {
 	}
 
 	dbPath := filepath.Join(dataDir, "chat.db")
-	// 使用 pure-go sqlite 驱动，不依赖 cgo
-	dsn := dbPath + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)"
+	// 使用 pure-go sqlite 驱动，不依赖 cgo；入库 worker 与请求并发写入时等待锁释放而不是直接报错
+	dsn := dbPath + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
 
 	var err error
 	DB, err = gorm.Open(sqlite.Open(dsn), &gorm.Config{
@@ -33,11 +33,19 @@ func InitDatabase() error {
 		return err
 	}
 
-	// 自动迁移数据库表（会话、消息、知识库）
+	// 自动迁移数据库表（会话、消息、知识文档、知识库、用量、向量重建任务、入库任务、幂等键、命名空间配置、提示词模板与实验）
 	if err := DB.AutoMigrate(
 		&models.Session{},
 		&models.ChatMessage{},
+		&models.Document{},
 		&models.Knowledge{},
+		&models.UsageRecord{},
+		&models.ReembedJob{},
+		&models.IngestJob{},
+		&models.IdempotencyRecord{},
+		&models.NamespaceSetting{},
+		&models.PromptTemplate{},
+		&models.PromptExperiment{},
 	); err != nil {
 		return err
 	}
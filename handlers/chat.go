@@ -3,6 +3,7 @@ package handlers
 import (
 	"AiDemo/models"
 	"AiDemo/services"
+	"AiDemo/utils"
 	"net/http"
 	"time"
 
@@ -18,20 +19,14 @@ func ChatHandler(c *gin.Context) {
 		return
 	}
 
-	// 如果没有会话ID，创建新会话
+	// 没有会话ID时创建新会话，客户端指定的会话不存在时以该 ID 创建
 	sessionService := services.NewSessionService()
-	var sessionID string
-	if requestBody.SessionID == "" {
-		// 创建新会话
-		session, err := sessionService.CreateSession("新对话 " + time.Now().Format("01-02 15:04"))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建会话失败"})
-			return
-		}
-		sessionID = session.ID
-	} else {
-		sessionID = requestBody.SessionID
+	session, err := sessionService.GetOrCreateSession(requestBody.SessionID, newSessionName())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建会话失败"})
+		return
 	}
+	sessionID := session.ID
 
 	// 保存用户消息到数据库
 	if err := sessionService.AddMessage(sessionID, "user", requestBody.Message); err != nil {
@@ -42,38 +37,83 @@ func ChatHandler(c *gin.Context) {
 	// 获取系统提示词
 	systemPrompt := services.GetSystemPrompt(requestBody.Role)
 
-	// 获取会话历史
-	history := sessionService.GetHistory(sessionID)
-	if len(history) == 0 {
-		// 如果没有历史，添加系统提示词
-		history = []models.Message{{Role: "system", Content: systemPrompt}}
+	// 按 token 预算构建上下文（系统提示词 + 摘要 + 最近对话，已包含本次用户消息）
+	messages, err := services.NewHistoryBuilder().Build(c.Request.Context(), sessionID, systemPrompt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "构建对话上下文失败: " + err.Error()})
+		return
+	}
+
+	// 用量统计按角色汇总
+	role := requestBody.Role
+	if role == "" {
+		role = "general"
 	}
 
-	// 构建请求体
-	requestData := models.RequestBody{
-		Model: "ep-20250811150312-h4mvh", // 使用您的豆包模型ID
-		Messages: append(history, models.Message{
-			Role:    "user",
-			Content: requestBody.Message,
-		}),
+	// 流式模式：边生成边推送，结束后再落库
+	if requestBody.Stream {
+		streamChat(c, sessionService, sessionID, role, messages)
+		return
 	}
 
-	// 调用豆包API
-	response, err := services.CallDoubao(requestData.Messages)
+	// 调用大模型服务
+	result, err := services.GetChatProvider().Chat(c.Request.Context(), messages)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "调用AI服务失败: " + err.Error()})
+		respondLLMError(c, err)
 		return
 	}
 
 	// 保存AI回复到数据库
-	if err := sessionService.AddMessage(sessionID, "assistant", response); err != nil {
+	if err := sessionService.AddAssistantMessage(sessionID, result, false); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存AI回复失败"})
 		return
 	}
+	cost := services.RecordUsage(sessionID, "chat", role, result)
 
 	// 返回响应
-	c.JSON(http.StatusOK, gin.H{
-		"reply":      response,
-		"session_id": sessionID,
+	c.JSON(http.StatusOK, models.ChatResponse{
+		Reply:     result.Content,
+		SessionID: sessionID,
+		Model:     result.Model,
+		Usage:     &result.Usage,
+		Cost:      cost,
+	})
+}
+
+// newSessionName 自动创建的会话的默认名称
+func newSessionName() string {
+	return "新对话 " + time.Now().Format("01-02 15:04")
+}
+
+// streamChat 以 SSE 返回回复；客户端中途断开或上游出错时，已生成的部分回复标记为不完整后保存
+func streamChat(c *gin.Context, sessionService *services.SessionService, sessionID, role string, messages []models.Message) {
+	result, disconnected, err := streamReply(c, messages, "")
+	if err != nil {
+		if result.Content != "" {
+			if saveErr := sessionService.AddAssistantMessage(sessionID, result, true); saveErr != nil {
+				utils.Error("保存不完整的AI回复失败: %v", saveErr)
+			}
+			services.RecordUsage(sessionID, "chat", role, result)
+		}
+		if disconnected {
+			utils.Warning("客户端已断开，已保存部分回复: session=%s, 长度=%d", sessionID, len(result.Content))
+			return
+		}
+		sendSSE(c, "error", gin.H{"error": "调用AI服务失败: " + err.Error(), "status": llmErrorStatus(err), "session_id": sessionID})
+		return
+	}
+
+	if err := sessionService.AddAssistantMessage(sessionID, result, false); err != nil {
+		sendSSE(c, "error", gin.H{"error": "保存AI回复失败", "session_id": sessionID})
+		return
+	}
+	cost := services.RecordUsage(sessionID, "chat", role, result)
+
+	sendSSE(c, "done", models.ChatResponse{
+		Reply:     result.Content,
+		SessionID: sessionID,
+		Model:     result.Model,
+		Usage:     &result.Usage,
+		Cost:      cost,
 	})
 }
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"AiDemo/models"
+	"AiDemo/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DocumentHandler 知识文档处理器
+type DocumentHandler struct {
+	documentService *services.DocumentService
+	ingestService   *services.IngestService
+}
+
+// NewDocumentHandler 创建新的知识文档处理器
+func NewDocumentHandler() *DocumentHandler {
+	return &DocumentHandler{
+		documentService: services.NewDocumentService(),
+		ingestService:   services.NewIngestService(),
+	}
+}
+
+// ListDocuments 分页获取文档列表，支持按命名空间、来源过滤与全文检索
+func (h *DocumentHandler) ListDocuments(c *gin.Context) {
+	var q models.DocumentListQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	resp, err := h.documentService.List(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取文档列表失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetDocument 获取文档及其全部片段，:id 为片段 ID（检索与引用结果中的 id）时返回其所属文档
+func (h *DocumentHandler) GetDocument(c *gin.Context) {
+	id, err := h.documentService.ResolveID(c.Param("id"))
+	var doc *models.DocumentWithChunks
+	if err == nil {
+		doc, err = h.documentService.Get(id)
+	}
+	if err != nil {
+		c.JSON(documentErrorStatus(err), gin.H{
+			"error": "获取文档失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, doc)
+}
+
+// ReplaceDocument 提交整体替换文档的异步任务（请求体同知识入库接口），返回 202 与任务；
+// 替换内容与同一命名空间下的其他文档相同时不替换，与新建时一样返回 200 与已完成的重复任务
+func (h *DocumentHandler) ReplaceDocument(c *gin.Context) {
+	var req CreateKnowledgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	job, err := h.ingestService.SubmitReplace(c.Param("id"), req.knowledgeInput())
+	if err != nil {
+		c.JSON(documentErrorStatus(err), gin.H{
+			"error": "替换文档失败: " + err.Error(),
+		})
+		return
+	}
+
+	if job.Duplicate {
+		c.JSON(http.StatusOK, job)
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// DeleteDocument 删除文档及其全部片段
+func (h *DocumentHandler) DeleteDocument(c *gin.Context) {
+	id := c.Param("id")
+	deleted, err := h.documentService.Delete(id)
+	if err != nil {
+		c.JSON(documentErrorStatus(err), gin.H{
+			"error": "删除文档失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.DeleteDocumentResponse{
+		ID:            id,
+		DeletedChunks: deleted,
+		Message:       "文档删除成功",
+	})
+}
+
+// documentErrorStatus 文档接口错误对应的 HTTP 状态码
+func documentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrDocumentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidChunkOptions), errors.Is(err, services.ErrEmptyContent):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrUnsupportedFileType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, services.ErrFileTooLarge):
+		return http.StatusRequestEntityTooLarge
+	default:
+		return llmErrorStatus(err)
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"AiDemo/services"
+	"AiDemo/utils"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StatusClientClosedRequest 客户端在响应前断开（沿用 Nginx 的 499 约定）
+const StatusClientClosedRequest = 499
+
+// llmErrorStatus 将大模型调用错误映射为 HTTP 状态码
+func llmErrorStatus(err error) int {
+	var timeoutErr *services.TimeoutError
+	var canceledErr *services.CanceledError
+	var circuitErr *services.CircuitOpenError
+	var upErr *services.UpstreamError
+	switch {
+	case errors.As(err, &timeoutErr):
+		return http.StatusGatewayTimeout
+	case errors.As(err, &canceledErr):
+		return StatusClientClosedRequest
+	case errors.As(err, &circuitErr):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &upErr):
+		if upErr.StatusCode == http.StatusTooManyRequests {
+			return http.StatusTooManyRequests
+		}
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// respondLLMError 以统一格式返回大模型调用错误
+func respondLLMError(c *gin.Context, err error) {
+	status := llmErrorStatus(err)
+	if status == StatusClientClosedRequest {
+		utils.Warning("客户端已断开，取消上游调用: %v", err)
+	}
+
+	body := gin.H{"error": "调用AI服务失败: " + err.Error()}
+
+	var circuitErr *services.CircuitOpenError
+	var upErr *services.UpstreamError
+	switch {
+	case errors.As(err, &circuitErr):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(circuitErr.RetryAfter.Seconds()))))
+	case errors.As(err, &upErr):
+		body["upstream_status"] = upErr.StatusCode
+		if upErr.Code != "" {
+			body["upstream_code"] = upErr.Code
+		}
+		if upErr.RetryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(upErr.RetryAfter.Seconds()))))
+		}
+	}
+
+	c.JSON(status, body)
+}
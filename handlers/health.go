@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"AiDemo/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthHandler 健康检查，返回大模型服务与熔断器状态；熔断器打开（冷却中）时返回 503，
+// 冷却结束进入半开后返回 200（status 为 degraded），让负载均衡重新导入流量以完成探测
+func HealthHandler(c *gin.Context) {
+	provider := services.GetChatProvider()
+	circuit := services.GetChatProviderStats()
+
+	status, code := "ok", http.StatusOK
+	if circuit != nil {
+		switch circuit.State {
+		case services.CircuitOpen.String():
+			// 熔断中返回 503，便于负载均衡摘除实例
+			status, code = "degraded", http.StatusServiceUnavailable
+		case services.CircuitHalfOpen.String():
+			status = "degraded"
+		}
+	}
+
+	c.JSON(code, gin.H{
+		"status": status,
+		"llm": gin.H{
+			"provider": provider.Name(),
+			"model":    provider.Model(),
+			"circuit":  circuit,
+		},
+	})
+}
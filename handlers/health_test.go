@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"AiDemo/models"
+	"AiDemo/services"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stubProvider 不会被调用的对话服务替身，健康检查只读取名称与熔断器状态
+type stubProvider struct{}
+
+func (stubProvider) Name() string  { return "stub" }
+func (stubProvider) Model() string { return "stub-model" }
+
+func (stubProvider) Chat(ctx context.Context, messages []models.Message) (services.ChatResult, error) {
+	return services.ChatResult{Content: "ok"}, nil
+}
+
+func (stubProvider) ChatStream(ctx context.Context, messages []models.Message, onDelta services.StreamDeltaFunc) (services.ChatResult, error) {
+	return services.ChatResult{Content: "ok"}, nil
+}
+
+func TestHealthHandlerRecoversAfterCooldown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const cooldown = 20 * time.Millisecond
+
+	previous := services.GetChatProvider()
+	t.Cleanup(func() { services.SetChatProvider(previous) })
+	breaker := services.NewCircuitBreaker("stub", 1, cooldown)
+	services.SetChatProvider(services.NewResilientProvider(stubProvider{}, services.RetryPolicy{}, breaker))
+
+	r := gin.New()
+	r.GET("/health", HealthHandler)
+	check := func(wantCode int, wantStatus, wantState string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+		var body struct {
+			Status string `json:"status"`
+			LLM    struct {
+				Circuit services.CircuitStats `json:"circuit"`
+			} `json:"llm"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		if w.Code != wantCode || body.Status != wantStatus || body.LLM.Circuit.State != wantState {
+			t.Fatalf("/health = %d %s（熔断器 %s），期望 %d %s（熔断器 %s）",
+				w.Code, body.Status, body.LLM.Circuit.State, wantCode, wantStatus, wantState)
+		}
+	}
+
+	check(http.StatusOK, "ok", "closed")
+	breaker.Failure()
+	check(http.StatusServiceUnavailable, "degraded", "open")
+
+	// 没有任何对话请求，冷却结束后健康检查也应恢复为 200
+	time.Sleep(cooldown + 5*time.Millisecond)
+	check(http.StatusOK, "degraded", "half_open")
+
+	breaker.Success()
+	check(http.StatusOK, "ok", "closed")
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"AiDemo/services"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// IngestHandler 异步入库任务处理器
+type IngestHandler struct {
+	ingestService *services.IngestService
+}
+
+// NewIngestHandler 创建新的异步入库任务处理器
+func NewIngestHandler() *IngestHandler {
+	return &IngestHandler{
+		ingestService: services.NewIngestService(),
+	}
+}
+
+// GetJob 获取入库任务的状态、片段进度与错误信息
+func (h *IngestHandler) GetJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "任务ID格式错误",
+		})
+		return
+	}
+
+	job, err := h.ingestService.GetJob(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "任务不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取入库任务失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
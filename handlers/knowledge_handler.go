@@ -4,28 +4,46 @@ import (
 	"AiDemo/models"
 	"AiDemo/services"
 	"AiDemo/utils"
-	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // CreateKnowledgeRequest 知识入库请求体
 type CreateKnowledgeRequest struct {
-	Title     string `json:"title" binding:"required"`
-	Content   string `json:"content" binding:"required"`
-	Source    string `json:"source"`
-	Namespace string `json:"namespace"`
+	Title     string   `json:"title" binding:"required"`
+	Content   string   `json:"content" binding:"required"`
+	Source    string   `json:"source"`
+	Namespace string   `json:"namespace"`
+	Tags      []string `json:"tags"` // 自定义标签，可用于检索过滤
+
+	Metadata map[string]string `json:"metadata"` // 文档自定义元数据
+
+	ChunkStrategy string `json:"chunk_strategy"` // 切分策略：recursive / fixed，为空时使用配置的默认策略
+	ChunkSize     int    `json:"chunk_size"`     // 每个片段的 token 上限，<= 0 时使用配置值
+	ChunkOverlap  *int   `json:"chunk_overlap"`  // 相邻片段重叠的 token 数，为空时使用配置值
 }
 
-// CreateKnowledgeResponse 知识入库响应体
-type CreateKnowledgeResponse struct {
-	Knowledges []*models.Knowledge `json:"knowledges"`
-	Chunks     int                 `json:"chunks"`
-	Message    string              `json:"message"`
+// knowledgeInput 转换为入库参数
+func (req CreateKnowledgeRequest) knowledgeInput() services.KnowledgeInput {
+	return services.KnowledgeInput{
+		Title:     req.Title,
+		Content:   req.Content,
+		Source:    req.Source,
+		Namespace: req.Namespace,
+		Tags:      normalizeTags(req.Tags),
+		Metadata:  req.Metadata,
+		Chunking: services.ChunkOptions{
+			Strategy: req.ChunkStrategy,
+			Size:     req.ChunkSize,
+			Overlap:  req.ChunkOverlap,
+		},
+	}
 }
 
-// CreateKnowledgeHandler 知识入库接口
+// CreateKnowledgeHandler 知识入库接口：参数校验通过后提交异步入库任务，返回 202 与任务（含预分配的文档 ID），
+// 进度通过 GET /rag/jobs/:id 查询；同一命名空间下已有相同内容时返回 200 与已有文档
 func CreateKnowledgeHandler(c *gin.Context) {
 	var req CreateKnowledgeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -41,26 +59,130 @@ func CreateKnowledgeHandler(c *gin.Context) {
 		req.Namespace = "default"
 	}
 
-	knowledges, err := services.SaveKnowledge(req.Title, req.Content, req.Source, req.Namespace)
+	job, err := services.NewIngestService().Submit(req.knowledgeInput())
+	if err != nil {
+		utils.Error("提交知识入库任务失败: %v", err)
+		c.JSON(documentErrorStatus(err), gin.H{"error": "知识入库失败: " + err.Error()})
+		return
+	}
+
+	if job.Duplicate {
+		c.JSON(http.StatusOK, job)
+		return
+	}
+	utils.Info("知识入库任务已提交: 任务 #%d, 文档 %s, Title=%s, Namespace=%s", job.ID, job.DocumentID, req.Title, req.Namespace)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// SearchKnowledgeRequest 知识检索请求体
+type SearchKnowledgeRequest struct {
+	Query         string               `json:"query" binding:"required"`
+	TopK          int                  `json:"top_k"`
+	RetrievalMode string               `json:"retrieval_mode"` // vector / keyword / hybrid
+	Reranker      string               `json:"reranker"`       // none / lexical / llm
+	Filter        *models.SearchFilter `json:"filter"`
+}
+
+// KnowledgeHit 知识检索命中的片段
+type KnowledgeHit struct {
+	ID             string    `json:"id"`
+	DocumentID     string    `json:"document_id"`
+	ChunkIndex     int       `json:"chunk_index"`
+	Title          string    `json:"title"`
+	HeadingPath    string    `json:"heading_path,omitempty"`
+	Content        string    `json:"content"`
+	Source         string    `json:"source"`
+	Namespace      string    `json:"namespace"`
+	Tags           []string  `json:"tags"`
+	EmbeddingModel string    `json:"embedding_model"`
+	CreatedAt      time.Time `json:"created_at"`
+	Score          float64   `json:"score"`
+	RetrievalScore float64   `json:"retrieval_score"`
+	RerankScore    float64   `json:"rerank_score,omitempty"`
+	VectorScore    float64   `json:"vector_score"`
+	KeywordScore   float64   `json:"keyword_score"`
+}
+
+// SearchKnowledgeResponse 知识检索响应体
+type SearchKnowledgeResponse struct {
+	Results       []KnowledgeHit      `json:"results"`
+	Filter        models.SearchFilter `json:"filter"`
+	RetrievalMode string              `json:"retrieval_mode"`
+	Reranker      string              `json:"reranker"`
+}
+
+// SearchKnowledgeHandler 知识检索接口：按过滤条件检索片段，不调用大模型生成回答
+func SearchKnowledgeHandler(c *gin.Context) {
+	var req SearchKnowledgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if req.TopK <= 0 {
+		req.TopK = services.DefaultTopK
+	}
+
+	retrievalMode, err := services.ParseRetrievalMode(req.RetrievalMode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	reranker, err := services.NewReranker(req.Reranker)
 	if err != nil {
-		utils.Error("知识入库失败: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "知识入库失败: " + err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	filter, err := buildSearchFilter("", req.Filter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
 		return
 	}
+	rerankerName := services.RerankerNone
+	if reranker != nil {
+		rerankerName = reranker.Name()
+	}
 
-	chunksCount := len(knowledges)
-	if chunksCount > 0 {
-		utils.Info("知识入库成功: 共 %d 个片段, Title=%s, Namespace=%s", chunksCount, req.Title, req.Namespace)
+	scored, err := services.RetrieveRelevantDocsWithScores(c.Request.Context(), req.Query, services.RetrieveOptions{
+		Filter:   filter,
+		TopK:     req.TopK,
+		Mode:     retrievalMode,
+		Reranker: rerankerName,
+	})
+	if err != nil {
+		c.JSON(llmErrorStatus(err), gin.H{"error": "检索知识库失败: " + err.Error()})
+		return
 	}
 
-	message := "知识入库成功，已自动完成向量化"
-	if chunksCount > 1 {
-		message = fmt.Sprintf("知识入库成功，已自动切分为 %d 个片段并完成向量化", chunksCount)
+	results := make([]KnowledgeHit, 0, len(scored))
+	for _, s := range scored {
+		tags := []string(s.Doc.Tags)
+		if tags == nil {
+			tags = []string{}
+		}
+		results = append(results, KnowledgeHit{
+			ID:             s.Doc.ID,
+			DocumentID:     s.Doc.DocumentID,
+			ChunkIndex:     s.Doc.ChunkIndex,
+			Title:          s.Doc.Title,
+			HeadingPath:    s.Doc.HeadingPath,
+			Content:        s.Doc.Content,
+			Source:         s.Doc.Source,
+			Namespace:      s.Doc.Namespace,
+			Tags:           tags,
+			EmbeddingModel: s.Doc.EmbeddingModel,
+			CreatedAt:      s.Doc.CreatedAt,
+			Score:          s.Score,
+			RetrievalScore: s.RetrievalScore,
+			RerankScore:    s.RerankScore,
+			VectorScore:    s.VectorScore,
+			KeywordScore:   s.KeywordScore,
+		})
 	}
 
-	c.JSON(http.StatusOK, CreateKnowledgeResponse{
-		Knowledges: knowledges,
-		Chunks:     chunksCount,
-		Message:    message,
+	c.JSON(http.StatusOK, SearchKnowledgeResponse{
+		Results:       results,
+		Filter:        filter,
+		RetrievalMode: retrievalMode,
+		Reranker:      rerankerName,
 	})
 }
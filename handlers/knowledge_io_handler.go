@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"AiDemo/services"
+	"AiDemo/utils"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KnowledgeIOHandler 知识库 JSONL 导入导出处理器
+type KnowledgeIOHandler struct {
+	ioService *services.KnowledgeIOService
+}
+
+// NewKnowledgeIOHandler 创建新的知识库导入导出处理器
+func NewKnowledgeIOHandler() *KnowledgeIOHandler {
+	return &KnowledgeIOHandler{
+		ioService: services.NewKnowledgeIOService(),
+	}
+}
+
+// ImportKnowledge 导入 JSONL（请求体直接为 JSONL，或 multipart 的 file 字段），每行一个文档。
+// 记录提交为异步入库任务，单行失败不影响其他行；全部失败或读取请求体失败时返回 400
+func (h *KnowledgeIOHandler) ImportKnowledge(c *gin.Context) {
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误: " + err.Error(),
+			})
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误: " + err.Error(),
+			})
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	summary, err := h.ioService.Import(c.Request.Context(), body, services.ImportOptions{
+		Namespace: c.Query("namespace"),
+	})
+	if err != nil {
+		utils.Error("JSONL 导入中断: %v", err)
+		status := http.StatusBadRequest
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		c.JSON(status, gin.H{
+			"error":   "导入中断: " + err.Error(),
+			"summary": summary,
+		})
+		return
+	}
+
+	status := http.StatusOK
+	switch {
+	case summary.Total == 0:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: 没有可导入的记录",
+		})
+		return
+	case summary.Failed == summary.Total:
+		status = http.StatusBadRequest
+	case summary.Queued > 0:
+		status = http.StatusAccepted
+	}
+	utils.Info("JSONL 导入完成: 共 %d 行, 写入 %d, 排队 %d, 重复 %d, 失败 %d",
+		summary.Total, summary.Imported, summary.Queued, summary.Duplicates, summary.Failed)
+	c.JSON(status, summary)
+}
+
+// ExportKnowledge 以 JSONL 流式导出文档，namespace 为空时导出全部，vectors=true 时附带片段与向量
+func (h *KnowledgeIOHandler) ExportKnowledge(c *gin.Context) {
+	namespace := c.Query("namespace")
+	includeVectors := c.Query("vectors") == "true"
+
+	name := namespace
+	if name == "" {
+		name = "all"
+	}
+	filename := fmt.Sprintf("knowledge-%s-%s.jsonl", name, time.Now().Format("20060102150405"))
+	c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	count, err := h.ioService.Export(c.Request.Context(), c.Writer, namespace, includeVectors)
+	if err != nil {
+		// 响应已开始写出，只能记录错误
+		utils.Error("JSONL 导出中断: 已导出 %d 个文档: %v", count, err)
+		return
+	}
+	utils.Info("JSONL 导出完成: 命名空间=%q, 共 %d 个文档, 含向量=%v", namespace, count, includeVectors)
+}
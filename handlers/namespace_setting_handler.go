@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"AiDemo/models"
+	"AiDemo/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NamespaceSettingHandler 命名空间配置处理器
+type NamespaceSettingHandler struct {
+	settingService *services.NamespaceSettingService
+}
+
+// NewNamespaceSettingHandler 创建新的命名空间配置处理器
+func NewNamespaceSettingHandler() *NamespaceSettingHandler {
+	return &NamespaceSettingHandler{
+		settingService: services.NewNamespaceSettingService(),
+	}
+}
+
+// ListSettings 获取全部命名空间配置
+func (h *NamespaceSettingHandler) ListSettings(c *gin.Context) {
+	settings, err := h.settingService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取命名空间配置失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"settings": settings,
+	})
+}
+
+// GetSetting 获取命名空间配置（没有单独配置时为 null）及合并默认值后生效的回答策略
+func (h *NamespaceSettingHandler) GetSetting(c *gin.Context) {
+	namespace := c.Param("namespace")
+	setting, err := h.settingService.Get(namespace)
+	if err != nil && !errors.Is(err, services.ErrNamespaceSettingNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取命名空间配置失败: " + err.Error(),
+		})
+		return
+	}
+	policy, err := h.settingService.AnswerPolicy(namespace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取回答策略失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"setting":       setting,
+		"answer_policy": policy,
+	})
+}
+
+// PutSetting 整体替换命名空间配置，未提供的字段使用全局默认值
+func (h *NamespaceSettingHandler) PutSetting(c *gin.Context) {
+	var req models.NamespaceSettingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	setting, err := h.settingService.Put(c.Param("namespace"), req)
+	if err != nil {
+		c.JSON(namespaceSettingErrorStatus(err), gin.H{
+			"error": "保存命名空间配置失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, setting)
+}
+
+// DeleteSetting 删除命名空间配置，恢复使用全局默认值
+func (h *NamespaceSettingHandler) DeleteSetting(c *gin.Context) {
+	if err := h.settingService.Delete(c.Param("namespace")); err != nil {
+		c.JSON(namespaceSettingErrorStatus(err), gin.H{
+			"error": "删除命名空间配置失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "命名空间配置已删除",
+	})
+}
+
+// namespaceSettingErrorStatus 将命名空间配置服务的错误映射为 HTTP 状态码
+func namespaceSettingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrNamespaceSettingNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidNamespaceSetting):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"AiDemo/models"
+	"AiDemo/services"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PromptTemplateHandler 提示词模板与 A/B 实验处理器
+type PromptTemplateHandler struct {
+	templateService *services.PromptTemplateService
+}
+
+// NewPromptTemplateHandler 创建新的提示词模板处理器
+func NewPromptTemplateHandler() *PromptTemplateHandler {
+	return &PromptTemplateHandler{
+		templateService: services.NewPromptTemplateService(),
+	}
+}
+
+// ListTemplates 获取模板列表，?name= 只返回该名称的各个版本
+func (h *PromptTemplateHandler) ListTemplates(c *gin.Context) {
+	templates, err := h.templateService.ListTemplates(c.Query("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取提示词模板失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": templates,
+	})
+}
+
+// CreateTemplate 创建模板，已有同名模板时保存为下一个版本
+func (h *PromptTemplateHandler) CreateTemplate(c *gin.Context) {
+	var req models.PromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	tmpl, err := h.templateService.CreateTemplate(req)
+	if err != nil {
+		c.JSON(promptTemplateErrorStatus(err), gin.H{
+			"error": "创建提示词模板失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// GetTemplate 获取指定版本的模板
+func (h *PromptTemplateHandler) GetTemplate(c *gin.Context) {
+	id, ok := promptIDParam(c, "模板ID格式错误")
+	if !ok {
+		return
+	}
+
+	tmpl, err := h.templateService.GetTemplate(id)
+	if err != nil {
+		c.JSON(promptTemplateErrorStatus(err), gin.H{
+			"error": "获取提示词模板失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// PublishVersion 以指定模板的名称发布新版本；已发布的版本不可修改，绑定到旧版本的命名空间不受影响
+func (h *PromptTemplateHandler) PublishVersion(c *gin.Context) {
+	id, ok := promptIDParam(c, "模板ID格式错误")
+	if !ok {
+		return
+	}
+
+	var req models.PromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	tmpl, err := h.templateService.PublishVersion(id, req)
+	if err != nil {
+		c.JSON(promptTemplateErrorStatus(err), gin.H{
+			"error": "发布提示词模板失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// DeleteTemplate 删除模板版本，仍被命名空间或实验引用时返回 409
+func (h *PromptTemplateHandler) DeleteTemplate(c *gin.Context) {
+	id, ok := promptIDParam(c, "模板ID格式错误")
+	if !ok {
+		return
+	}
+
+	if err := h.templateService.DeleteTemplate(id); err != nil {
+		c.JSON(promptTemplateErrorStatus(err), gin.H{
+			"error": "删除提示词模板失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "提示词模板已删除",
+	})
+}
+
+// ListExperiments 获取全部实验
+func (h *PromptTemplateHandler) ListExperiments(c *gin.Context) {
+	experiments, err := h.templateService.ListExperiments()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取提示词实验失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"experiments": experiments,
+	})
+}
+
+// CreateExperiment 创建实验
+func (h *PromptTemplateHandler) CreateExperiment(c *gin.Context) {
+	var req models.PromptExperimentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	exp, err := h.templateService.CreateExperiment(req)
+	if err != nil {
+		c.JSON(promptTemplateErrorStatus(err), gin.H{
+			"error": "创建提示词实验失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, exp)
+}
+
+// GetExperiment 获取实验
+func (h *PromptTemplateHandler) GetExperiment(c *gin.Context) {
+	id, ok := promptIDParam(c, "实验ID格式错误")
+	if !ok {
+		return
+	}
+
+	exp, err := h.templateService.GetExperiment(id)
+	if err != nil {
+		c.JSON(promptTemplateErrorStatus(err), gin.H{
+			"error": "获取提示词实验失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, exp)
+}
+
+// UpdateExperiment 整体替换实验的名称与分流配置
+func (h *PromptTemplateHandler) UpdateExperiment(c *gin.Context) {
+	id, ok := promptIDParam(c, "实验ID格式错误")
+	if !ok {
+		return
+	}
+
+	var req models.PromptExperimentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	exp, err := h.templateService.UpdateExperiment(id, req)
+	if err != nil {
+		c.JSON(promptTemplateErrorStatus(err), gin.H{
+			"error": "更新提示词实验失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, exp)
+}
+
+// DeleteExperiment 删除实验，仍绑定到命名空间时返回 409
+func (h *PromptTemplateHandler) DeleteExperiment(c *gin.Context) {
+	id, ok := promptIDParam(c, "实验ID格式错误")
+	if !ok {
+		return
+	}
+
+	if err := h.templateService.DeleteExperiment(id); err != nil {
+		c.JSON(promptTemplateErrorStatus(err), gin.H{
+			"error": "删除提示词实验失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "提示词实验已删除",
+	})
+}
+
+// promptIDParam 解析路径中的模板或实验 ID，格式错误时直接返回 400
+func promptIDParam(c *gin.Context, message string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": message,
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// promptTemplateErrorStatus 将提示词模板服务的错误映射为 HTTP 状态码
+func promptTemplateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPromptTemplateNotFound), errors.Is(err, services.ErrPromptExperimentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidPromptTemplate):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrPromptInUse):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"AiDemo/config"
 	"AiDemo/models"
 	"AiDemo/services"
+	"AiDemo/utils"
+	"context"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,6 +19,19 @@ type RAGChatRequest struct {
 	Namespace string `json:"namespace"`
 	TopK      int    `json:"top_k"`
 	Debug     bool   `json:"debug"`
+	Stream    bool   `json:"stream"` // 是否以 SSE 流式返回
+
+	// 会话 ID：携带时结合最近的对话改写追问后再检索，提示词附带最近对话，并保存本轮问答及检索到的片段
+	SessionID string `json:"session_id"`
+
+	RetrievalMode string `json:"retrieval_mode"` // 检索模式：vector / keyword / hybrid，为空时使用配置的默认模式
+	Reranker      string `json:"reranker"`       // 重排器：none / lexical / llm，为空时使用配置的默认重排器
+	Strategy      string `json:"strategy"`       // 查询扩展策略：none / multi_query / hyde，为空时使用配置的默认策略
+
+	MMRLambda       *float64 `json:"mmr_lambda"`         // MMR 相关性权重（0-1），1 表示不做多样化
+	MaxChunksPerDoc *int     `json:"max_chunks_per_doc"` // 同一文档最多返回的片段数，0 表示不限制
+
+	Filter *models.SearchFilter `json:"filter"` // 元数据过滤，filter.namespace 为空时使用 namespace
 }
 
 // RAGChatResponse RAG 聊天响应体
@@ -24,8 +41,34 @@ type RAGChatResponse struct {
 	DocsCount int       `json:"docs_count"`
 	Namespace string    `json:"namespace,omitempty"`
 	HitDocs   []string  `json:"hit_docs,omitempty"`
+	HitDocIDs []string  `json:"hit_document_ids,omitempty"`  // 调试：各命中片段所属的文档 ID
+	HitChunks []int     `json:"hit_chunk_indexes,omitempty"` // 调试：各命中片段在文档中的序号
 	Scores    []float64 `json:"scores,omitempty"`
 	Fallback  bool      `json:"fallback,omitempty"`
+
+	FallbackPolicy string `json:"fallback_policy,omitempty"` // 触发的兜底策略：general_answer / refuse / ask_clarifying_question
+	FilteredHits   int    `json:"filtered_hits,omitempty"`   // 调试：因向量相似度低于最低得分被过滤的片段数
+
+	SessionID      string `json:"session_id,omitempty"`
+	RewrittenQuery string `json:"rewritten_query,omitempty"` // 追问改写后用于检索的独立问题，与原问题相同时为空
+
+	Citations []models.Citation `json:"citations"` // 回答中 [n] 标注的引用，编号对应提示词中的知识片段
+
+	Prompt *models.PromptSelection `json:"prompt,omitempty"` // 构建知识提示词使用的模板（兜底与普通模式不返回）
+
+	RetrievalMode   string        `json:"retrieval_mode,omitempty"`
+	Reranker        string        `json:"reranker,omitempty"`
+	RetrievalScores []float64     `json:"retrieval_scores,omitempty"` // 调试：重排前的检索得分
+	RerankScores    []float64     `json:"rerank_scores,omitempty"`    // 调试：重排后的得分
+	VectorScores    []float64     `json:"vector_scores,omitempty"`    // 调试：各命中片段的向量相似度
+	KeywordScores   []float64     `json:"keyword_scores,omitempty"`   // 调试：各命中片段的 BM25 得分
+	Model           string        `json:"model,omitempty"`
+	Usage           *models.Usage `json:"usage,omitempty"`
+	Cost            float64       `json:"cost,omitempty"`
+
+	Strategy           string   `json:"strategy,omitempty"`            // 实际使用的查询扩展策略，keyword 模式下 hyde 退化为 none
+	ExpandedQueries    []string `json:"expanded_queries,omitempty"`    // 调试：multi_query 生成的改写问题
+	HypotheticalAnswer string   `json:"hypothetical_answer,omitempty"` // 调试：hyde 生成的假设回答
 }
 
 // RAGChatHandler 基于 RAG 的问答接口
@@ -44,35 +87,131 @@ func RAGChatHandler(c *gin.Context) {
 		req.TopK = services.DefaultTopK
 	}
 
-	if req.Mode == "normal" {
-		messages := []models.Message{
-			{Role: "user", Content: req.Query},
+	// 会话模式：读取最近的对话用于改写追问，随提示词发送的历史由 buildRAGMessages 按 token 预算构建
+	var history []models.ChatMessage
+	if req.SessionID != "" {
+		sessionService := services.NewSessionService()
+		// 与 /chat 一致：会话不存在时以客户端指定的 ID 创建
+		if _, err := sessionService.GetOrCreateSession(req.SessionID, newSessionName()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建会话失败: " + err.Error()})
+			return
 		}
-		answer, err := services.CallDoubao(messages)
+		var err error
+		if history, err = sessionService.GetRecentMessages(req.SessionID, config.RAGHistoryMessages); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取会话历史失败: " + err.Error()})
+			return
+		}
+	}
+
+	if req.Mode == "normal" {
+		messages, err := buildRAGMessages(c.Request.Context(), req, "", req.Query)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "调用 AI 服务失败: " + err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "构建对话上下文失败: " + err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, RAGChatResponse{
-			Answer:    answer,
+		answerRAG(c, req, messages, "", nil, RAGChatResponse{
 			Mode:      "normal",
 			DocsCount: 0,
+			SessionID: req.SessionID,
 		})
 		return
 	}
 
-	var docs []models.Knowledge
-	var scored []services.ScoredDoc
-	var err error
+	retrievalMode, err := services.ParseRetrievalMode(req.RetrievalMode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	reranker, err := services.NewReranker(req.Reranker)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	strategy, err := services.ParseQueryStrategy(req.Strategy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if req.MMRLambda != nil && (*req.MMRLambda < 0 || *req.MMRLambda > 1) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: mmr_lambda 取值范围为 0-1"})
+		return
+	}
+	filter, err := buildSearchFilter(req.Namespace, req.Filter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	rerankerName := services.RerankerNone
+	if reranker != nil {
+		rerankerName = reranker.Name()
+	}
 
-	if req.Namespace != "" {
-		scored, err = services.RetrieveRelevantDocsWithScores(req.Query, req.Namespace, req.TopK)
-	} else {
-		scored, err = services.RetrieveRelevantDocsWithScores(req.Query, "", req.TopK)
+	// 在改写与检索之前读取命名空间的回答策略，避免策略出错时白白消耗扩展与重排的调用。
+	// keyword 模式没有向量相似度，忽略最低得分，只按命中数判断
+	policy, err := services.NewNamespaceSettingService().AnswerPolicy(filter.Namespace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取回答策略失败: " + err.Error()})
+		return
 	}
+	if retrievalMode == services.RetrievalModeKeyword && policy.MinScore > 0 {
+		utils.Info("命名空间 %q 使用 keyword 检索，忽略最低得分 %g，只要求 %d 个命中",
+			filter.Namespace, policy.MinScore, policy.MinHits)
+		policy.MinScore = 0
+	}
+
+	// 追问改写为独立问题后再检索，改写失败时使用原问题
+	query := req.Query
+	if len(history) > 0 {
+		rewritten, err := services.RewriteQuery(c.Request.Context(), req.SessionID, history, req.Query)
+		if err != nil {
+			utils.Warning("会话 %s 改写追问失败，使用原问题检索: %v", req.SessionID, err)
+		}
+		query = rewritten
+	}
+	rewrittenQuery := ""
+	if query != req.Query {
+		rewrittenQuery = query
+		utils.Info("会话 %s 追问改写: %q -> %q", req.SessionID, req.Query, query)
+	}
+
+	var docs []models.Knowledge
+	retrieved, err := services.Retrieve(c.Request.Context(), query, services.RetrieveOptions{
+		Filter:   filter,
+		TopK:     req.TopK,
+		Mode:     retrievalMode,
+		Reranker: rerankerName,
+		Strategy: strategy,
 
+		SessionID:       req.SessionID,
+		MMRLambda:       req.MMRLambda,
+		MaxChunksPerDoc: req.MaxChunksPerDoc,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "检索知识库失败: " + err.Error()})
+		c.JSON(llmErrorStatus(err), gin.H{"error": "检索知识库失败: " + err.Error()})
+		return
+	}
+
+	// 按命名空间的回答策略过滤低分片段，命中不足时执行兜底策略
+	scored, enough := services.ApplyAnswerPolicy(retrieved.Docs, policy)
+	filtered := 0
+	if req.Debug {
+		filtered = len(retrieved.Docs) - len(scored)
+	}
+	if !enough {
+		utils.Info("命名空间 %q 命中不足: %d 个片段的向量相似度达到最低得分 %g（要求 %d 个），执行兜底策略 %s",
+			filter.Namespace, len(scored), policy.MinScore, policy.MinHits, policy.Fallback)
+		answerFallback(c, req, policy, retrieved.Docs, RAGChatResponse{
+			Mode:           "fallback",
+			DocsCount:      0,
+			Namespace:      filter.Namespace,
+			HitDocs:        []string{},
+			Scores:         []float64{},
+			Fallback:       true,
+			FallbackPolicy: policy.Fallback,
+			FilteredHits:   filtered,
+			SessionID:      req.SessionID,
+			RewrittenQuery: rewrittenQuery,
+		})
 		return
 	}
 
@@ -81,57 +220,225 @@ func RAGChatHandler(c *gin.Context) {
 		docs = append(docs, s.Doc)
 	}
 
-	// 知识库无命中时，退化为普通对话
-	if len(docs) == 0 {
-		messages := []models.Message{
-			{Role: "user", Content: req.Query},
+	// 按命名空间绑定的模板或实验选择提示词模板，模板 ID 记录在日志与响应中，用于对比不同模板的效果
+	template, selection, err := services.NewPromptTemplateService().Select(filter.Namespace, req.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "选择提示词模板失败: " + err.Error()})
+		return
+	}
+	utils.Info("RAG 回答使用提示词模板 #%d（%s v%d，实验 #%d），命名空间 %q",
+		selection.TemplateID, selection.TemplateName, selection.Version, selection.ExperimentID, filter.Namespace)
+	prompt := services.BuildRAGPromptWithTemplate(query, docs, template)
+
+	messages, err := buildRAGMessages(c.Request.Context(), req, "你是一个企业级知识库问答助手，请严格根据提供的知识内容回答问题。", prompt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "构建对话上下文失败: " + err.Error()})
+		return
+	}
+
+	resp := RAGChatResponse{
+		Mode:          "rag",
+		DocsCount:     len(docs),
+		Namespace:     filter.Namespace,
+		HitDocs:       make([]string, 0, len(scored)),
+		Scores:        make([]float64, 0, len(scored)),
+		Fallback:      false,
+		RetrievalMode: retrievalMode,
+		Reranker:      rerankerName,
+		Strategy:      retrieved.Strategy,
+		FilteredHits:  filtered,
+		Prompt:        &selection,
+
+		SessionID:      req.SessionID,
+		RewrittenQuery: rewrittenQuery,
+	}
+	if req.Debug {
+		if e := retrieved.Expansion; e != nil {
+			resp.ExpandedQueries = e.Queries
+			resp.HypotheticalAnswer = e.HypotheticalAnswer
 		}
-		answer, err := services.CallDoubao(messages)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "调用 AI 服务失败: " + err.Error()})
-			return
+		for _, s := range scored {
+			resp.HitDocs = append(resp.HitDocs, s.Doc.Title)
+			resp.HitDocIDs = append(resp.HitDocIDs, s.Doc.DocumentID)
+			resp.HitChunks = append(resp.HitChunks, s.Doc.ChunkIndex)
+			resp.Scores = append(resp.Scores, s.Score)
+			resp.RetrievalScores = append(resp.RetrievalScores, s.RetrievalScore)
+			if reranker != nil {
+				resp.RerankScores = append(resp.RerankScores, s.RerankScore)
+			}
+			resp.VectorScores = append(resp.VectorScores, s.VectorScore)
+			resp.KeywordScores = append(resp.KeywordScores, s.KeywordScore)
 		}
+	}
 
-		c.JSON(http.StatusOK, RAGChatResponse{
-			Answer:    "未找到相关知识，使用普通模式回答：" + answer,
-			Mode:      "fallback",
-			DocsCount: 0,
-			HitDocs:   []string{},
-			Scores:    []float64{},
-			Fallback:  true,
-		})
+	answerRAG(c, req, messages, "", scored, resp)
+}
+
+// answerFallback 命中不足时按回答策略兜底：general_answer 退化为普通对话，refuse 直接返回拒答话术，
+// ask_clarifying_question 请模型提出澄清问题（附上低分候选的标题作为提示）
+func answerFallback(c *gin.Context, req RAGChatRequest, policy models.AnswerPolicy, candidates []services.ScoredDoc, resp RAGChatResponse) {
+	if policy.Fallback == models.FallbackRefuse {
+		answerRAG(c, req, nil, policy.RefuseMessage, nil, resp)
 		return
 	}
 
-	prompt := services.BuildRAGPrompt(req.Query, docs)
+	system, prefix := "", "未找到相关知识，使用普通模式回答："
+	if policy.Fallback == models.FallbackAskClarifying {
+		system = "知识库中没有找到与用户问题足够相关的内容。请不要直接回答问题，也不要编造内容，" +
+			"而是用一两句话向用户提出澄清问题，请其补充具体的对象、场景或关键词。"
+		if topics := candidateTitles(candidates, 5); len(topics) > 0 {
+			system += "知识库中可能相关的主题有：" + strings.Join(topics, "、") + "，可以询问用户是否想了解其中的内容。"
+		}
+		prefix = ""
+	}
+	messages, err := buildRAGMessages(c.Request.Context(), req, system, req.Query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "构建对话上下文失败: " + err.Error()})
+		return
+	}
+	answerRAG(c, req, messages, prefix, nil, resp)
+}
+
+// candidateTitles 按检索顺序返回去重后的前 n 个片段标题
+func candidateTitles(candidates []services.ScoredDoc, n int) []string {
+	var titles []string
+	seen := map[string]struct{}{}
+	for _, s := range candidates {
+		if _, ok := seen[s.Doc.Title]; ok || s.Doc.Title == "" {
+			continue
+		}
+		seen[s.Doc.Title] = struct{}{}
+		if titles = append(titles, s.Doc.Title); len(titles) == n {
+			break
+		}
+	}
+	return titles
+}
 
-	messages := []models.Message{
-		{Role: "system", Content: "你是一个企业级知识库问答助手，请严格根据提供的知识内容回答问题。"},
-		{Role: "user", Content: prompt},
+// buildRAGMessages 构建发送给模型的消息，最后一条为本次的用户消息 content，systemPrompt 为空时不发送系统消息。
+// 携带会话时与 /chat 相同，由 HistoryBuilder 按 token 预算附上会话摘要与最近的对话；
+// 历史回答中的引用编号指向当时的知识片段，去掉后再带入，避免模型沿用旧编号
+func buildRAGMessages(ctx context.Context, req RAGChatRequest, systemPrompt, content string) ([]models.Message, error) {
+	if req.SessionID == "" || config.RAGHistoryMessages <= 0 {
+		var messages []models.Message
+		if systemPrompt != "" {
+			messages = append(messages, models.Message{Role: "system", Content: systemPrompt})
+		}
+		return append(messages, models.Message{Role: "user", Content: content}), nil
 	}
 
-	answer, err := services.CallDoubao(messages)
+	messages, err := services.NewHistoryBuilder().BuildWithPrompt(ctx, req.SessionID, systemPrompt, content)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "调用 AI 服务失败: " + err.Error()})
+		return nil, err
+	}
+	for i := range messages[:len(messages)-1] {
+		if messages[i].Role == "assistant" {
+			messages[i].Content = services.StripCitationMarkers(messages[i].Content)
+		}
+	}
+	return messages, nil
+}
+
+// answerRAG 调用大模型生成回答，按请求选择一次性 JSON 返回或 SSE 流式返回
+// 流式模式下先逐段推送 delta 事件，结束时以 done 事件携带完整响应体。
+// sources 为提示词中按顺序编号的知识片段，用于解析回答中的引用；messages 为空时不调用大模型，直接以 prefix 作为回答。
+// 携带会话 ID 时保存提问与回答，流式回复中断时已生成的部分标记为不完整后保存
+func answerRAG(c *gin.Context, req RAGChatRequest, messages []models.Message, prefix string, sources []services.ScoredDoc, resp RAGChatResponse) {
+	sessionService := services.NewSessionService()
+	if req.SessionID != "" {
+		if err := sessionService.AddRAGQuery(req.SessionID, req.Query, resp.RewrittenQuery); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存用户消息失败"})
+			return
+		}
+	}
+	saveAnswer := func(result services.ChatResult, incomplete bool) error {
+		if req.SessionID == "" {
+			return nil
+		}
+		sourceIDs := make([]string, len(sources))
+		for i, s := range sources {
+			sourceIDs[i] = s.Doc.ID
+		}
+		return sessionService.AddRAGAnswer(req.SessionID, result, incomplete, sourceIDs, resp.Prompt, resp.FallbackPolicy)
+	}
+
+	if messages == nil {
+		resp.Answer = prefix
+		resp.Citations = []models.Citation{}
+		if err := saveAnswer(services.ChatResult{Content: prefix}, false); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存AI回复失败"})
+			return
+		}
+		if req.Stream {
+			prepareSSE(c)
+			sendSSE(c, "delta", gin.H{"content": prefix})
+			sendSSE(c, "done", resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
 		return
 	}
 
-	hitDocs := make([]string, 0, len(scored))
-	scores := make([]float64, 0, len(scored))
-	if req.Debug {
-		for _, s := range scored {
-			hitDocs = append(hitDocs, s.Doc.Title)
-			scores = append(scores, s.Score)
+	if req.Stream {
+		// 与 /chat 相同：调用完成时记录用量，中途失败时仅在已生成部分内容时记录
+		result, disconnected, err := streamReply(c, messages, prefix)
+		if err != nil {
+			if result.Content != prefix {
+				if saveErr := saveAnswer(result, true); saveErr != nil {
+					utils.Error("保存不完整的AI回复失败: %v", saveErr)
+				}
+				services.RecordUsage(req.SessionID, "rag", req.Mode, result)
+			}
+			if !disconnected {
+				sendSSE(c, "error", gin.H{"error": "调用AI服务失败: " + err.Error(), "status": llmErrorStatus(err), "session_id": req.SessionID})
+			}
+			return
+		}
+		services.RecordUsage(req.SessionID, "rag", req.Mode, result)
+		if err := saveAnswer(result, false); err != nil {
+			sendSSE(c, "error", gin.H{"error": "保存AI回复失败", "session_id": req.SessionID})
+			return
 		}
+		if disconnected {
+			return
+		}
+		resp.Answer = result.Content
+		fillRAGCitations(&resp, sources)
+		fillRAGUsage(&resp, result)
+		sendSSE(c, "done", resp)
+		return
 	}
 
-	c.JSON(http.StatusOK, RAGChatResponse{
-		Answer:    answer,
-		Mode:      "rag",
-		DocsCount: len(docs),
-		Namespace: req.Namespace,
-		HitDocs:   hitDocs,
-		Scores:    scores,
-		Fallback:  false,
-	})
+	result, err := services.GetChatProvider().Chat(c.Request.Context(), messages)
+	if err != nil {
+		respondLLMError(c, err)
+		return
+	}
+	resp.Answer = prefix + result.Content
+	services.RecordUsage(req.SessionID, "rag", req.Mode, result)
+	result.Content = resp.Answer
+	if err := saveAnswer(result, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存AI回复失败"})
+		return
+	}
+	fillRAGCitations(&resp, sources)
+	fillRAGUsage(&resp, result)
+	c.JSON(http.StatusOK, resp)
+}
+
+// fillRAGCitations 解析回答中的引用，引用了未提供的片段时记录警告
+func fillRAGCitations(resp *RAGChatResponse, sources []services.ScoredDoc) {
+	resp.Citations = services.ExtractCitations(resp.Answer, sources)
+	for _, citation := range resp.Citations {
+		if !citation.Valid {
+			utils.Warning("回答引用了未提供的知识片段 [%d]（共提供 %d 个）", citation.ID, len(sources))
+		}
+	}
+}
+
+// fillRAGUsage 在响应中附带模型与用量信息
+func fillRAGUsage(resp *RAGChatResponse, result services.ChatResult) {
+	resp.Model = result.Model
+	resp.Usage = &result.Usage
+	resp.Cost = services.EstimateCost(result.Model, result.Usage)
 }
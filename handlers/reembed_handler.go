@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"AiDemo/models"
+	"AiDemo/services"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ReembedHandler 向量重建管理处理器
+type ReembedHandler struct {
+	reembedService *services.ReembedService
+}
+
+// NewReembedHandler 创建新的向量重建管理处理器
+func NewReembedHandler() *ReembedHandler {
+	return &ReembedHandler{
+		reembedService: services.NewReembedService(),
+	}
+}
+
+// StartReembed 发起向量重建任务（存在未完成的任务时续跑），任务在后台执行
+func (h *ReembedHandler) StartReembed(c *gin.Context) {
+	var req models.ReembedRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	job, err := h.reembedService.Start(req.Namespace, req.BatchSize)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrReembedRunning) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"error": "发起向量重建失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetReembedStatus 获取当前向量模型、剩余过期片段数与最近一次任务
+func (h *ReembedHandler) GetReembedStatus(c *gin.Context) {
+	status, err := h.reembedService.Status(c.Query("namespace"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取向量重建状态失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// GetReembedJob 获取指定重建任务的进度
+func (h *ReembedHandler) GetReembedJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "任务ID格式错误",
+		})
+		return
+	}
+
+	job, err := h.reembedService.GetJob(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "任务不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取重建任务失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
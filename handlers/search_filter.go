@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"AiDemo/models"
+	"errors"
+	"strings"
+)
+
+// buildSearchFilter 合并请求中的命名空间与过滤条件并校验，filter.namespace 优先
+func buildSearchFilter(namespace string, f *models.SearchFilter) (models.SearchFilter, error) {
+	var filter models.SearchFilter
+	if f != nil {
+		filter = *f
+	}
+	if filter.Namespace == "" {
+		filter.Namespace = namespace
+	}
+	if filter.CreatedAfter != nil && filter.CreatedBefore != nil && !filter.CreatedAfter.Before(*filter.CreatedBefore) {
+		return filter, errors.New("created_after 必须早于 created_before")
+	}
+	filter.Tags = normalizeTags(filter.Tags)
+	return filter, nil
+}
+
+// normalizeTags 去除空白与重复标签，保持原有顺序
+func normalizeTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	seen := make(map[string]struct{}, len(tags))
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		out = append(out, t)
+	}
+	return out
+}
@@ -114,6 +114,12 @@ func (h *SessionHandler) GetSessionMessages(c *gin.Context) {
 		})
 		return
 	}
+	if err := h.sessionService.AttachSources(messages); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取消息来源失败: " + err.Error(),
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"messages": messages,
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"AiDemo/models"
+	"AiDemo/services"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// prepareSSE 设置 SSE 响应头并立即下发，让浏览器尽早进入流式接收
+func prepareSSE(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 关闭 Nginx 缓冲
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+}
+
+// sendSSE 发送一个 SSE 事件并立即刷新
+func sendSSE(c *gin.Context, event string, data interface{}) {
+	c.SSEvent(event, data)
+	c.Writer.Flush()
+}
+
+// streamReply 以 SSE 转发大模型的增量内容（delta 事件）
+// 返回拼接后的回复（含 prefix）、客户端是否中途断开，以及上游错误
+func streamReply(c *gin.Context, messages []models.Message, prefix string) (services.ChatResult, bool, error) {
+	prepareSSE(c)
+	if prefix != "" {
+		sendSSE(c, "delta", gin.H{"content": prefix})
+	}
+
+	result, err := services.GetChatProvider().ChatStream(c.Request.Context(), messages, func(delta string) error {
+		// 浏览器已断开或请求超时时中止读取上游
+		if err := c.Request.Context().Err(); err != nil {
+			return err
+		}
+		sendSSE(c, "delta", gin.H{"content": delta})
+		return nil
+	})
+
+	// 全局截止时间到达同样会使 context 结束，只有 Canceled 才视为客户端断开
+	disconnected := errors.Is(c.Request.Context().Err(), context.Canceled)
+	result.Content = prefix + result.Content
+	return result, disconnected, err
+}
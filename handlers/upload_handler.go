@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"AiDemo/config"
+	"AiDemo/services"
+	"AiDemo/utils"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadKnowledgeForm 文件入库表单字段（文件放在 files 或 file 字段，可多个）
+type UploadKnowledgeForm struct {
+	Namespace string   `form:"namespace"`
+	Title     string   `form:"title"` // 仅上传单个文件时生效，默认取文档标题或文件名
+	Tags      []string `form:"tags"`  // 可重复传递，也可用逗号分隔
+
+	ChunkStrategy string `form:"chunk_strategy"`
+	ChunkSize     int    `form:"chunk_size"`
+	ChunkOverlap  *int   `form:"chunk_overlap"`
+}
+
+// UploadFileResult 单个文件的入库结果
+type UploadFileResult struct {
+	Filename   string `json:"filename"`
+	FileType   string `json:"file_type,omitempty"`
+	JobID      uint   `json:"job_id,omitempty"`      // 异步入库任务 ID
+	DocumentID string `json:"document_id,omitempty"` // 预分配的文档 ID，内容重复时为已有文档的 ID
+	Duplicate  bool   `json:"duplicate,omitempty"`   // 同一命名空间下已有相同内容的文档，未重复入库
+	Title      string `json:"title,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// UploadKnowledgeResponse 文件入库响应体
+type UploadKnowledgeResponse struct {
+	Results   []UploadFileResult `json:"results"`
+	Succeeded int                `json:"succeeded"`
+	Failed    int                `json:"failed"`
+	Message   string             `json:"message"`
+}
+
+// UploadKnowledgeHandler 文件入库接口：识别文件类型并提取正文，每个文件提交一个异步入库任务，
+// 原始文件名记录为来源；部分文件失败不影响其他文件，全部失败时按首个错误返回状态码
+func UploadKnowledgeHandler(c *gin.Context) {
+	// 解析表单会把整个请求体读入内存或临时文件，先限制请求体大小
+	if limit := int64(config.UploadMaxRequestMB) << 20; limit > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	}
+
+	var form UploadKnowledgeForm
+	if err := c.ShouldBind(&form); err != nil {
+		uploadFormError(c, err)
+		return
+	}
+	multipartForm, err := c.MultipartForm()
+	if err != nil {
+		uploadFormError(c, err)
+		return
+	}
+	files := append(multipartForm.File["files"], multipartForm.File["file"]...)
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: 未上传文件（字段名 files 或 file）"})
+		return
+	}
+
+	if form.Namespace == "" {
+		form.Namespace = "default"
+	}
+	var tags []string
+	for _, t := range form.Tags {
+		tags = append(tags, strings.Split(t, ",")...)
+	}
+	tags = normalizeTags(tags)
+
+	resp := UploadKnowledgeResponse{Results: make([]UploadFileResult, 0, len(files))}
+	var firstErr error
+	for _, fh := range files {
+		result, err := ingestUploadedFile(fh, form, tags, len(files) == 1)
+		if err != nil {
+			result.Error = err.Error()
+			resp.Failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			utils.Warning("文件入库失败: %s: %v", fh.Filename, err)
+		} else {
+			resp.Succeeded++
+			utils.Info("文件入库任务已提交: %s -> 任务 #%d, 文档 %s", fh.Filename, result.JobID, result.DocumentID)
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	resp.Message = fmt.Sprintf("共 %d 个文件，已提交 %d 个入库任务，失败 %d 个", len(files), resp.Succeeded, resp.Failed)
+	status := http.StatusAccepted
+	if resp.Succeeded == 0 {
+		status = documentErrorStatus(firstErr)
+	}
+	c.JSON(status, resp)
+}
+
+// uploadFormError 返回解析上传表单失败的响应：请求体超过 UPLOAD_MAX_REQUEST_MB 时返回 413
+func uploadFormError(c *gin.Context, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("%s: 请求体超过 %d MB", services.ErrFileTooLarge, config.UploadMaxRequestMB),
+		})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+}
+
+// ingestUploadedFile 读取、提取单个文件并提交入库任务
+func ingestUploadedFile(fh *multipart.FileHeader, form UploadKnowledgeForm, tags []string, single bool) (UploadFileResult, error) {
+	filename := filepath.Base(fh.Filename)
+	result := UploadFileResult{Filename: filename}
+
+	limit := int64(config.UploadMaxMB) << 20
+	if limit > 0 && fh.Size > limit {
+		return result, fmt.Errorf("%w: 超过 %d MB", services.ErrFileTooLarge, config.UploadMaxMB)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return result, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return result, err
+	}
+
+	extracted, err := services.ExtractText(filename, data)
+	if err != nil {
+		return result, err
+	}
+	result.FileType = extracted.Type
+
+	title := extracted.Title
+	if single && form.Title != "" {
+		title = form.Title
+	}
+	if title == "" {
+		title = strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	result.Title = title
+
+	job, err := services.NewIngestService().Submit(services.KnowledgeInput{
+		Title:     title,
+		Content:   extracted.Content,
+		Source:    filename,
+		Namespace: form.Namespace,
+		Tags:      tags,
+		Metadata: map[string]string{
+			"filename":  filename,
+			"file_type": extracted.Type,
+			"file_size": strconv.FormatInt(fh.Size, 10),
+		},
+		Chunking: services.ChunkOptions{
+			Strategy: form.ChunkStrategy,
+			Size:     form.ChunkSize,
+			Overlap:  form.ChunkOverlap,
+		},
+	})
+	if err != nil {
+		return result, err
+	}
+	result.JobID = job.ID
+	result.DocumentID = job.DocumentID
+	result.Duplicate = job.Duplicate
+	return result, nil
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"AiDemo/models"
+	"AiDemo/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UsageHandler 用量统计处理器
+type UsageHandler struct {
+	usageService *services.UsageService
+}
+
+// NewUsageHandler 创建新的用量统计处理器
+func NewUsageHandler() *UsageHandler {
+	return &UsageHandler{
+		usageService: services.NewUsageService(),
+	}
+}
+
+// GetUsageReport 获取用量报表，支持按会话与日期范围过滤
+func (h *UsageHandler) GetUsageReport(c *gin.Context) {
+	var query models.UsageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	report, err := h.usageService.Report(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取用量报表失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
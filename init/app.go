@@ -2,10 +2,11 @@ package init
 
 import (
 	"AiDemo/config"
+	"AiDemo/services"
 	"fmt"
 )
 
-// InitBase 完成应用的基础初始化（日志、配置、数据库）
+// InitBase 完成应用的基础初始化（日志、配置、大模型服务、向量化服务、数据库、向量索引、关键词索引）
 // 返回一个清理函数，负责在程序退出时释放资源。
 func InitBase() (func(), error) {
 	// 初始化日志
@@ -15,6 +16,7 @@ func InitBase() (func(), error) {
 
 	// 如果后续任一初始化失败，需要确保已经初始化的资源被正确清理
 	cleanup := func() {
+		services.CloseVectorStore()
 		config.CloseDatabase()
 		CloseLog()
 	}
@@ -25,11 +27,45 @@ func InitBase() (func(), error) {
 		return nil, fmt.Errorf("加载配置失败: %w", err)
 	}
 
+	// 初始化大模型服务
+	if err := services.InitChatProvider(); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("大模型服务初始化失败: %w", err)
+	}
+
+	// 初始化向量化服务
+	if err := services.InitEmbedder(); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("向量化服务初始化失败: %w", err)
+	}
+
 	// 初始化数据库
 	if err := config.InitDatabase(); err != nil {
 		cleanup()
 		return nil, fmt.Errorf("数据库初始化失败: %w", err)
 	}
 
+	// 为尚未关联文档的历史片段补建文档
+	if err := services.BackfillDocuments(); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("历史片段补建文档失败: %w", err)
+	}
+	if err := services.BackfillContentHashes(); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("历史片段补算内容哈希失败: %w", err)
+	}
+
+	// 初始化向量索引（依赖数据库与向量化服务）
+	if err := services.InitVectorStore(); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("向量索引初始化失败: %w", err)
+	}
+
+	// 初始化关键词索引
+	if err := services.InitKeywordIndex(); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("关键词索引初始化失败: %w", err)
+	}
+
 	return cleanup, nil
 }
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"AiDemo/config"
 	"AiDemo/router"
+	"AiDemo/services"
+	"context"
+	"flag"
 	"log"
+	"os"
+	"os/signal"
 
 	initPkg "AiDemo/init"
 	"AiDemo/utils"
@@ -11,6 +17,12 @@ import (
 )
 
 func main() {
+	reembed := flag.Bool("reembed", false, "使用当前向量模型重建过期的知识向量后退出（可中断，再次执行时续跑）")
+	reembedNamespace := flag.String("reembed-namespace", "", "仅重建指定命名空间，为空表示全部")
+	reembedBatch := flag.Int("reembed-batch", services.DefaultReembedBatchSize, "向量重建批大小")
+	importFile := flag.String("import", "", "从 JSONL 文件导入知识（每行一个文档）后退出")
+	importNamespace := flag.String("import-namespace", "", "导入记录未指定命名空间时使用的命名空间，默认 default")
+	flag.Parse()
 
 	// 统一基础初始化（日志、配置、数据库）
 	utils.Info("正在进行基础初始化...")
@@ -21,6 +33,51 @@ func main() {
 	defer cleanup()
 	utils.Info("基础初始化完成")
 
+	if *reembed {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		job, err := services.NewReembedService().Run(ctx, *reembedNamespace, *reembedBatch)
+		if err != nil {
+			utils.Error("向量重建未完成: %v", err)
+			return
+		}
+		utils.Info("向量重建完成: 共重建 %d 个片段，目标模型 %s", job.Processed, job.TargetModel)
+		return
+	}
+
+	if *importFile != "" {
+		f, err := os.Open(*importFile)
+		if err != nil {
+			utils.Error("打开导入文件失败: %v", err)
+			return
+		}
+		defer f.Close()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		summary, err := services.NewKnowledgeIOService().Import(ctx, f, services.ImportOptions{
+			Namespace: *importNamespace,
+			Wait:      true,
+		})
+		utils.Info("JSONL 导入结果: 共 %d 行, 写入 %d, 重复 %d, 失败 %d",
+			summary.Total, summary.Imported, summary.Duplicates, summary.Failed)
+		if err != nil {
+			utils.Error("JSONL 导入未完成: %v", err)
+		}
+		return
+	}
+
+	// 续跑上次未完成的向量重建任务
+	services.ResumeReembedJobs()
+
+	// 启动异步入库 worker（续跑上次未完成的入库任务）
+	if err := services.StartIngestWorkers(context.Background(), config.IngestWorkers); err != nil {
+		log.Fatalf("启动入库任务 worker 失败: %v", err)
+	}
+
+	// 定期清理过期的幂等键
+	services.StartIdempotencyPurge(context.Background())
+
 	// 启动 HTTP 服务
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
@@ -1,5 +1,7 @@
 package models
 
+import "encoding/json"
+
 // Message/Request/Response 用于对接外部AI接口
 
 type Message struct {
@@ -8,8 +10,15 @@ type Message struct {
 }
 
 type RequestBody struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+	Model         string         `json:"model"`
+	Messages      []Message      `json:"messages"`
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+}
+
+// StreamOptions 流式请求选项，include_usage 让最后一个块携带 usage
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type Choice struct {
@@ -17,5 +26,75 @@ type Choice struct {
 }
 
 type ResponseBody struct {
+	Model   string   `json:"model"`
 	Choices []Choice `json:"choices"`
+	Usage   *Usage   `json:"usage"`
+}
+
+// Usage 一次调用的 token 用量
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// StreamChoice 流式响应中的增量片段
+type StreamChoice struct {
+	Delta        Message `json:"delta"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+// StreamResponseBody 流式响应中每个 data: 块的结构
+type StreamResponseBody struct {
+	Model   string         `json:"model"`
+	Choices []StreamChoice `json:"choices"`
+	Usage   *Usage         `json:"usage"`
+}
+
+// APIErrorBody 上游错误响应体：OpenAI 兼容接口的 error 为对象，Ollama 的 error 为字符串
+type APIErrorBody struct {
+	Error json.RawMessage `json:"error"`
+}
+
+// APIErrorDetail OpenAI 兼容接口的错误详情，code 可能是字符串或数字
+type APIErrorDetail struct {
+	Message string          `json:"message"`
+	Type    string          `json:"type"`
+	Code    json.RawMessage `json:"code"`
+}
+
+// OllamaRequestBody Ollama /api/chat 请求体
+type OllamaRequestBody struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream"`
+}
+
+// OllamaResponseBody Ollama /api/chat 响应体
+type OllamaResponseBody struct {
+	Model           string  `json:"model"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	PromptEvalCount int     `json:"prompt_eval_count"`
+	EvalCount       int     `json:"eval_count"`
+}
+
+// EmbeddingRequestBody OpenAI 兼容 /embeddings 请求体
+type EmbeddingRequestBody struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+// EmbeddingData 单条向量结果，index 对应请求中 input 的下标
+type EmbeddingData struct {
+	Index     int       `json:"index"`
+	Embedding []float64 `json:"embedding"`
+}
+
+// EmbeddingResponseBody OpenAI 兼容 /embeddings 响应体
+type EmbeddingResponseBody struct {
+	Model string          `json:"model"`
+	Data  []EmbeddingData `json:"data"`
+	Usage *Usage          `json:"usage"`
 }
@@ -5,10 +5,14 @@ type ChatRequest struct {
 	Message   string `json:"message" binding:"required"`
 	Role      string `json:"role"`
 	SessionID string `json:"session_id"`
+	Stream    bool   `json:"stream"` // 是否以 SSE 流式返回
 }
 
 // ChatResponse 聊天响应体
 type ChatResponse struct {
-	Reply     string `json:"reply"`
-	SessionID string `json:"session_id"`
+	Reply     string  `json:"reply"`
+	SessionID string  `json:"session_id"`
+	Model     string  `json:"model,omitempty"`
+	Usage     *Usage  `json:"usage,omitempty"`
+	Cost      float64 `json:"cost,omitempty"` // 按价格表估算的费用
 }
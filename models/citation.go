@@ -0,0 +1,14 @@
+package models
+
+// Citation 回答中以 [n] 标注的引用，n 对应提示词中知识片段的编号
+type Citation struct {
+	ID          int     `json:"id"` // 引用编号
+	KnowledgeID string  `json:"knowledge_id,omitempty"`
+	DocumentID  string  `json:"document_id,omitempty"`
+	Title       string  `json:"title,omitempty"`
+	HeadingPath string  `json:"heading_path,omitempty"`
+	Source      string  `json:"source,omitempty"`
+	Snippet     string  `json:"snippet,omitempty"` // 片段内容摘要
+	Score       float64 `json:"score,omitempty"`
+	Valid       bool    `json:"valid"` // 编号没有对应提供给模型的片段时为 false（模型编造的引用）
+}
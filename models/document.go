@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Document 知识文档：一次入库的原始文档，按顺序拥有若干知识片段（Knowledge.DocumentID / ChunkIndex）
+type Document struct {
+	ID         string     `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	Title      string     `json:"title" gorm:"type:varchar(255);not null"`
+	Source     string     `json:"source" gorm:"type:varchar(255);index"`
+	Namespace  string     `json:"namespace" gorm:"type:varchar(100);index"`
+	Checksum   string     `json:"checksum" gorm:"type:varchar(64);index"` // 原文 SHA-256
+	Metadata   StringMap  `json:"metadata" gorm:"type:text"`              // 自定义元数据，JSON 对象
+	Tags       StringList `json:"tags" gorm:"type:text"`                  // 自定义标签，写入每个片段
+	Version    int        `json:"version" gorm:"not null;default:1"`      // 每次整体替换后加 1
+	ChunkCount int        `json:"chunk_count"`
+	Content    string     `json:"content,omitempty" gorm:"type:text"` // 原文，列表接口不返回
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// DocumentWithChunks 文档及其按顺序排列的片段
+type DocumentWithChunks struct {
+	Document
+	Chunks []Knowledge `json:"chunks"`
+}
+
+// DocumentListQuery 文档列表查询参数
+type DocumentListQuery struct {
+	Namespace string `form:"namespace"`
+	Source    string `form:"source"`
+	Query     string `form:"q"` // 全文检索：按空白分词，标题或原文须包含每个词
+	Page      int    `form:"page"`
+	PageSize  int    `form:"page_size"`
+}
+
+// DeleteDocumentResponse 删除文档的结果
+type DeleteDocumentResponse struct {
+	ID            string `json:"id"`
+	DeletedChunks int    `json:"deleted_chunks"`
+	Message       string `json:"message"`
+}
+
+// DocumentListResponse 文档列表分页结果
+type DocumentListResponse struct {
+	Documents []Document `json:"documents"`
+	Total     int64      `json:"total"`
+	Page      int        `json:"page"`
+	PageSize  int        `json:"page_size"`
+}
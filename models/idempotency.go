@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// IdempotencyRecord 幂等键记录：携带相同 Idempotency-Key 的重复请求直接返回首次请求的响应
+type IdempotencyRecord struct {
+	Key         string    `gorm:"primaryKey;type:varchar(255)"`
+	RequestHash string    `gorm:"type:varchar(64);not null"` // 方法、路径与请求体的 SHA-256，用于识别复用同一幂等键的不同请求
+	StatusCode  int       // 首次请求的响应状态码，0 表示仍在处理中
+	ContentType string    `gorm:"type:varchar(100)"`
+	Response    string    `gorm:"type:text"`
+	CreatedAt   time.Time `gorm:"index"`
+	UpdatedAt   time.Time
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// 入库任务类型
+const (
+	IngestKindCreate  = "create"  // 新建文档
+	IngestKindReplace = "replace" // 整体替换已有文档
+)
+
+// 入库任务状态
+const (
+	IngestStatusQueued    = "queued"    // 排队中（服务重启时执行中的任务会重新排队）
+	IngestStatusRunning   = "running"   // 切分与向量化中
+	IngestStatusCompleted = "completed" // 文档与片段已写入
+	IngestStatusFailed    = "failed"    // 失败，原因见 error
+)
+
+// IngestJob 异步入库任务：由后台 worker 切分、向量化并写入文档，进度持久化在数据库中
+type IngestJob struct {
+	ID              uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	Kind            string     `json:"kind" gorm:"type:varchar(20);not null"`
+	Status          string     `json:"status" gorm:"type:varchar(20);not null;index"`
+	DocumentID      string     `json:"document_id" gorm:"type:varchar(255);index"` // 新建任务在提交时即分配文档 ID，内容重复时为已有文档的 ID
+	Duplicate       bool       `json:"duplicate"`                                  // 同一命名空间下已有相同内容的文档，未重复入库
+	Title           string     `json:"title" gorm:"type:varchar(255)"`
+	Namespace       string     `json:"namespace" gorm:"type:varchar(100)"`
+	TotalChunks     int        `json:"total_chunks"`     // 切分完成后确定
+	ProcessedChunks int        `json:"processed_chunks"` // 已完成向量化的片段数
+	Attempts        int        `json:"attempts"`         // 已开始执行的次数（含重启后续跑）
+	Error           string     `json:"error,omitempty" gorm:"type:text"`
+	Payload         string     `json:"-" gorm:"type:text"` // 入库参数（JSON），任务结束后清空
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	Document *DocumentWithChunks `json:"document,omitempty" gorm:"-"` // 提交时即判定为重复内容时返回已有文档与片段
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// StringList 以 JSON 数组存储的字符串列表
+type StringList []string
+
+// Value 序列化为 JSON 数组，空列表存为 []
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan 从 JSON 数组解析
+func (l *StringList) Scan(value interface{}) error {
+	data, err := jsonBytes(value, "StringList")
+	if err != nil || data == nil {
+		*l = nil
+		return err
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
+// StringMap 以 JSON 对象存储的字符串键值对
+type StringMap map[string]string
+
+// Value 序列化为 JSON 对象，空值存为 {}
+func (m StringMap) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(map[string]string(m))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan 从 JSON 对象解析
+func (m *StringMap) Scan(value interface{}) error {
+	data, err := jsonBytes(value, "StringMap")
+	if err != nil || data == nil {
+		*m = nil
+		return err
+	}
+	return json.Unmarshal(data, (*map[string]string)(m))
+}
+
+// PromptVariants 以 JSON 数组存储的实验模板列表
+type PromptVariants []PromptVariant
+
+// Value 序列化为 JSON 数组，空列表存为 []
+func (v PromptVariants) Value() (driver.Value, error) {
+	if v == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]PromptVariant(v))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan 从 JSON 数组解析
+func (v *PromptVariants) Scan(value interface{}) error {
+	data, err := jsonBytes(value, "PromptVariants")
+	if err != nil || data == nil {
+		*v = nil
+		return err
+	}
+	return json.Unmarshal(data, (*[]PromptVariant)(v))
+}
+
+// jsonBytes 取出数据库中 JSON 列的原始字节，NULL 或空串返回 nil
+func jsonBytes(value interface{}, typeName string) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		return []byte(v), nil
+	case []byte:
+		if len(v) == 0 {
+			return nil, nil
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("无法将 %T 解析为 %s", value, typeName)
+	}
+}
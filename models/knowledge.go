@@ -4,13 +4,18 @@ import "time"
 
 // Knowledge 知识库条目
 type Knowledge struct {
-	ID             string    `json:"id" gorm:"primaryKey;type:varchar(255)"`
-	Title          string    `json:"title" gorm:"type:varchar(255);not null"`
-	Content        string    `json:"content" gorm:"type:text;not null"`
-	Vector         string    `json:"vector" gorm:"type:text"`                  // 向量数据，JSON格式存储
-	Source         string    `json:"source" gorm:"type:varchar(255)"`          // 数据来源
-	Namespace      string    `json:"namespace" gorm:"type:varchar(100);index"` // 知识域命名空间
-	EmbeddingModel string    `json:"embedding_model" gorm:"type:varchar(100)"` // 使用的embedding模型版本
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID             string     `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	DocumentID     string     `json:"document_id" gorm:"type:varchar(255);index"` // 所属文档
+	ChunkIndex     int        `json:"chunk_index"`                                // 片段在文档中的顺序，从 0 开始
+	Title          string     `json:"title" gorm:"type:varchar(255);not null"`
+	Content        string     `json:"content" gorm:"type:text;not null"`
+	ContentHash    string     `json:"content_hash" gorm:"type:varchar(64);index"`     // 片段内容的 SHA-256，用于检索结果去重
+	HeadingPath    string     `json:"heading_path" gorm:"type:varchar(500)"`          // 片段所在的标题路径，如 "安装 > Linux"
+	Vector         string     `json:"vector" gorm:"type:text"`                        // 向量数据，JSON格式存储
+	Source         string     `json:"source" gorm:"type:varchar(255)"`                // 数据来源
+	Namespace      string     `json:"namespace" gorm:"type:varchar(100);index"`       // 知识域命名空间
+	EmbeddingModel string     `json:"embedding_model" gorm:"type:varchar(100);index"` // 使用的embedding模型版本
+	Tags           StringList `json:"tags" gorm:"type:text"`                          // 自定义标签，JSON 数组
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
 }
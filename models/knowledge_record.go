@@ -0,0 +1,41 @@
+package models
+
+// KnowledgeRecord JSONL 导入导出的单条记录，一行一个文档
+type KnowledgeRecord struct {
+	ID        string            `json:"id,omitempty"` // 导出时为原文档 ID，导入时忽略（重新分配）
+	Title     string            `json:"title"`
+	Content   string            `json:"content"`
+	Source    string            `json:"source,omitempty"`
+	Namespace string            `json:"namespace,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Chunks    []RecordChunk     `json:"chunks,omitempty"` // 仅导出向量时输出；导入时向量模型与当前模型一致则直接使用，否则重新切分与向量化
+}
+
+// RecordChunk 随记录导出的片段及其向量
+type RecordChunk struct {
+	Content        string    `json:"content"`
+	HeadingPath    string    `json:"heading_path,omitempty"`
+	EmbeddingModel string    `json:"embedding_model"`
+	Vector         []float64 `json:"vector"`
+}
+
+// ImportLineResult JSONL 导入中单行的处理结果
+type ImportLineResult struct {
+	Line       int    `json:"line"` // 行号，从 1 开始
+	Title      string `json:"title,omitempty"`
+	DocumentID string `json:"document_id,omitempty"`
+	JobID      uint   `json:"job_id,omitempty"`    // 排队入库时的任务 ID
+	Duplicate  bool   `json:"duplicate,omitempty"` // 同一命名空间下已有相同内容的文档
+	Error      string `json:"error,omitempty"`
+}
+
+// ImportSummary JSONL 导入结果：单行失败不影响其他行
+type ImportSummary struct {
+	Total      int                `json:"total"`      // 非空行数
+	Imported   int                `json:"imported"`   // 已直接写入的文档数（含使用导出向量的记录）
+	Queued     int                `json:"queued"`     // 已提交入库任务的文档数
+	Duplicates int                `json:"duplicates"` // 内容重复而跳过的文档数
+	Failed     int                `json:"failed"`
+	Results    []ImportLineResult `json:"results"`
+}
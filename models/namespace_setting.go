@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// 知识库无命中（或命中不足）时的兜底策略
+const (
+	FallbackGeneralAnswer = "general_answer"          // 退化为普通对话，回答前注明未找到相关知识
+	FallbackRefuse        = "refuse"                  // 不调用大模型，直接返回拒答话术
+	FallbackAskClarifying = "ask_clarifying_question" // 请大模型向用户提出澄清问题
+)
+
+// NamespaceSetting 命名空间级配置（回答策略与提示词模板绑定），字段为空时使用全局默认值
+type NamespaceSetting struct {
+	Namespace     string   `json:"namespace" gorm:"primaryKey;type:varchar(100)"`
+	MinScore      *float64 `json:"min_score"`                                  // 命中片段的最低向量相似度（余弦，0-1）
+	MinHits       *int     `json:"min_hits"`                                   // 达到最低得分的片段少于该数量时触发兜底策略
+	Fallback      string   `json:"fallback,omitempty" gorm:"type:varchar(50)"` // 兜底策略：general_answer / refuse / ask_clarifying_question
+	RefuseMessage string   `json:"refuse_message,omitempty" gorm:"type:text"`  // refuse 策略返回的话术
+
+	PromptTemplateID   *uint `json:"prompt_template_id"`   // 绑定的提示词模板，与实验二选一，均为空时使用内置默认模板
+	PromptExperimentID *uint `json:"prompt_experiment_id"` // 绑定的提示词 A/B 实验
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NamespaceSettingRequest 更新命名空间配置的请求体，整体替换已有配置
+type NamespaceSettingRequest struct {
+	// 最低得分，按片段与问题的向量余弦相似度（ScoredDoc.VectorScore，0-1）过滤，与检索模式和重排无关；
+	// keyword 检索模式没有向量相似度，只能为 0
+	MinScore      *float64 `json:"min_score"`
+	MinHits       *int     `json:"min_hits"`
+	Fallback      string   `json:"fallback"`
+	RefuseMessage string   `json:"refuse_message"`
+
+	PromptTemplateID   *uint `json:"prompt_template_id"` // 与 prompt_experiment_id 二选一
+	PromptExperimentID *uint `json:"prompt_experiment_id"`
+}
+
+// AnswerPolicy 合并全局默认值后生效的回答策略
+type AnswerPolicy struct {
+	Namespace     string  `json:"namespace"`
+	MinScore      float64 `json:"min_score"`
+	MinHits       int     `json:"min_hits"`
+	Fallback      string  `json:"fallback"`
+	RefuseMessage string  `json:"refuse_message"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// PromptTemplate RAG 提示词模板。模板记录不可修改，更新时以同名新版本保存，便于按模板 ID 对比回答效果
+type PromptTemplate struct {
+	ID                  uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name                string    `json:"name" gorm:"type:varchar(100);not null;uniqueIndex:idx_prompt_template_version"`
+	Version             int       `json:"version" gorm:"not null;uniqueIndex:idx_prompt_template_version"` // 同名模板的版本号，从 1 开始
+	Description         string    `json:"description,omitempty" gorm:"type:varchar(500)"`
+	SystemRole          string    `json:"system_role" gorm:"type:text;not null"`    // 系统角色描述
+	CitationInstruction string    `json:"citation_instruction" gorm:"type:text"`    // 引用要求，为空时不要求模型标注引用
+	KnowledgeIntro      string    `json:"knowledge_intro" gorm:"type:varchar(255)"` // 知识片段介绍语，%d 为引用编号，%s 为片段标题
+	QuestionPrefix      string    `json:"question_prefix" gorm:"type:varchar(255)"` // 问题前缀
+	JoinSeparator       string    `json:"join_separator" gorm:"type:varchar(50)"`   // 知识片段分隔符
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// PromptTemplateRequest 创建模板或发布新版本的请求体；knowledge_intro、question_prefix、join_separator 为空时使用内置默认值
+type PromptTemplateRequest struct {
+	Name                string `json:"name"` // 创建时必填；发布新版本时忽略，沿用原模板名称
+	Description         string `json:"description"`
+	SystemRole          string `json:"system_role" binding:"required"`
+	CitationInstruction string `json:"citation_instruction"`
+	KnowledgeIntro      string `json:"knowledge_intro"`
+	QuestionPrefix      string `json:"question_prefix"`
+	JoinSeparator       string `json:"join_separator"`
+}
+
+// PromptVariant 实验中的一个模板及其流量权重
+type PromptVariant struct {
+	TemplateID uint `json:"template_id"`
+	Weight     int  `json:"weight"`
+}
+
+// PromptExperiment 提示词 A/B 实验：按权重在多个模板之间分流，同一会话固定使用同一模板
+type PromptExperiment struct {
+	ID          uint           `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name        string         `json:"name" gorm:"type:varchar(100);not null"`
+	Description string         `json:"description,omitempty" gorm:"type:varchar(500)"`
+	Variants    PromptVariants `json:"variants" gorm:"type:text"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// PromptExperimentRequest 创建或更新实验的请求体
+type PromptExperimentRequest struct {
+	Name        string          `json:"name" binding:"required"`
+	Description string          `json:"description"`
+	Variants    []PromptVariant `json:"variants" binding:"required"`
+}
+
+// PromptSelection 一次回答实际使用的提示词模板，随回答返回并记录日志
+type PromptSelection struct {
+	TemplateID   uint   `json:"template_id"` // 0 表示内置默认模板
+	TemplateName string `json:"template_name"`
+	Version      int    `json:"version"`
+	ExperimentID uint   `json:"experiment_id,omitempty"` // 通过实验分流选中时为实验 ID
+}
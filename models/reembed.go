@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// 重建任务状态
+const (
+	ReembedStatusRunning     = "running"     // 执行中（进程崩溃后重启会自动续跑）
+	ReembedStatusInterrupted = "interrupted" // 被中断，可续跑
+	ReembedStatusCompleted   = "completed"   // 已完成
+	ReembedStatusFailed      = "failed"      // 失败，重新发起时从剩余的过期片段继续
+)
+
+// ReembedJob 向量重建任务：将 embedding_model 与当前模型不一致的知识片段分批重新向量化
+type ReembedJob struct {
+	ID          uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	Status      string     `json:"status" gorm:"type:varchar(20);not null;index"`
+	Namespace   string     `json:"namespace" gorm:"type:varchar(100)"`    // 为空表示全部命名空间
+	TargetModel string     `json:"target_model" gorm:"type:varchar(100)"` // 目标向量模型版本
+	BatchSize   int        `json:"batch_size"`
+	Total       int        `json:"total"`     // 任务创建时的过期片段数
+	Processed   int        `json:"processed"` // 已重建的片段数
+	Error       string     `json:"error,omitempty" gorm:"type:text"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// ReembedRequest 发起重建任务的请求体
+type ReembedRequest struct {
+	Namespace string `json:"namespace"`
+	BatchSize int    `json:"batch_size"`
+}
+
+// ReembedStatus 重建状态：当前向量模型、剩余过期片段数与最近一次任务
+type ReembedStatus struct {
+	ActiveModel string      `json:"active_model"`
+	StaleCount  int64       `json:"stale_count"`
+	Job         *ReembedJob `json:"job,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// SearchFilter 知识检索的元数据过滤条件，所有条件同时满足
+type SearchFilter struct {
+	Namespace      string     `json:"namespace" form:"namespace"`
+	Source         string     `json:"source" form:"source"`
+	TitlePrefix    string     `json:"title_prefix" form:"title_prefix"`
+	CreatedAfter   *time.Time `json:"created_after" form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`   // 含
+	CreatedBefore  *time.Time `json:"created_before" form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"` // 不含
+	EmbeddingModel string     `json:"embedding_model" form:"embedding_model"`
+	Tags           []string   `json:"tags" form:"tags"` // 须同时包含全部标签
+}
+
+// HasMetadata 是否包含命名空间与向量模型之外的条件
+func (f SearchFilter) HasMetadata() bool {
+	return f.Source != "" || f.TitlePrefix != "" || f.CreatedAfter != nil || f.CreatedBefore != nil || len(f.Tags) > 0
+}
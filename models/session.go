@@ -6,22 +6,35 @@ import (
 
 // Session 会话模型
 type Session struct {
-	ID        string     `json:"id" gorm:"primaryKey;type:varchar(255)"`
-	Name      string     `json:"name" gorm:"type:varchar(255);not null"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"index"`
+	ID             string     `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	Name           string     `json:"name" gorm:"type:varchar(255);not null"`
+	Summary        string     `json:"summary,omitempty" gorm:"type:text"` // 早期对话摘要，避免每次请求重新生成
+	SummaryUntilID uint       `json:"summary_until_id,omitempty"`         // 摘要覆盖到的最后一条消息 ID
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty" gorm:"index"`
 }
 
 // ChatMessage 聊天消息模型
 type ChatMessage struct {
-	ID        uint       `json:"id" gorm:"primaryKey;autoIncrement"`
-	SessionID string     `json:"session_id" gorm:"type:varchar(255);not null;index"`
-	Role      string     `json:"role" gorm:"type:varchar(50);not null"`
-	Content   string     `json:"content" gorm:"type:text;not null"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"index"`
+	ID                 uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	SessionID          string     `json:"session_id" gorm:"type:varchar(255);not null;index"`
+	Role               string     `json:"role" gorm:"type:varchar(50);not null"`
+	Content            string     `json:"content" gorm:"type:text;not null"`
+	Incomplete         bool       `json:"incomplete" gorm:"default:false"` // 流式回复被中断，内容不完整
+	Model              string     `json:"model,omitempty" gorm:"type:varchar(100)"`
+	PromptTokens       int        `json:"prompt_tokens,omitempty"` // token 用量，仅 assistant 消息记录
+	CompletionTokens   int        `json:"completion_tokens,omitempty"`
+	TotalTokens        int        `json:"total_tokens,omitempty"`
+	RewrittenQuery     string     `json:"rewritten_query,omitempty" gorm:"type:text"`        // RAG 追问改写后的独立问题，仅 user 消息记录
+	SourceIDs          StringList `json:"source_ids,omitempty" gorm:"type:text"`             // RAG 回答检索到的知识片段 ID，按提示词中的引用编号排列
+	Sources            []Citation `json:"sources,omitempty" gorm:"-"`                        // 查询消息时按 SourceIDs 补全的片段信息（已删除的片段不返回）
+	PromptTemplateID   uint       `json:"prompt_template_id,omitempty"`                      // RAG 回答使用的提示词模板，0 为内置默认模板
+	PromptExperimentID uint       `json:"prompt_experiment_id,omitempty"`                    // 通过 A/B 实验选中模板时的实验 ID
+	FallbackPolicy     string     `json:"fallback_policy,omitempty" gorm:"type:varchar(50)"` // RAG 命中不足时触发的兜底策略，仅兜底回答记录
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+	DeletedAt          *time.Time `json:"deleted_at,omitempty" gorm:"index"`
 }
 
 // SessionWithMessageCount 包含消息数量的会话信息
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// UsageRecord 单次大模型调用的用量记录，用于按会话/角色/模型/日期汇总
+type UsageRecord struct {
+	ID               uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	SessionID        string    `json:"session_id" gorm:"type:varchar(255);index"`
+	Endpoint         string    `json:"endpoint" gorm:"type:varchar(50)"` // 调用来源：chat / rag 等
+	Role             string    `json:"role" gorm:"type:varchar(50);index"`
+	Model            string    `json:"model" gorm:"type:varchar(100);index"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	Cost             float64   `json:"cost"`
+	Day              string    `json:"day" gorm:"type:varchar(10);index"` // 2006-01-02
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// ModelPrice 模型单价（每 1000 token）
+type ModelPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// UsageSummary 用量汇总行
+type UsageSummary struct {
+	Key              string  `json:"key"`
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// UsageReport 用量报表
+type UsageReport struct {
+	Currency  string         `json:"currency"`
+	Total     UsageSummary   `json:"total"`
+	BySession []UsageSummary `json:"by_session"`
+	ByRole    []UsageSummary `json:"by_role"`
+	ByModel   []UsageSummary `json:"by_model"`
+	ByDay     []UsageSummary `json:"by_day"`
+}
+
+// UsageQuery 用量报表查询条件
+type UsageQuery struct {
+	SessionID string `form:"session_id"`
+	From      string `form:"from"` // 起始日期（含），2006-01-02
+	To        string `form:"to"`   // 结束日期（含），2006-01-02
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"AiDemo/config"
+	"AiDemo/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyKeyHeader 幂等键请求头
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLen 幂等键最大长度
+const maxIdempotencyKeyLen = 255
+
+// Idempotency 请求携带 Idempotency-Key 时保证整个请求只执行一次：
+// 重复请求回放首次的状态码与响应体（响应头 Idempotent-Replayed: true），
+// 同一键用于不同请求返回 422，首次请求尚未结束返回 409。未携带时不做处理
+func Idempotency() gin.HandlerFunc {
+	svc := services.NewIdempotencyService()
+
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(IdempotencyKeyHeader))
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误: Idempotency-Key 过长",
+			})
+			return
+		}
+
+		// 计算指纹需要读完请求体，先限制大小，避免在处理器的限制生效前把任意大的请求体读入内存
+		if limit := int64(config.UploadMaxRequestMB) << 20; limit > 0 {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+		hash, err := requestFingerprint(c.Request)
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+					"error": fmt.Sprintf("请求体过大: 超过 %d MB", config.UploadMaxRequestMB),
+				})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误: " + err.Error(),
+			})
+			return
+		}
+
+		record, err := svc.Begin(key, hash)
+		switch {
+		case errors.Is(err, services.ErrIdempotencyKeyReused):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, services.ErrIdempotencyInProgress):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "幂等键校验失败: " + err.Error()})
+			return
+		case record != nil:
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.StatusCode, record.ContentType, []byte(record.Response))
+			c.Abort()
+			return
+		}
+
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		defer func() {
+			// 处理中 panic 时释放幂等键，由外层 Recovery 返回 500
+			if r := recover(); r != nil {
+				svc.Complete(key, http.StatusInternalServerError, "", nil)
+				panic(r)
+			}
+		}()
+
+		c.Next()
+		svc.Complete(key, w.Status(), w.Header().Get("Content-Type"), w.body.Bytes())
+	}
+}
+
+// requestFingerprint 方法、路径与请求体的 SHA-256，读取后恢复请求体。
+// multipart 请求体中的分隔符每次随机生成，跳过分隔符逐段计算，不另行复制请求体
+func requestFingerprint(r *http.Request) (string, error) {
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(r.Body); err != nil {
+		return "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body.Bytes()))
+
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	data := body.Bytes()
+	if mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil &&
+		strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		boundary := []byte(params["boundary"])
+		for {
+			i := bytes.Index(data, boundary)
+			if i < 0 {
+				break
+			}
+			h.Write(data[:i])
+			data = data[i+len(boundary):]
+		}
+	}
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// recordingWriter 在写出响应的同时保留响应体
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
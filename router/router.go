@@ -3,6 +3,7 @@ package router
 import (
 	"net/http"
 
+	"AiDemo/config"
 	"AiDemo/handlers"
 	"AiDemo/router/middleware"
 	"AiDemo/utils"
@@ -14,6 +15,9 @@ func Register(r *gin.Engine) {
 	// 简单限流（可按需调整或关闭）
 	r.Use(middleware.RateLimiter(120)) // 每 IP 每分钟 120 次
 
+	// 请求全局截止时间，超时后上游调用随 context 一并取消
+	r.Use(middleware.Timeout(config.RequestTimeout))
+
 	// 静态资源
 	r.Static("/web", "./web")
 	utils.Info("静态文件路由已配置")
@@ -23,6 +27,9 @@ func Register(r *gin.Engine) {
 		c.Redirect(http.StatusFound, "/web/index.html")
 	})
 
+	// 健康检查（含大模型熔断器状态）
+	r.GET("/health", handlers.HealthHandler)
+
 	// 聊天接口
 	r.POST("/chat", handlers.ChatHandler)
 	utils.Info("聊天 API 已注册")
@@ -31,12 +38,46 @@ func Register(r *gin.Engine) {
 	r.POST("/rag/chat", handlers.RAGChatHandler)
 	utils.Info("RAG 聊天 API 已注册")
 
-	// 知识入库接口（关键：RAG 从 Demo 到产品的核心接口）
-	r.POST("/rag/knowledge", handlers.CreateKnowledgeHandler)
+	// 知识入库接口（关键：RAG 从 Demo 到产品的核心接口），异步执行，返回入库任务
+	// 入库类接口支持 Idempotency-Key 请求头，重复请求回放首次响应
+	idempotency := middleware.Idempotency()
+	r.POST("/rag/knowledge", idempotency, handlers.CreateKnowledgeHandler)
 	utils.Info("知识入库 API 已注册")
 
+	// 文件入库接口（Markdown / HTML / 纯文本 / PDF / DOCX）
+	r.POST("/rag/knowledge/upload", idempotency, handlers.UploadKnowledgeHandler)
+	utils.Info("文件入库 API 已注册")
+
+	// 知识库管理：按文档列表、查看、替换（异步重新切分与向量化）、删除与 JSONL 导入导出
+	documentHandler := handlers.NewDocumentHandler()
+	knowledgeIOHandler := handlers.NewKnowledgeIOHandler()
+	knowledge := r.Group("/rag/knowledge")
+	{
+		knowledge.GET("", documentHandler.ListDocuments)
+		// 导入请求体可能很大且需流式读取，不经过幂等中间件（幂等键需要缓存整个请求体计算指纹）
+		knowledge.POST("/import", knowledgeIOHandler.ImportKnowledge)
+		knowledge.GET("/export", knowledgeIOHandler.ExportKnowledge)
+		knowledge.GET("/:id", documentHandler.GetDocument)
+		knowledge.PUT("/:id", idempotency, documentHandler.ReplaceDocument)
+		knowledge.DELETE("/:id", documentHandler.DeleteDocument)
+	}
+	utils.Info("知识库管理 API 已注册")
+
+	// 异步入库任务进度查询
+	ingestHandler := handlers.NewIngestHandler()
+	r.GET("/rag/jobs/:id", ingestHandler.GetJob)
+	utils.Info("入库任务 API 已注册")
+
+	// 知识检索接口（按元数据过滤，只返回片段，不生成回答）
+	r.POST("/rag/knowledge/search", handlers.SearchKnowledgeHandler)
+	utils.Info("知识检索 API 已注册")
+
 	// 会话管理
 	sessionHandler := handlers.NewSessionHandler()
+	usageHandler := handlers.NewUsageHandler()
+	reembedHandler := handlers.NewReembedHandler()
+	namespaceSettingHandler := handlers.NewNamespaceSettingHandler()
+	promptTemplateHandler := handlers.NewPromptTemplateHandler()
 
 	api := r.Group("/api")
 	{
@@ -49,7 +90,40 @@ func Register(r *gin.Engine) {
 			sessions.DELETE("/:id", sessionHandler.DeleteSession)
 			sessions.GET("/:id/messages", sessionHandler.GetSessionMessages)
 		}
+
+		// 用量报表
+		api.GET("/usage", usageHandler.GetUsageReport)
+
+		// 管理接口：向量重建
+		admin := api.Group("/admin")
+		{
+			admin.POST("/reembed", reembedHandler.StartReembed)
+			admin.GET("/reembed", reembedHandler.GetReembedStatus)
+			admin.GET("/reembed/:id", reembedHandler.GetReembedJob)
+
+			// 命名空间配置：回答策略（最低得分、最少命中数与兜底策略）与提示词模板绑定
+			admin.GET("/namespaces", namespaceSettingHandler.ListSettings)
+			admin.GET("/namespaces/:namespace", namespaceSettingHandler.GetSetting)
+			admin.PUT("/namespaces/:namespace", namespaceSettingHandler.PutSetting)
+			admin.DELETE("/namespaces/:namespace", namespaceSettingHandler.DeleteSetting)
+
+			// 提示词模板：版本化管理，PUT 发布新版本
+			admin.GET("/prompt-templates", promptTemplateHandler.ListTemplates)
+			admin.POST("/prompt-templates", promptTemplateHandler.CreateTemplate)
+			admin.GET("/prompt-templates/:id", promptTemplateHandler.GetTemplate)
+			admin.PUT("/prompt-templates/:id", promptTemplateHandler.PublishVersion)
+			admin.DELETE("/prompt-templates/:id", promptTemplateHandler.DeleteTemplate)
+
+			// 提示词 A/B 实验：按权重在多个模板间分流
+			admin.GET("/prompt-experiments", promptTemplateHandler.ListExperiments)
+			admin.POST("/prompt-experiments", promptTemplateHandler.CreateExperiment)
+			admin.GET("/prompt-experiments/:id", promptTemplateHandler.GetExperiment)
+			admin.PUT("/prompt-experiments/:id", promptTemplateHandler.UpdateExperiment)
+			admin.DELETE("/prompt-experiments/:id", promptTemplateHandler.DeleteExperiment)
+		}
 	}
 
 	utils.Info("会话管理 API 已注册")
+	utils.Info("用量统计 API 已注册")
+	utils.Info("管理 API 已注册")
 }
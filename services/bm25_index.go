@@ -0,0 +1,255 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"AiDemo/utils"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// BM25 参数
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// bm25Doc 索引中的文档
+type bm25Doc struct {
+	namespace string
+	length    int
+	terms     map[string]int
+}
+
+// BM25Index 进程内 BM25 关键词索引：中文按相邻二元组切分，英文与数字按整词切分，
+// 由连字符、下划线或点连接的编码（如 SKU-1024、E_CONN_01）额外作为整体词项，便于精确匹配
+type BM25Index struct {
+	mu       sync.RWMutex
+	docs     map[string]*bm25Doc
+	postings map[string]map[string]int // 词项 -> 文档 ID -> 词频
+	totalLen int
+}
+
+// BM25Hit 关键词检索命中
+type BM25Hit struct {
+	ID    string
+	Score float64
+}
+
+// NewBM25Index 创建空索引
+func NewBM25Index() *BM25Index {
+	return &BM25Index{
+		docs:     map[string]*bm25Doc{},
+		postings: map[string]map[string]int{},
+	}
+}
+
+// Len 文档数
+func (x *BM25Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.docs)
+}
+
+// Add 写入或替换文档
+func (x *BM25Index) Add(id, namespace, text string) {
+	terms := map[string]int{}
+	length := 0
+	for _, t := range TokenizeKeywords(text) {
+		terms[t]++
+		length++
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+	x.docs[id] = &bm25Doc{namespace: namespace, length: length, terms: terms}
+	x.totalLen += length
+	for t, tf := range terms {
+		posting := x.postings[t]
+		if posting == nil {
+			posting = map[string]int{}
+			x.postings[t] = posting
+		}
+		posting[id] = tf
+	}
+}
+
+// Remove 删除文档
+func (x *BM25Index) Remove(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+}
+
+// Search 按 BM25 得分返回前 k 个文档，namespace 为空时不过滤命名空间，allowed 非 nil 时只返回其中的文档
+func (x *BM25Index) Search(query, namespace string, allowed map[string]struct{}, k int) []BM25Hit {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if len(x.docs) == 0 || k <= 0 {
+		return nil
+	}
+	n := float64(len(x.docs))
+	avgLen := float64(x.totalLen) / n
+
+	queryTerms := map[string]struct{}{}
+	for _, t := range TokenizeKeywords(query) {
+		queryTerms[t] = struct{}{}
+	}
+
+	scores := map[string]float64{}
+	for t := range queryTerms {
+		posting := x.postings[t]
+		if len(posting) == 0 {
+			continue
+		}
+		df := float64(len(posting))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range posting {
+			doc := x.docs[id]
+			if namespace != "" && doc.namespace != namespace {
+				continue
+			}
+			if allowed != nil {
+				if _, ok := allowed[id]; !ok {
+					continue
+				}
+			}
+			f := float64(tf)
+			norm := f + bm25K1*(1-bm25B+bm25B*float64(doc.length)/avgLen)
+			scores[id] += idf * f * (bm25K1 + 1) / norm
+		}
+	}
+
+	hits := make([]BM25Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, BM25Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits
+}
+
+// remove 删除文档，调用方需持有写锁
+func (x *BM25Index) remove(id string) {
+	doc, ok := x.docs[id]
+	if !ok {
+		return
+	}
+	for t := range doc.terms {
+		posting := x.postings[t]
+		delete(posting, id)
+		if len(posting) == 0 {
+			delete(x.postings, t)
+		}
+	}
+	x.totalLen -= doc.length
+	delete(x.docs, id)
+}
+
+// TokenizeKeywords 关键词切分：中文连续片段输出相邻二元组（单字片段输出单字），
+// 字母数字按整词小写输出，由 - _ . 连接的编码再额外输出整体
+func TokenizeKeywords(text string) []string {
+	var tokens []string
+	var cjk, word []rune
+	var compound strings.Builder
+	compoundParts := 0
+
+	flushCJK := func() {
+		switch {
+		case len(cjk) == 1:
+			tokens = append(tokens, string(cjk))
+		case len(cjk) > 1:
+			for i := 0; i+1 < len(cjk); i++ {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	flushCompound := func() {
+		if compoundParts > 1 {
+			tokens = append(tokens, strings.Trim(compound.String(), "-_."))
+		}
+		compound.Reset()
+		compoundParts = 0
+	}
+
+	runes := []rune(normalizeText(text))
+	for i, r := range runes {
+		switch {
+		case isCJKLetter(r):
+			flushWord()
+			flushCompound()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			if len(word) == 0 {
+				compoundParts++
+			}
+			word = append(word, r)
+			compound.WriteRune(r)
+		case (r == '-' || r == '_' || r == '.') && len(word) > 0 &&
+			i+1 < len(runes) && (unicode.IsLetter(runes[i+1]) || unicode.IsDigit(runes[i+1])) && !isCJKLetter(runes[i+1]):
+			// 编码内部的连接符：结束当前词，但保留在整体词项中
+			flushWord()
+			compound.WriteRune(r)
+		default:
+			flushCJK()
+			flushWord()
+			flushCompound()
+		}
+	}
+	flushCJK()
+	flushWord()
+	flushCompound()
+	return tokens
+}
+
+var defaultKeywordIndex = NewBM25Index()
+
+// InitKeywordIndex 从数据库构建关键词索引，需在数据库初始化之后调用
+func InitKeywordIndex() error {
+	start := time.Now()
+	index := NewBM25Index()
+
+	var batch []models.Knowledge
+	err := config.DB.Select("id", "title", "heading_path", "content", "namespace").
+		FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			for _, k := range batch {
+				index.Add(k.ID, k.Namespace, keywordText(k))
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	defaultKeywordIndex = index
+	utils.Info("关键词索引已就绪: %d 个片段, 耗时 %s", index.Len(), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// keywordText 参与关键词检索的文本：标题、标题路径与正文
+func keywordText(k models.Knowledge) string {
+	return k.Title + "\n" + embeddingText(k.HeadingPath, k.Content)
+}
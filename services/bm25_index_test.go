@@ -0,0 +1,92 @@
+package services
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestTokenizeKeywords(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"中文二元组", "退货政策", []string{"退货", "货政", "政策"}},
+		{"单字片段", "好", []string{"好"}},
+		{"中文标点分隔", "你好，世界", []string{"你好", "世界"}},
+		{"中英混排", "Go语言", []string{"go", "语言"}},
+		{"连字符编码", "SKU-1024 缺货", []string{"sku", "1024", "sku-1024", "缺货"}},
+		{"下划线编码", "E_CONN_01", []string{"e", "conn", "01", "e_conn_01"}},
+		{"句末的点不并入编码", "版本 v1.2.", []string{"版本", "v1", "2", "v1.2"}},
+		{"结尾连接符不构成编码", "a- b_", []string{"a", "b"}},
+		{"全角字符归一化", "ＡＢＣ１２", []string{"abc12"}},
+		{"空文本", " ，。", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TokenizeKeywords(tt.text)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("TokenizeKeywords(%q) = %q，期望 %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBM25IndexSearch(t *testing.T) {
+	index := NewBM25Index()
+	index.Add("a", "shop", "SKU-1024 退货政策")
+	index.Add("b", "shop", "SKU-2048 退货说明")
+	index.Add("c", "faq", "物流时效说明")
+	index.Add("d", "faq", "物流说明，以及很长很长很长很长很长很长的补充内容")
+
+	ids := func(hits []BM25Hit) string {
+		var s []string
+		for _, h := range hits {
+			s = append(s, h.ID)
+		}
+		return strings.Join(s, ",")
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		namespace string
+		allowed   map[string]struct{}
+		k         int
+		want      string
+	}{
+		{name: "编码精确匹配排在最前", query: "SKU-1024", k: 10, want: "a,b"},
+		{name: "按命名空间过滤", query: "说明", namespace: "faq", k: 10, want: "c,d"},
+		{name: "限定候选 ID", query: "退货", allowed: map[string]struct{}{"b": {}}, k: 10, want: "b"},
+		{name: "截取前 k 个", query: "说明", k: 1, want: "c"},
+		{name: "未命中任何词项", query: "发票", k: 10, want: ""},
+		{name: "k 为 0", query: "退货", k: 0, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits := index.Search(tt.query, tt.namespace, tt.allowed, tt.k)
+			if got := ids(hits); got != tt.want {
+				t.Errorf("Search(%q) = %s，期望 %s", tt.query, got, tt.want)
+			}
+			for _, h := range hits {
+				if h.Score <= 0 || math.IsNaN(h.Score) {
+					t.Errorf("%s 的得分异常: %v", h.ID, h.Score)
+				}
+			}
+		})
+	}
+
+	index.Add("b", "shop", "完全不同的内容")
+	if got := ids(index.Search("退货", "", nil, 10)); got != "a" {
+		t.Errorf("替换文档后 Search(退货) = %s，期望 a", got)
+	}
+	index.Remove("a")
+	index.Remove("missing")
+	if got := ids(index.Search("退货", "", nil, 10)); got != "" {
+		t.Errorf("删除文档后 Search(退货) = %s，期望为空", got)
+	}
+	if index.Len() != 3 {
+		t.Errorf("Len = %d，期望 3", index.Len())
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"AiDemo/utils"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ChatProvider 大模型对话服务抽象，便于在豆包 / OpenAI 兼容接口 / Ollama 之间切换
+type ChatProvider interface {
+	// Name 服务提供方名称
+	Name() string
+	// Model 当前使用的模型 ID
+	Model() string
+	// Chat 发送完整对话并返回模型回复，ctx 取消或超时时立即中止
+	Chat(ctx context.Context, messages []models.Message) (ChatResult, error)
+	// ChatStream 以流式方式获取回复，每收到一段增量调用一次 onDelta；
+	// onDelta 返回错误时中止读取。返回值中的内容为已拼接的内容（中止时为部分内容）
+	ChatStream(ctx context.Context, messages []models.Message, onDelta StreamDeltaFunc) (ChatResult, error)
+}
+
+// ChatResult 一次对话调用的结果
+type ChatResult struct {
+	Content string
+	Model   string       // 实际响应的模型，上游未返回时为配置的模型 ID
+	Usage   models.Usage // token 用量，上游未返回时为零值
+}
+
+// StreamDeltaFunc 流式增量回调
+type StreamDeltaFunc func(delta string) error
+
+var defaultChatProvider ChatProvider
+
+// NewChatProvider 根据提供方名称创建对话服务
+func NewChatProvider(provider, baseURL, model, apiKey string) (ChatProvider, error) {
+	switch strings.ToLower(provider) {
+	case "", "doubao":
+		return NewDoubaoProvider(baseURL, model, apiKey), nil
+	case "openai":
+		return NewOpenAIProvider(baseURL, model, apiKey), nil
+	case "ollama":
+		return NewOllamaProvider(baseURL, model), nil
+	default:
+		return nil, fmt.Errorf("不支持的大模型服务提供方: %s", provider)
+	}
+}
+
+// InitChatProvider 按配置初始化默认对话服务，并包装重试与熔断
+func InitChatProvider() error {
+	p, err := NewChatProvider(config.LLMProvider, config.LLMBaseURL, config.LLMModel, config.APIKey)
+	if err != nil {
+		return err
+	}
+
+	retry := RetryPolicy{
+		MaxRetries: config.LLMMaxRetries,
+		BaseDelay:  config.LLMRetryBaseDelay,
+		MaxDelay:   config.LLMRetryMaxDelay,
+	}
+	breaker := NewCircuitBreaker(p.Name(), config.LLMBreakerThreshold, config.LLMBreakerCooldown)
+	SetChatProvider(NewResilientProvider(p, retry, breaker))
+
+	utils.Info("大模型服务已初始化: provider=%s, model=%s, 最大重试=%d, 熔断阈值=%d",
+		p.Name(), p.Model(), retry.MaxRetries, config.LLMBreakerThreshold)
+	return nil
+}
+
+// SetChatProvider 替换默认对话服务（测试时可注入本地替身）
+func SetChatProvider(p ChatProvider) {
+	defaultChatProvider = p
+}
+
+// GetChatProvider 获取默认对话服务
+func GetChatProvider() ChatProvider {
+	return defaultChatProvider
+}
+
+// GetChatProviderStats 返回默认对话服务的熔断器状态，未启用熔断时返回 nil
+func GetChatProviderStats() *CircuitStats {
+	rp, ok := defaultChatProvider.(*ResilientProvider)
+	if !ok {
+		return nil
+	}
+	stats := rp.Breaker().Stats()
+	return &stats
+}
+
+// newJSONRequest 构造带鉴权头的 JSON POST 请求
+func newJSONRequest(ctx context.Context, url, apiKey string, body interface{}) (*http.Request, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		utils.Error("请求体序列化失败: %v", err)
+		return nil, err
+	}
+
+	utils.Debug("API请求体: %s", string(jsonData))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		utils.Error("创建HTTP请求失败: %v", err)
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	return req, nil
+}
+
+// postJSON 发送 JSON 请求并返回响应体
+func postJSON(ctx context.Context, client *http.Client, url, apiKey string, body interface{}) ([]byte, int, error) {
+	req, err := newJSONRequest(ctx, url, apiKey, body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	utils.Info("发送API请求: %s", url)
+	resp, err := client.Do(req)
+	if err != nil {
+		utils.Error("HTTP请求失败: %v", err)
+		return nil, 0, wrapContextError(ctx, err)
+	}
+	defer closeBody(resp.Body)
+
+	utils.Info("API响应状态码: %d", resp.StatusCode)
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		utils.Error("读取响应体失败: %v", err)
+		return nil, resp.StatusCode, wrapContextError(ctx, err)
+	}
+
+	utils.Debug("API原始响应: %s", string(respBody))
+
+	if resp.StatusCode != http.StatusOK {
+		upErr := parseUpstreamError(resp, respBody)
+		utils.Error("API返回错误: %v", upErr)
+		return nil, resp.StatusCode, upErr
+	}
+
+	return respBody, resp.StatusCode, nil
+}
+
+// openStream 发送流式请求，状态码正常时返回未读取的响应，由调用方负责关闭
+func openStream(ctx context.Context, client *http.Client, url, apiKey string, body interface{}) (*http.Response, error) {
+	req, err := newJSONRequest(ctx, url, apiKey, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	utils.Info("发送流式API请求: %s", url)
+	resp, err := client.Do(req)
+	if err != nil {
+		utils.Error("HTTP请求失败: %v", err)
+		return nil, wrapContextError(ctx, err)
+	}
+
+	utils.Info("API响应状态码: %d", resp.StatusCode)
+
+	if resp.StatusCode != http.StatusOK {
+		defer closeBody(resp.Body)
+		respBody, _ := io.ReadAll(resp.Body)
+		upErr := parseUpstreamError(resp, respBody)
+		utils.Error("API返回错误: %v", upErr)
+		return nil, upErr
+	}
+	return resp, nil
+}
+
+// newLineScanner 创建按行读取流式响应的扫描器，放宽单行长度限制
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return scanner
+}
+
+func closeBody(body io.ReadCloser) {
+	if err := body.Close(); err != nil {
+		utils.Warning("关闭响应体失败: %v", err)
+	}
+}
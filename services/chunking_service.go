@@ -1,61 +1,318 @@
 package services
 
+import (
+	"AiDemo/config"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 切分策略
 const (
-	// DefaultChunkSize 默认文档切分大小（字符数）
-	DefaultChunkSize = 500
+	ChunkStrategyRecursive = "recursive" // 按标题、段落、行、句子递归切分
+	ChunkStrategyFixed     = "fixed"     // 按 token 数定长切分，不考虑文本结构
 )
 
-// ChunkText 文档切分，每 chunkSize 字一段
-func ChunkText(text string, chunkSize int) []string {
-	if chunkSize <= 0 {
-		chunkSize = DefaultChunkSize
+// ErrInvalidChunkOptions 切分参数不合法
+var ErrInvalidChunkOptions = errors.New("切分参数错误")
+
+// Chunk 切分出的片段
+type Chunk struct {
+	Content     string
+	HeadingPath string // 片段所在的标题路径，如 "安装 > Linux"，无标题时为空
+}
+
+// Chunker 文档切分器
+type Chunker interface {
+	Name() string
+	Chunk(text string) []Chunk
+}
+
+// ChunkOptions 切分参数，零值字段使用配置的默认值
+type ChunkOptions struct {
+	Strategy string // recursive / fixed
+	Size     int    // 每个片段的 token 上限
+	Overlap  *int   // 相邻片段重叠的 token 数，nil 时使用配置值
+}
+
+// NewChunker 根据参数创建切分器
+func NewChunker(opts ChunkOptions) (Chunker, error) {
+	strategy := strings.ToLower(strings.TrimSpace(opts.Strategy))
+	if strategy == "" {
+		strategy = config.ChunkStrategy
+	}
+	size := opts.Size
+	if size <= 0 {
+		size = config.ChunkSize
+	}
+	overlap := config.ChunkOverlap
+	if opts.Overlap != nil {
+		overlap = *opts.Overlap
+	}
+	if overlap < 0 || overlap >= size {
+		return nil, fmt.Errorf("%w: chunk_overlap 必须不小于 0 且小于 chunk_size（%d）", ErrInvalidChunkOptions, size)
+	}
+
+	switch strategy {
+	case ChunkStrategyRecursive:
+		return &RecursiveChunker{Size: size, Overlap: overlap}, nil
+	case ChunkStrategyFixed:
+		return &FixedChunker{Size: size, Overlap: overlap}, nil
+	default:
+		return nil, fmt.Errorf("%w: 不支持的切分策略 %s（可选 recursive / fixed）", ErrInvalidChunkOptions, strategy)
+	}
+}
+
+// RecursiveChunker 结构感知切分：先按 Markdown 标题划分章节并记录标题路径，
+// 章节超过 Size 时依次按空行（段落）、换行、句末标点递归拆分，单句仍超长时按 token 数硬切；
+// 拆出的小块再贪心合并到 Size 以内，新片段开头带上前一片段末尾不超过 Overlap 的完整句子
+type RecursiveChunker struct {
+	Size    int
+	Overlap int
+}
+
+// Name 策略名称
+func (c *RecursiveChunker) Name() string {
+	return ChunkStrategyRecursive
+}
+
+// Chunk 切分文本
+func (c *RecursiveChunker) Chunk(text string) []Chunk {
+	var chunks []Chunk
+	for _, sec := range splitSections(text) {
+		for _, content := range c.merge(c.split(sec.body, 0)) {
+			chunks = append(chunks, Chunk{Content: content, HeadingPath: sec.path})
+		}
+	}
+	if len(chunks) == 0 && strings.TrimSpace(text) != "" {
+		chunks = append(chunks, Chunk{Content: strings.TrimSpace(text)})
 	}
+	return chunks
+}
 
-	if len(text) <= chunkSize {
+// textSplitters 递归切分的各级分隔方式，由粗到细；各片段保留自身的分隔符，拼接即可还原原文
+var textSplitters = []func(string) []string{
+	splitParagraphs,
+	splitLines,
+	splitSentences,
+}
+
+// split 将超过 Size 的文本逐级拆分
+func (c *RecursiveChunker) split(text string, level int) []string {
+	if EstimateTokens(text) <= c.Size {
 		return []string{text}
 	}
+	if level >= len(textSplitters) {
+		return splitTokenWindows(text, c.Size, 0)
+	}
+	parts := textSplitters[level](text)
+	if len(parts) <= 1 {
+		return c.split(text, level+1)
+	}
+	var out []string
+	for _, p := range parts {
+		out = append(out, c.split(p, level+1)...)
+	}
+	return out
+}
 
+// merge 将小块贪心合并为不超过 Size 的片段
+func (c *RecursiveChunker) merge(pieces []string) []string {
 	var chunks []string
-	runes := []rune(text)
+	var cur []string
+	curTokens := 0
+	flush := func() {
+		if content := strings.TrimSpace(strings.Join(cur, "")); content != "" {
+			chunks = append(chunks, content)
+		}
+	}
 
-	for i := 0; i < len(runes); i += chunkSize {
-		end := i + chunkSize
-		if end > len(runes) {
-			end = len(runes)
+	for _, p := range pieces {
+		t := EstimateTokens(p)
+		if len(cur) > 0 && curTokens+t > c.Size {
+			flush()
+			cur = overlapTail(cur, c.Overlap)
+			curTokens = EstimateTokens(strings.Join(cur, ""))
+			for len(cur) > 0 && curTokens+t > c.Size {
+				cur = cur[1:]
+				curTokens = EstimateTokens(strings.Join(cur, ""))
+			}
 		}
-		chunks = append(chunks, string(runes[i:end]))
+		cur = append(cur, p)
+		curTokens += t
 	}
+	flush()
+	return chunks
+}
 
+// overlapTail 取片段末尾不超过 overlap 个 token 的完整句子，作为下一片段的开头
+func overlapTail(pieces []string, overlap int) []string {
+	if overlap <= 0 {
+		return nil
+	}
+	var sentences []string
+	for _, p := range pieces {
+		sentences = append(sentences, splitSentences(p)...)
+	}
+	total := 0
+	start := len(sentences)
+	for start > 0 {
+		t := EstimateTokens(sentences[start-1])
+		if total+t > overlap {
+			break
+		}
+		total += t
+		start--
+	}
+	tail := sentences[start:]
+	// 重叠部分不以空白开头
+	for len(tail) > 0 && strings.TrimSpace(tail[0]) == "" {
+		tail = tail[1:]
+	}
+	return append([]string(nil), tail...)
+}
+
+// FixedChunker 定长切分：每 Size 个 token 一段，相邻片段重叠 Overlap 个 token
+type FixedChunker struct {
+	Size    int
+	Overlap int
+}
+
+// Name 策略名称
+func (c *FixedChunker) Name() string {
+	return ChunkStrategyFixed
+}
+
+// Chunk 切分文本
+func (c *FixedChunker) Chunk(text string) []Chunk {
+	var chunks []Chunk
+	for _, w := range splitTokenWindows(strings.TrimSpace(text), c.Size, c.Overlap) {
+		if w = strings.TrimSpace(w); w != "" {
+			chunks = append(chunks, Chunk{Content: w})
+		}
+	}
 	return chunks
 }
 
-// ChunkTextWithOverlap 带重叠的文档切分
-func ChunkTextWithOverlap(text string, chunkSize, overlapSize int) []string {
-	if chunkSize <= 0 {
-		chunkSize = DefaultChunkSize
+// section Markdown 章节
+type section struct {
+	path string
+	body string
+}
+
+var (
+	headingLine = regexp.MustCompile(`^(#{1,6})[ \t]+(.+?)[ \t#]*$`)
+	fenceLine   = regexp.MustCompile("^\\s*(```|~~~)")
+)
+
+// splitSections 按 Markdown ATX 标题（# ~ ######）划分章节，代码块内的 # 不视为标题
+func splitSections(text string) []section {
+	type heading struct {
+		level int
+		title string
 	}
-	if overlapSize <= 0 {
-		overlapSize = 50
+	var sections []section
+	var stack []heading
+	var body strings.Builder
+	inFence := false
+
+	flush := func() {
+		if strings.TrimSpace(body.String()) != "" {
+			titles := make([]string, len(stack))
+			for i, h := range stack {
+				titles[i] = h.title
+			}
+			sections = append(sections, section{path: strings.Join(titles, " > "), body: body.String()})
+		}
+		body.Reset()
 	}
 
-	if len(text) <= chunkSize {
-		return []string{text}
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimRight(line, "\r\n")
+		if fenceLine.MatchString(trimmed) {
+			inFence = !inFence
+		}
+		if m := headingLine.FindStringSubmatch(trimmed); m != nil && !inFence {
+			flush()
+			level := len(m[1])
+			for len(stack) > 0 && stack[len(stack)-1].level >= level {
+				stack = stack[:len(stack)-1]
+			}
+			stack = append(stack, heading{level: level, title: strings.TrimSpace(m[2])})
+			continue
+		}
+		body.WriteString(line)
 	}
+	flush()
+	return sections
+}
 
-	var chunks []string
+var paragraphBreak = regexp.MustCompile(`\n[ \t]*\n\s*`)
+
+// splitParagraphs 按空行切分，分隔空行保留在前一段末尾
+func splitParagraphs(text string) []string {
+	return splitAfterMatches(text, paragraphBreak.FindAllStringIndex(text, -1))
+}
+
+// splitLines 按换行切分
+func splitLines(text string) []string {
+	return strings.SplitAfter(text, "\n")
+}
+
+// sentenceEnd 句末位置：中文句末标点（及其后的引号、括号）随即断句；
+// 英文 . ! ? 需后接空白，避免拆开小数、版本号与编码
+var sentenceEnd = regexp.MustCompile(`[。！？；…]+[”’」』）)]*|[.!?;]+["')\]]*(\s+|$)`)
+
+// splitSentences 按句末标点切分，标点保留在句子末尾
+func splitSentences(text string) []string {
+	return splitAfterMatches(text, sentenceEnd.FindAllStringIndex(text, -1))
+}
+
+// splitAfterMatches 在每个匹配的结束位置切开文本
+func splitAfterMatches(text string, matches [][]int) []string {
+	var parts []string
+	start := 0
+	for _, m := range matches {
+		if m[1] > start {
+			parts = append(parts, text[start:m[1]])
+			start = m[1]
+		}
+	}
+	if start < len(text) {
+		parts = append(parts, text[start:])
+	}
+	return parts
+}
+
+// splitTokenWindows 按估算的 token 数定长切分，相邻窗口重叠 overlap 个 token
+func splitTokenWindows(text string, size, overlap int) []string {
 	runes := []rune(text)
+	// cum[i] 为前 i 个字符的 token 数，与 EstimateTokens 的估算口径一致
+	cum := make([]float64, len(runes)+1)
+	for i, r := range runes {
+		w := 0.25
+		if isCJK(r) {
+			w = 1
+		}
+		cum[i+1] = cum[i] + w
+	}
 
-	for i := 0; i < len(runes); {
-		end := i + chunkSize
-		if end > len(runes) {
-			end = len(runes)
+	var windows []string
+	for start := 0; start < len(runes); {
+		end := start + 1
+		for end < len(runes) && cum[end+1]-cum[start] <= float64(size) {
+			end++
 		}
-		chunks = append(chunks, string(runes[i:end]))
-		i = end - overlapSize
-		if i >= len(runes) {
+		windows = append(windows, string(runes[start:end]))
+		if end >= len(runes) {
 			break
 		}
+		next := end
+		for next > start+1 && cum[end]-cum[next-1] <= float64(overlap) {
+			next--
+		}
+		start = next
 	}
-
-	return chunks
+	return windows
 }
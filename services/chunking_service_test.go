@@ -0,0 +1,205 @@
+package services
+
+import (
+	"AiDemo/config"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// hanText 生成 n 个互不相同的汉字，便于按位置核对切分结果
+func hanText(n int) string {
+	runes := make([]rune, n)
+	for i := range runes {
+		runes[i] = rune(0x4E00 + i)
+	}
+	return string(runes)
+}
+
+func TestNewChunker(t *testing.T) {
+	defer func(strategy string, size, overlap int) {
+		config.ChunkStrategy, config.ChunkSize, config.ChunkOverlap = strategy, size, overlap
+	}(config.ChunkStrategy, config.ChunkSize, config.ChunkOverlap)
+	config.ChunkStrategy, config.ChunkSize, config.ChunkOverlap = ChunkStrategyRecursive, 300, 50
+
+	intPtr := func(v int) *int { return &v }
+	tests := []struct {
+		name    string
+		opts    ChunkOptions
+		want    Chunker
+		wantErr bool
+	}{
+		{name: "使用配置默认值", want: &RecursiveChunker{Size: 300, Overlap: 50}},
+		{name: "定长切分", opts: ChunkOptions{Strategy: " Fixed ", Size: 100, Overlap: intPtr(0)}, want: &FixedChunker{Size: 100, Overlap: 0}},
+		{name: "重叠不小于片段大小", opts: ChunkOptions{Size: 40}, wantErr: true},
+		{name: "重叠为负数", opts: ChunkOptions{Overlap: intPtr(-1)}, wantErr: true},
+		{name: "不支持的策略", opts: ChunkOptions{Strategy: "semantic"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewChunker(tt.opts)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidChunkOptions) {
+					t.Fatalf("期望 ErrInvalidChunkOptions，实际为 %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewChunker 返回错误: %v", err)
+			}
+			switch want := tt.want.(type) {
+			case *RecursiveChunker:
+				if c, ok := got.(*RecursiveChunker); !ok || *c != *want {
+					t.Errorf("NewChunker = %+v，期望 %+v", got, want)
+				}
+			case *FixedChunker:
+				if c, ok := got.(*FixedChunker); !ok || *c != *want {
+					t.Errorf("NewChunker = %+v，期望 %+v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecursiveChunkerHeadings(t *testing.T) {
+	text := "前言内容。\n# 安装\n## Linux\n执行脚本。\n## Windows\n双击安装包。\n# 使用 #\n```bash\n# 这是注释\n```\n运行命令。\n"
+	chunks := (&RecursiveChunker{Size: 100, Overlap: 0}).Chunk(text)
+
+	want := []Chunk{
+		{Content: "前言内容。"},
+		{Content: "执行脚本。", HeadingPath: "安装 > Linux"},
+		{Content: "双击安装包。", HeadingPath: "安装 > Windows"},
+		{Content: "```bash\n# 这是注释\n```\n运行命令。", HeadingPath: "使用"},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("切分出 %d 个片段，期望 %d: %+v", len(chunks), len(want), chunks)
+	}
+	for i := range want {
+		if chunks[i] != want[i] {
+			t.Errorf("第 %d 个片段 = %+v，期望 %+v", i, chunks[i], want[i])
+		}
+	}
+}
+
+func TestRecursiveChunkerSplitAndOverlap(t *testing.T) {
+	// 12 个互不相同的句子，每句 10 个 token（8 个汉字、1 个字母与句号）
+	var sentences []string
+	for i := 0; i < 12; i++ {
+		sentences = append(sentences, hanText(8)+string(rune('A'+i))+"。")
+	}
+	text := strings.Join(sentences, "")
+
+	tests := []struct {
+		name    string
+		size    int
+		overlap int
+	}{
+		{name: "无重叠", size: 35, overlap: 0},
+		{name: "按完整句子重叠", size: 35, overlap: 12},
+		{name: "重叠不足一句时不重叠", size: 35, overlap: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := (&RecursiveChunker{Size: tt.size, Overlap: tt.overlap}).Chunk(text)
+			if len(chunks) < 2 {
+				t.Fatalf("期望切分为多个片段，实际 %d 个", len(chunks))
+			}
+			var rebuilt strings.Builder
+			for i, c := range chunks {
+				if n := EstimateTokens(c.Content); n > tt.size {
+					t.Errorf("第 %d 个片段 %d 个 token，超过 %d", i, n, tt.size)
+				}
+				parts := splitSentences(c.Content)
+				if i == 0 {
+					rebuilt.WriteString(c.Content)
+					continue
+				}
+				prev := splitSentences(chunks[i-1].Content)
+				// 片段开头与前一片段末尾相同的句子数即为重叠部分
+				shared := 0
+				for n := min(len(parts), len(prev)); n > 0; n-- {
+					if strings.Join(prev[len(prev)-n:], "") == strings.Join(parts[:n], "") {
+						shared = n
+						break
+					}
+				}
+				if tokens := EstimateTokens(strings.Join(parts[:shared], "")); tokens > tt.overlap {
+					t.Errorf("第 %d 个片段重叠 %d 个 token，超过 %d", i, tokens, tt.overlap)
+				}
+				if tt.overlap >= 10 && shared == 0 {
+					t.Errorf("第 %d 个片段没有带上前一片段的末句", i)
+				}
+				rebuilt.WriteString(strings.Join(parts[shared:], ""))
+			}
+			if rebuilt.String() != text {
+				t.Errorf("去掉重叠后无法还原原文:\n%s\n%s", rebuilt.String(), text)
+			}
+		})
+	}
+}
+
+func TestRecursiveChunkerHardSplit(t *testing.T) {
+	text := hanText(250)
+	chunks := (&RecursiveChunker{Size: 100, Overlap: 20}).Chunk(text)
+	var joined strings.Builder
+	for i, c := range chunks {
+		if n := EstimateTokens(c.Content); n > 100 {
+			t.Errorf("第 %d 个片段 %d 个 token，超过 100", i, n)
+		}
+		joined.WriteString(c.Content)
+	}
+	if len(chunks) != 3 || joined.String() != text {
+		t.Errorf("无标点长句应按 token 数硬切为 3 段，实际 %d 段", len(chunks))
+	}
+}
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"中文标点", "第一句。第二句！第三句？", []string{"第一句。", "第二句！", "第三句？"}},
+		{"标点后的引号随句子", "他说：“好。”然后走了。", []string{"他说：“好。”", "然后走了。"}},
+		{"不拆开小数与版本号", "价格 1.5 元。v2.0 发布! Next one", []string{"价格 1.5 元。", "v2.0 发布! ", "Next one"}},
+		{"无句末标点", "SKU-1024", []string{"SKU-1024"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitSentences(tt.text)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("splitSentences(%q) = %q，期望 %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixedChunker(t *testing.T) {
+	text := hanText(24)
+	tests := []struct {
+		name    string
+		size    int
+		overlap int
+		want    []string
+	}{
+		{name: "相邻片段重叠", size: 10, overlap: 3, want: []string{text[0:30], text[21:51], text[42:72]}},
+		{name: "无重叠", size: 10, overlap: 0, want: []string{text[0:30], text[30:60], text[60:72]}},
+		{name: "文本短于片段大小", size: 50, overlap: 5, want: []string{text}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := (&FixedChunker{Size: tt.size, Overlap: tt.overlap}).Chunk("  " + text + "\n")
+			var got []string
+			for _, c := range chunks {
+				got = append(got, c.Content)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("FixedChunker = %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+
+	if chunks := (&FixedChunker{Size: 10}).Chunk(" \n "); len(chunks) != 0 {
+		t.Errorf("空白文本应不产生片段，实际 %d 个", len(chunks))
+	}
+}
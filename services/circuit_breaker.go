@@ -0,0 +1,165 @@
+package services
+
+import (
+	"AiDemo/utils"
+	"sync"
+	"time"
+)
+
+// CircuitState 熔断器状态
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // 正常放行
+	CircuitOpen                         // 熔断中，直接拒绝
+	CircuitHalfOpen                     // 冷却结束，放行一个探测请求
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitStats 熔断器状态快照，用于健康检查
+type CircuitStats struct {
+	Name                string     `json:"name"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	FailureThreshold    int        `json:"failure_threshold"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAfterSeconds   float64    `json:"retry_after_seconds,omitempty"`
+}
+
+// CircuitBreaker 连续失败计数熔断器：
+// 连续失败达到阈值后打开，冷却期内直接拒绝；冷却结束进入半开，仅放行一个探测请求，
+// 探测成功则关闭，失败则重新打开
+type CircuitBreaker struct {
+	mu               sync.Mutex
+	name             string
+	state            CircuitState
+	failures         int
+	failureThreshold int
+	cooldown         time.Duration
+	openedAt         time.Time
+	probing          bool
+}
+
+// NewCircuitBreaker 创建熔断器，threshold <= 0 时不启用熔断
+func NewCircuitBreaker(name string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		name:             name,
+		failureThreshold: threshold,
+		cooldown:         cooldown,
+	}
+}
+
+// Allow 判断当前是否放行请求，熔断中返回 *CircuitOpenError
+func (b *CircuitBreaker) Allow() error {
+	if b.failureThreshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		remaining := b.cooldown - time.Since(b.openedAt)
+		if remaining > 0 {
+			return &CircuitOpenError{Name: b.name, RetryAfter: remaining}
+		}
+		b.setState(CircuitHalfOpen)
+		b.probing = true
+		return nil
+	case CircuitHalfOpen:
+		if b.probing {
+			return &CircuitOpenError{Name: b.name, RetryAfter: time.Second}
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Success 记录一次成功调用
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if b.state != CircuitClosed {
+		b.setState(CircuitClosed)
+	}
+}
+
+// Failure 记录一次失败调用
+func (b *CircuitBreaker) Failure() {
+	if b.failureThreshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == CircuitHalfOpen || b.failures >= b.failureThreshold {
+		b.openedAt = time.Now()
+		b.setState(CircuitOpen)
+	}
+}
+
+// Release 请求未产生可判定的结果（如客户端取消）时释放半开状态下的探测名额
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Stats 返回当前状态快照。打开状态只在 Allow 中切换为半开，
+// 冷却结束后即使没有请求到达也按半开报告，避免被摘除流量的实例一直显示为熔断中
+func (b *CircuitBreaker) Stats() CircuitStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.state
+	if state == CircuitOpen && time.Since(b.openedAt) >= b.cooldown {
+		state = CircuitHalfOpen
+	}
+	stats := CircuitStats{
+		Name:                b.name,
+		State:               state.String(),
+		ConsecutiveFailures: b.failures,
+		FailureThreshold:    b.failureThreshold,
+	}
+	if state == CircuitOpen {
+		openedAt := b.openedAt
+		stats.OpenedAt = &openedAt
+		if remaining := b.cooldown - time.Since(b.openedAt); remaining > 0 {
+			stats.RetryAfterSeconds = remaining.Seconds()
+		}
+	}
+	return stats
+}
+
+// setState 切换状态并记录日志，调用方需持有锁
+func (b *CircuitBreaker) setState(state CircuitState) {
+	if b.state == state {
+		return
+	}
+	prev := b.state
+	b.state = state
+	if state == CircuitOpen {
+		utils.Warning("熔断器[%s]状态变更: %s -> %s，连续失败 %d 次，冷却 %s", b.name, prev, state, b.failures, b.cooldown)
+		return
+	}
+	utils.Info("熔断器[%s]状态变更: %s -> %s", b.name, prev, state)
+}
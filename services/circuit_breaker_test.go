@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+
+	// 每一步对熔断器执行一个操作，并检查之后的状态
+	type step struct {
+		op        string // allow / success / failure / release / wait
+		wantAllow bool   // op 为 allow 时期望放行
+		wantState CircuitState
+	}
+	tests := []struct {
+		name      string
+		threshold int
+		steps     []step
+	}{
+		{
+			name:      "连续失败达到阈值后打开",
+			threshold: 2,
+			steps: []step{
+				{op: "allow", wantAllow: true, wantState: CircuitClosed},
+				{op: "failure", wantState: CircuitClosed},
+				{op: "allow", wantAllow: true, wantState: CircuitClosed},
+				{op: "failure", wantState: CircuitOpen},
+				{op: "allow", wantAllow: false, wantState: CircuitOpen},
+			},
+		},
+		{
+			name:      "成功清零连续失败计数",
+			threshold: 2,
+			steps: []step{
+				{op: "failure", wantState: CircuitClosed},
+				{op: "success", wantState: CircuitClosed},
+				{op: "failure", wantState: CircuitClosed},
+				{op: "allow", wantAllow: true, wantState: CircuitClosed},
+			},
+		},
+		{
+			name:      "冷却结束后半开只放行一个探测请求，探测成功后关闭",
+			threshold: 1,
+			steps: []step{
+				{op: "failure", wantState: CircuitOpen},
+				{op: "wait", wantState: CircuitHalfOpen},
+				{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+				{op: "allow", wantAllow: false, wantState: CircuitHalfOpen},
+				{op: "success", wantState: CircuitClosed},
+				{op: "allow", wantAllow: true, wantState: CircuitClosed},
+			},
+		},
+		{
+			name:      "探测失败重新打开",
+			threshold: 3,
+			steps: []step{
+				{op: "failure", wantState: CircuitClosed},
+				{op: "failure", wantState: CircuitClosed},
+				{op: "failure", wantState: CircuitOpen},
+				{op: "wait", wantState: CircuitHalfOpen},
+				{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+				{op: "failure", wantState: CircuitOpen},
+				{op: "allow", wantAllow: false, wantState: CircuitOpen},
+			},
+		},
+		{
+			name:      "探测被取消时释放名额",
+			threshold: 1,
+			steps: []step{
+				{op: "failure", wantState: CircuitOpen},
+				{op: "wait", wantState: CircuitHalfOpen},
+				{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+				{op: "release", wantState: CircuitHalfOpen},
+				{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+			},
+		},
+		{
+			name:      "阈值为 0 时不启用熔断",
+			threshold: 0,
+			steps: []step{
+				{op: "failure", wantState: CircuitClosed},
+				{op: "failure", wantState: CircuitClosed},
+				{op: "allow", wantAllow: true, wantState: CircuitClosed},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewCircuitBreaker("test", tt.threshold, cooldown)
+			for i, s := range tt.steps {
+				switch s.op {
+				case "allow":
+					err := b.Allow()
+					if (err == nil) != s.wantAllow {
+						t.Fatalf("第 %d 步 Allow() = %v，期望放行: %v", i, err, s.wantAllow)
+					}
+					var openErr *CircuitOpenError
+					if err != nil && (!errors.As(err, &openErr) || openErr.RetryAfter <= 0) {
+						t.Fatalf("第 %d 步期望 *CircuitOpenError，实际为 %v", i, err)
+					}
+				case "success":
+					b.Success()
+				case "failure":
+					b.Failure()
+				case "release":
+					b.Release()
+				case "wait":
+					time.Sleep(cooldown + 5*time.Millisecond)
+				}
+				if got := b.Stats().State; got != s.wantState.String() {
+					t.Fatalf("第 %d 步（%s）后状态 = %s，期望 %s", i, s.op, got, s.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerStats(t *testing.T) {
+	b := NewCircuitBreaker("test", 2, time.Minute)
+	b.Failure()
+	if s := b.Stats(); s.ConsecutiveFailures != 1 || s.OpenedAt != nil || s.RetryAfterSeconds != 0 {
+		t.Fatalf("关闭状态的快照 = %+v", s)
+	}
+	b.Failure()
+	s := b.Stats()
+	if s.State != "open" || s.OpenedAt == nil || s.RetryAfterSeconds <= 0 || s.RetryAfterSeconds > 60 {
+		t.Fatalf("打开状态的快照 = %+v", s)
+	}
+}
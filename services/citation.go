@@ -0,0 +1,94 @@
+package services
+
+import (
+	"AiDemo/models"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CitationSnippetLen 引用摘要的最大字符数
+const CitationSnippetLen = 120
+
+// maxCitationID 引用编号上限，方括号中超过该值的数字（如年份 [2024]）不视为引用标记
+const maxCitationID = 99
+
+// citationMarker 回答中的引用标记，如 [1]、[1, 3]、[2，4]、【1】
+var citationMarker = regexp.MustCompile(`[ \t]*[\[【]\s*(\d+(?:\s*[,，、]\s*\d+)*)\s*[\]】]`)
+
+// ExtractCitations 解析回答中的 [n] 引用标记，按首次出现的顺序返回去重后的引用。
+// 编号从 1 开始对应 sources 中的片段，超出范围的编号标记为无效
+func ExtractCitations(answer string, sources []ScoredDoc) []models.Citation {
+	citations := []models.Citation{}
+	seen := map[int]struct{}{}
+	for _, m := range citationMarker.FindAllStringSubmatch(answer, -1) {
+		ids, ok := citationIDs(m[1])
+		if !ok {
+			continue
+		}
+		for _, n := range ids {
+			if _, ok := seen[n]; ok {
+				continue
+			}
+			seen[n] = struct{}{}
+			citations = append(citations, newCitation(n, sources))
+		}
+	}
+	return citations
+}
+
+// StripCitationMarkers 去掉文本中的引用标记（连同标记前的空格）。
+// 历史回答中的编号对应当时提示词中的片段，带入新一轮提示词会被模型沿用并解析到错误的来源
+func StripCitationMarkers(text string) string {
+	return citationMarker.ReplaceAllStringFunc(text, func(marker string) string {
+		if _, ok := citationIDs(citationMarker.FindStringSubmatch(marker)[1]); ok {
+			return ""
+		}
+		return marker
+	})
+}
+
+// citationIDs 解析标记中的编号列表，任一编号超过 maxCitationID 时整个标记不视为引用
+func citationIDs(list string) ([]int, bool) {
+	var ids []int
+	for _, part := range strings.FieldsFunc(list, isCitationSeparator) {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n > maxCitationID {
+			return nil, false
+		}
+		ids = append(ids, n)
+	}
+	return ids, len(ids) > 0
+}
+
+// newCitation 构造编号 n 的引用
+func newCitation(n int, sources []ScoredDoc) models.Citation {
+	if n < 1 || n > len(sources) {
+		return models.Citation{ID: n}
+	}
+	s := sources[n-1]
+	return models.Citation{
+		ID:          n,
+		KnowledgeID: s.Doc.ID,
+		DocumentID:  s.Doc.DocumentID,
+		Title:       s.Doc.Title,
+		HeadingPath: s.Doc.HeadingPath,
+		Source:      s.Doc.Source,
+		Snippet:     citationSnippet(s.Doc.Content),
+		Score:       s.Score,
+		Valid:       true,
+	}
+}
+
+// citationSnippet 截取片段开头作为摘要，空白折叠为单个空格
+func citationSnippet(content string) string {
+	runes := []rune(strings.Join(strings.Fields(content), " "))
+	if len(runes) <= CitationSnippetLen {
+		return string(runes)
+	}
+	return string(runes[:CitationSnippetLen]) + "…"
+}
+
+func isCitationSeparator(r rune) bool {
+	return r == ',' || r == '，' || r == '、'
+}
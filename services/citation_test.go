@@ -0,0 +1,75 @@
+package services
+
+import (
+	"AiDemo/models"
+	"testing"
+)
+
+func TestExtractCitations(t *testing.T) {
+	sources := []ScoredDoc{
+		{Doc: models.Knowledge{ID: "k_1", Title: "Go 简介", Content: "Go 是一门编译型语言"}, Score: 0.9},
+		{Doc: models.Knowledge{ID: "k_2", Title: "并发", Content: "goroutine 是轻量级线程"}, Score: 0.8},
+		{Doc: models.Knowledge{ID: "k_3", Title: "通道", Content: "channel 用于 goroutine 间通信"}, Score: 0.7},
+	}
+	tests := []struct {
+		name      string
+		answer    string
+		wantIDs   []int
+		wantValid []bool
+	}{
+		{name: "单个引用", answer: "Go 是编译型语言 [1]。", wantIDs: []int{1}, wantValid: []bool{true}},
+		{name: "重复引用按首次出现去重", answer: "并发 [2]，通道 [3]，再次提到并发 [2][3]。", wantIDs: []int{2, 3}, wantValid: []bool{true, true}},
+		{name: "超出范围的编号", answer: "见 [4]，以及 [0]。", wantIDs: []int{4, 0}, wantValid: []bool{false, false}},
+		{name: "全角括号", answer: "Go 是编译型语言【1】。", wantIDs: []int{1}, wantValid: []bool{true}},
+		{name: "多个编号", answer: "详见 [1, 3]、[2，1] 与 [3、2]。", wantIDs: []int{1, 3, 2}, wantValid: []bool{true, true, true}},
+		{name: "年份等非引用方括号", answer: "Go 1.22 于 [2024] 发布，参见 [100] 与 [1, 2024]。", wantIDs: []int{}, wantValid: []bool{}},
+		{name: "混合非引用方括号", answer: "截至 [2024] 年 goroutine 仍是轻量级线程 [2]。", wantIDs: []int{2}, wantValid: []bool{true}},
+		{name: "不是数字", answer: "数组写作 a[i]，空括号 []。", wantIDs: []int{}, wantValid: []bool{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExtractCitations(tt.answer, sources)
+			if got == nil {
+				t.Fatal("没有引用时应返回空切片而不是 nil")
+			}
+			if len(got) != len(tt.wantIDs) {
+				t.Fatalf("ExtractCitations = %+v，期望编号 %v", got, tt.wantIDs)
+			}
+			for i, c := range got {
+				if c.ID != tt.wantIDs[i] || c.Valid != tt.wantValid[i] {
+					t.Errorf("第 %d 个引用 = {ID:%d Valid:%v}，期望 {ID:%d Valid:%v}", i, c.ID, c.Valid, tt.wantIDs[i], tt.wantValid[i])
+				}
+				if !c.Valid {
+					if c.KnowledgeID != "" || c.Snippet != "" {
+						t.Errorf("无效引用不应带片段信息: %+v", c)
+					}
+					continue
+				}
+				if want := sources[c.ID-1]; c.KnowledgeID != want.Doc.ID || c.Title != want.Doc.Title || c.Score != want.Score {
+					t.Errorf("引用 [%d] = %+v，未对应片段 %s", c.ID, c, want.Doc.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestStripCitationMarkers(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "去掉标记及其前面的空格", text: "Go 是编译型语言 [1]。goroutine 很轻量 [2, 3]。", want: "Go 是编译型语言。goroutine 很轻量。"},
+		{name: "全角括号", text: "通道用于通信【3】，并发【1、2】。", want: "通道用于通信，并发。"},
+		{name: "保留非引用方括号", text: "Go 1.22 于 [2024] 发布 [1]，a[i] 为下标。", want: "Go 1.22 于 [2024] 发布，a[i] 为下标。"},
+		{name: "没有标记", text: "普通回答", want: "普通回答"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripCitationMarkers(tt.text); got != tt.want {
+				t.Errorf("StripCitationMarkers(%q) = %q，期望 %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,437 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"AiDemo/utils"
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultDocumentPageSize 文档列表默认每页条数
+	DefaultDocumentPageSize = 20
+	// MaxDocumentPageSize 文档列表每页条数上限
+	MaxDocumentPageSize = 100
+)
+
+// ErrDocumentNotFound 文档不存在
+var ErrDocumentNotFound = errors.New("文档不存在")
+
+// DocumentService 知识文档服务：文档与其片段作为整体查询、替换与删除
+type DocumentService struct{}
+
+// NewDocumentService 创建新的知识文档服务实例
+func NewDocumentService() *DocumentService {
+	return &DocumentService{}
+}
+
+// List 分页列出文档（不含原文），按更新时间倒序，支持按命名空间、来源过滤与标题/原文全文检索
+func (s *DocumentService) List(q models.DocumentListQuery) (*models.DocumentListResponse, error) {
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = DefaultDocumentPageSize
+	}
+	q.PageSize = min(q.PageSize, MaxDocumentPageSize)
+
+	db := config.DB.Model(&models.Document{})
+	if q.Namespace != "" {
+		db = db.Where("namespace = ?", q.Namespace)
+	}
+	if q.Source != "" {
+		db = db.Where("source = ?", q.Source)
+	}
+	for _, term := range strings.Fields(q.Query) {
+		pattern := "%" + escapeLike(term) + "%"
+		db = db.Where("(title LIKE ? ESCAPE '\\' OR content LIKE ? ESCAPE '\\')", pattern, pattern)
+	}
+
+	resp := &models.DocumentListResponse{Documents: []models.Document{}, Page: q.Page, PageSize: q.PageSize}
+	if err := db.Count(&resp.Total).Error; err != nil {
+		return nil, err
+	}
+	err := db.Omit("content").Order("updated_at DESC").
+		Offset((q.Page - 1) * q.PageSize).Limit(q.PageSize).Find(&resp.Documents).Error
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Get 获取文档及其按顺序排列的片段（片段不含向量）
+func (s *DocumentService) Get(id string) (*models.DocumentWithChunks, error) {
+	var doc models.Document
+	if err := config.DB.Where("id = ?", id).First(&doc).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	result := &models.DocumentWithChunks{Document: doc, Chunks: []models.Knowledge{}}
+	err := config.DB.Omit("vector").Where("document_id = ?", id).
+		Order("chunk_index").Find(&result.Chunks).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ResolveID 将片段 ID（k_…）解析为其所属文档的 ID，文档 ID 原样返回；
+// 片段不存在或尚未关联文档时返回 ErrDocumentNotFound
+func (s *DocumentService) ResolveID(id string) (string, error) {
+	if !strings.HasPrefix(id, knowledgeIDPrefix) {
+		return id, nil
+	}
+	var k models.Knowledge
+	if err := config.DB.Select("document_id").Where("id = ?", id).First(&k).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrDocumentNotFound
+		}
+		return "", err
+	}
+	if k.DocumentID == "" {
+		return "", ErrDocumentNotFound
+	}
+	return k.DocumentID, nil
+}
+
+// findDuplicateDocument 查找同一命名空间下内容校验和相同的文档（排除 excludeID，替换时为文档自身），不存在时返回 nil
+func findDuplicateDocument(db *gorm.DB, namespace, checksum, excludeID string) (*models.Document, error) {
+	var doc models.Document
+	query := db.Omit("content").Where("namespace = ? AND checksum = ?", namespace, checksum)
+	if excludeID != "" {
+		query = query.Where("id <> ?", excludeID)
+	}
+	err := query.Order("created_at").First(&doc).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// documentChunks 按顺序获取文档的全部片段（不含向量）
+func documentChunks(id string) ([]*models.Knowledge, error) {
+	var chunks []*models.Knowledge
+	err := config.DB.Omit("vector").Where("document_id = ?", id).Order("chunk_index").Find(&chunks).Error
+	return chunks, err
+}
+
+// replace 整体替换文档：重新切分与向量化后，在同一事务中删除旧片段、写入新片段并将版本号加 1。
+// 入参中来源与命名空间为空时沿用原值；progress 与 finish 可为空。由替换任务（IngestService.SubmitReplace）调用
+func (s *DocumentService) replace(ctx context.Context, id string, in KnowledgeInput, progress ingestProgress, finish ingestFinish) (*models.Document, []*models.Knowledge, error) {
+	var doc models.Document
+	if err := config.DB.Where("id = ?", id).First(&doc).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrDocumentNotFound
+		}
+		return nil, nil, err
+	}
+	if in.Source == "" {
+		in.Source = doc.Source
+	}
+	if in.Namespace == "" {
+		in.Namespace = doc.Namespace
+	}
+	applyDocumentInput(&doc, in, time.Now())
+
+	// 替换后的内容与同一命名空间下的其他文档相同时不执行替换，与新建时的去重一致
+	existing, err := findDuplicateDocument(config.DB, doc.Namespace, doc.Checksum, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if existing != nil {
+		if finish != nil {
+			if err := config.DB.Transaction(func(tx *gorm.DB) error { return finish(tx, existing) }); err != nil {
+				return nil, nil, err
+			}
+		}
+		return s.duplicateOf(id, existing)
+	}
+
+	// 向量化耗时较长，放在事务之外
+	chunks, err := buildChunks(ctx, &doc, in.Chunking, progress)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc.ChunkCount = len(chunks)
+
+	var oldIDs []string
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// 向量化期间可能有相同内容的文档先完成入库
+		var err error
+		if existing, err = findDuplicateDocument(tx, doc.Namespace, doc.Checksum, id); err != nil {
+			return err
+		}
+		if existing != nil {
+			if finish != nil {
+				return finish(tx, existing)
+			}
+			return nil
+		}
+		if err := tx.Model(&models.Knowledge{}).Where("document_id = ?", id).Pluck("id", &oldIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("document_id = ?", id).Delete(&models.Knowledge{}).Error; err != nil {
+			return err
+		}
+		res := tx.Model(&models.Document{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"title":       doc.Title,
+			"source":      doc.Source,
+			"namespace":   doc.Namespace,
+			"checksum":    doc.Checksum,
+			"metadata":    doc.Metadata,
+			"tags":        doc.Tags,
+			"content":     doc.Content,
+			"chunk_count": doc.ChunkCount,
+			"version":     gorm.Expr("version + 1"),
+			"updated_at":  doc.UpdatedAt,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrDocumentNotFound
+		}
+		if err := tx.Create(chunks).Error; err != nil {
+			return err
+		}
+		if finish != nil {
+			return finish(tx, &doc)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if existing != nil {
+		return s.duplicateOf(id, existing)
+	}
+	if err := config.DB.Select("version").Where("id = ?", id).First(&doc).Error; err != nil {
+		return nil, nil, err
+	}
+
+	unindexKnowledge(oldIDs...)
+	for _, k := range chunks {
+		indexKnowledge(*k)
+	}
+	utils.Info("文档已替换: ID=%s, 版本=%d, 片段 %d -> %d", id, doc.Version, len(oldIDs), len(chunks))
+	return &doc, chunks, nil
+}
+
+// duplicateOf 替换内容与已有文档重复时不修改文档 id，返回已有文档与片段
+func (s *DocumentService) duplicateOf(id string, existing *models.Document) (*models.Document, []*models.Knowledge, error) {
+	chunks, err := documentChunks(existing.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	utils.Info("文档 %s 的替换内容与同一命名空间下的文档 %s 相同，跳过替换", id, existing.ID)
+	return existing, chunks, nil
+}
+
+// Delete 在同一事务中删除文档及其全部片段，返回删除的片段数
+func (s *DocumentService) Delete(id string) (int, error) {
+	var ids []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ?", id).Delete(&models.Document{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrDocumentNotFound
+		}
+		if err := tx.Model(&models.Knowledge{}).Where("document_id = ?", id).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		return tx.Where("document_id = ?", id).Delete(&models.Knowledge{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	unindexKnowledge(ids...)
+	utils.Info("文档已删除: ID=%s, 片段 %d 个", id, len(ids))
+	return len(ids), nil
+}
+
+// chunkTitleSuffix 切分片段标题后缀，如 "(片段 2/5)"
+var chunkTitleSuffix = regexp.MustCompile(`\s*\(片段 \d+/\d+\)$`)
+
+// chunkTitlePosition 历史片段标题中的序号与总数，如 "(片段 2/5)"
+var chunkTitlePosition = regexp.MustCompile(`\(片段 (\d+)/(\d+)\)$`)
+
+// legacyDocumentKey 按标题、来源与命名空间推断历史片段所属的原始文档
+func legacyDocumentKey(k models.Knowledge) string {
+	return k.Namespace + "\x00" + k.Source + "\x00" + chunkTitleSuffix.ReplaceAllString(k.Title, "")
+}
+
+// BackfillDocuments 为尚未关联文档的历史片段补建文档。片段按创建时间与标题序号排序后，
+// 去掉片段后缀的标题、来源、命名空间与片段总数 n 都相同、且序号恰好依次为 1..n 的一组片段归为一个文档，
+// 原文为片段内容顺序拼接；序号缺失、重复或中断的片段不归组，各自补建为单片段文档，
+// 避免把同名的多次上传合并成一个文档。需在数据库初始化之后调用
+func BackfillDocuments() error {
+	var orphans []models.Knowledge
+	err := config.DB.Omit("vector").Where("document_id IS NULL OR document_id = ''").
+		Order("created_at, id").Find(&orphans).Error
+	if err != nil || len(orphans) == 0 {
+		return err
+	}
+	// 同一次上传的片段创建时间相同，按序号排序以免 ID 顺序打乱编号
+	sort.SliceStable(orphans, func(i, j int) bool {
+		if !orphans[i].CreatedAt.Equal(orphans[j].CreatedAt) {
+			return orphans[i].CreatedAt.Before(orphans[j].CreatedAt)
+		}
+		a, _, _ := legacyChunkPosition(orphans[i])
+		b, _, _ := legacyChunkPosition(orphans[j])
+		return a < b
+	})
+
+	var groups [][]models.Knowledge
+	single := func(chunks ...models.Knowledge) {
+		for _, k := range chunks {
+			groups = append(groups, []models.Knowledge{k})
+		}
+	}
+	runs := map[string][]models.Knowledge{} // 尚未凑齐的连续片段，键为文档键 + 片段总数
+	for _, k := range orphans {
+		index, total, ok := legacyChunkPosition(k)
+		if !ok {
+			single(k)
+			continue
+		}
+		key := legacyDocumentKey(k) + "\x00" + strconv.Itoa(total)
+		run := runs[key]
+		if index != len(run)+1 {
+			// 序号中断：之前未凑齐的片段不归组；当前片段是新一轮的第 1 个时重新开始
+			single(run...)
+			delete(runs, key)
+			run = nil
+			if index != 1 {
+				single(k)
+				continue
+			}
+		}
+		run = append(run, k)
+		if len(run) == total {
+			groups = append(groups, run)
+			delete(runs, key)
+		} else {
+			runs[key] = run
+		}
+	}
+	keys := make([]string, 0, len(runs))
+	for key := range runs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		single(runs[key]...)
+	}
+
+	for _, chunks := range groups {
+		if err := backfillDocument(chunks); err != nil {
+			return err
+		}
+	}
+	utils.Info("历史片段已补建文档: %d 个片段, %d 个文档", len(orphans), len(groups))
+	return nil
+}
+
+// backfillDocument 为一组历史片段创建文档并回写文档 ID 与片段序号（不更新片段的 updated_at）
+// 完整的一组片段以去掉片段后缀的标题作为文档标题，未归组的单个片段保留原标题
+func backfillDocument(chunks []models.Knowledge) error {
+	first := chunks[0]
+	title := first.Title
+	if _, total, ok := legacyChunkPosition(first); ok && total == len(chunks) {
+		title = chunkTitleSuffix.ReplaceAllString(title, "")
+	}
+	contents := make([]string, len(chunks))
+	for i, k := range chunks {
+		contents[i] = k.Content
+	}
+	content := strings.Join(contents, "")
+
+	doc := &models.Document{
+		ID:         generateDocumentID(),
+		Title:      title,
+		Source:     first.Source,
+		Namespace:  first.Namespace,
+		Checksum:   contentHash(content),
+		Tags:       first.Tags,
+		Version:    1,
+		ChunkCount: len(chunks),
+		Content:    content,
+		CreatedAt:  first.CreatedAt,
+		UpdatedAt:  first.CreatedAt,
+	}
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(doc).Error; err != nil {
+			return err
+		}
+		for i, k := range chunks {
+			err := tx.Model(&models.Knowledge{}).Where("id = ?", k.ID).
+				UpdateColumns(map[string]interface{}{"document_id": doc.ID, "chunk_index": i}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// BackfillContentHashes 为升级前入库、尚无内容哈希的片段补算哈希（不更新片段的 updated_at）
+func BackfillContentHashes() error {
+	var total int
+	for {
+		var batch []models.Knowledge
+		err := config.DB.Select("id", "content").Where("content_hash IS NULL OR content_hash = ''").
+			Limit(500).Find(&batch).Error
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		err = config.DB.Transaction(func(tx *gorm.DB) error {
+			for _, k := range batch {
+				err := tx.Model(&models.Knowledge{}).Where("id = ?", k.ID).
+					UpdateColumn("content_hash", contentHash(k.Content)).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		total += len(batch)
+	}
+	if total > 0 {
+		utils.Info("历史片段已补算内容哈希: %d 个", total)
+	}
+	return nil
+}
+
+// legacyChunkPosition 解析历史片段标题中的序号与总数，没有合法的 "(片段 i/n)" 后缀时 ok 为 false
+func legacyChunkPosition(k models.Knowledge) (index, total int, ok bool) {
+	m := chunkTitlePosition.FindStringSubmatch(k.Title)
+	if m == nil {
+		return 0, 0, false
+	}
+	index, _ = strconv.Atoi(m[1])
+	total, _ = strconv.Atoi(m[2])
+	return index, total, index >= 1 && index <= total
+}
@@ -1,28 +1,86 @@
 package services
 
-// EmbeddingModelVersion 当前使用的embedding模型版本
-const EmbeddingModelVersion = "mock-v1"
+import (
+	"AiDemo/config"
+	"AiDemo/utils"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Embedder 文本向量化抽象，便于在本地实现与远程 Embedding 服务之间切换
+type Embedder interface {
+	// Name 提供方名称
+	Name() string
+	// Version 模型版本标识，写入 Knowledge.EmbeddingModel，不同版本的向量不可混用
+	Version() string
+	// Dimension 向量维度，远程服务在首次调用前可能返回 0
+	Dimension() int
+	// Embed 批量向量化，返回结果与输入一一对应
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+var defaultEmbedder Embedder = NewLocalEmbedder(DefaultLocalEmbeddingDim)
+
+// NewEmbedder 根据提供方名称创建向量化服务
+func NewEmbedder(provider, baseURL, model, apiKey string, dim int) (Embedder, error) {
+	switch strings.ToLower(provider) {
+	case "", "local":
+		return NewLocalEmbedder(dim), nil
+	case "openai":
+		return NewOpenAIEmbedder(baseURL, model, apiKey, dim), nil
+	default:
+		return nil, fmt.Errorf("不支持的向量化服务提供方: %s", provider)
+	}
+}
+
+// InitEmbedder 按配置初始化默认向量化服务
+func InitEmbedder() error {
+	e, err := NewEmbedder(config.EmbeddingProvider, config.EmbeddingBaseURL,
+		config.EmbeddingModel, config.EmbeddingAPIKey, config.EmbeddingDim)
+	if err != nil {
+		return err
+	}
+	SetEmbedder(e)
+	utils.Info("向量化服务已初始化: provider=%s, version=%s", e.Name(), e.Version())
+	return nil
+}
+
+// SetEmbedder 替换默认向量化服务（测试时可注入本地替身）
+func SetEmbedder(e Embedder) {
+	defaultEmbedder = e
+}
+
+// GetEmbedder 获取默认向量化服务
+func GetEmbedder() Embedder {
+	return defaultEmbedder
+}
 
 // EmbedText 将文本转换为向量
-func EmbedText(text string) ([]float64, error) {
-	// TODO: 接入真实的embedding服务
-	return []float64{0.1, 0.2, 0.3}, nil
+func EmbedText(ctx context.Context, text string) ([]float64, error) {
+	vecs, err := EmbedTextBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vecs[0], nil
 }
 
 // EmbedTextBatch 批量向量化，便于大文本批处理
-func EmbedTextBatch(texts []string) ([][]float64, error) {
-	vectors := make([][]float64, 0, len(texts))
-	for _, t := range texts {
-		vec, err := EmbedText(t)
-		if err != nil {
-			return nil, err
-		}
-		vectors = append(vectors, vec)
+func EmbedTextBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return [][]float64{}, nil
+	}
+	vecs, err := defaultEmbedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vecs) != len(texts) {
+		return nil, fmt.Errorf("向量化结果数量不匹配: 期望 %d, 实际 %d", len(texts), len(vecs))
 	}
-	return vectors, nil
+	return vecs, nil
 }
 
 // GetEmbeddingModelVersion 获取当前 Embedding 模型版本
 func GetEmbeddingModelVersion() string {
-	return EmbeddingModelVersion
+	return defaultEmbedder.Version()
 }
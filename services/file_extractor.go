@@ -0,0 +1,414 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 上传文件类型
+const (
+	FileTypeMarkdown = "markdown"
+	FileTypeText     = "text"
+	FileTypeHTML     = "html"
+	FileTypePDF      = "pdf"
+	FileTypeDOCX     = "docx"
+)
+
+// docxMaxDocumentBytes DOCX 中 word/document.xml 解压后的大小上限，防止压缩炸弹
+const docxMaxDocumentBytes = 128 << 20
+
+// 文件入库错误
+var (
+	ErrUnsupportedFileType = errors.New("不支持的文件类型")
+	ErrFileTooLarge        = errors.New("文件过大")
+)
+
+// ExtractedFile 从上传文件中提取的文本
+type ExtractedFile struct {
+	Type    string
+	Title   string // 文档标题：HTML 的 <title>，否则为正文中第一个一级标题，都没有时为空
+	Content string // 提取的正文，标题以 Markdown 形式保留，供切分器识别章节
+}
+
+// extensionTypes 扩展名与文件类型的对应关系
+var extensionTypes = map[string]string{
+	".md":       FileTypeMarkdown,
+	".markdown": FileTypeMarkdown,
+	".txt":      FileTypeText,
+	".text":     FileTypeText,
+	".html":     FileTypeHTML,
+	".htm":      FileTypeHTML,
+	".pdf":      FileTypePDF,
+	".docx":     FileTypeDOCX,
+}
+
+// DetectFileType 识别文件类型：优先按扩展名，无法识别时按文件头判断
+func DetectFileType(filename string, data []byte) (string, error) {
+	if t, ok := extensionTypes[strings.ToLower(filepath.Ext(filename))]; ok {
+		return t, nil
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return FileTypePDF, nil
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")) && bytes.Contains(data, []byte("word/document.xml")):
+		return FileTypeDOCX, nil
+	case utf8.Valid(data):
+		head := strings.ToLower(string(data[:min(len(data), 512)]))
+		if strings.Contains(head, "<html") || strings.Contains(head, "<!doctype html") {
+			return FileTypeHTML, nil
+		}
+		return FileTypeText, nil
+	}
+	return "", fmt.Errorf("%w: %s（支持 .md / .txt / .html / .pdf / .docx）", ErrUnsupportedFileType, filename)
+}
+
+// ExtractText 按文件类型提取正文
+func ExtractText(filename string, data []byte) (*ExtractedFile, error) {
+	fileType, err := DetectFileType(filename, data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ExtractedFile{Type: fileType}
+	switch fileType {
+	case FileTypeMarkdown, FileTypeText:
+		result.Content, err = decodeUTF8Text(data)
+	case FileTypeHTML:
+		result.Title, result.Content, err = extractHTML(data)
+	case FileTypePDF:
+		result.Content, err = extractPDF(data)
+	case FileTypeDOCX:
+		result.Content, err = extractDOCX(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.Content = tidyExtractedText(result.Content)
+	if result.Content == "" {
+		return nil, fmt.Errorf("%w: 未能从文件中提取到文本", ErrEmptyContent)
+	}
+	if result.Title == "" {
+		result.Title = firstTopHeading(result.Content)
+	}
+	return result, nil
+}
+
+// firstTopHeading 正文中第一个一级标题
+func firstTopHeading(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if m := headingLine.FindStringSubmatch(line); m != nil && len(m[1]) == 1 {
+			return strings.TrimSpace(m[2])
+		}
+	}
+	return ""
+}
+
+// decodeUTF8Text 校验 UTF-8 编码并去掉 BOM
+func decodeUTF8Text(data []byte) (string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return "", errors.New("文件不是 UTF-8 编码")
+	}
+	return string(data), nil
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// tidyExtractedText 统一换行、去掉行尾空白并合并多余空行
+func tidyExtractedText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t 　")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// htmlSkipped 不含正文的 HTML 元素：脚本样式与导航、表单等页面框架
+var htmlSkipped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Head: true, atom.Nav: true, atom.Aside: true,
+	atom.Form: true, atom.Button: true, atom.Iframe: true, atom.Svg: true, atom.Canvas: true,
+}
+
+// htmlBlocks 块级元素，前后换行
+var htmlBlocks = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true,
+	atom.Ul: true, atom.Ol: true, atom.Table: true, atom.Tr: true, atom.Blockquote: true,
+	atom.Dl: true, atom.Dt: true, atom.Dd: true, atom.Figure: true, atom.Figcaption: true, atom.Hr: true,
+}
+
+var htmlHeadings = map[atom.Atom]int{
+	atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6,
+}
+
+// extractHTML 提取 HTML 正文并转换为 Markdown 结构：去掉脚本、导航、页眉页脚等页面框架，
+// 页面包含 <main> 或 <article> 时只取其中内容；标题转换为 #，列表项转换为 -，代码块保留原样
+func extractHTML(data []byte) (string, string, error) {
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return "", "", fmt.Errorf("解析 HTML 失败: %w", err)
+	}
+
+	title := ""
+	if n := findHTMLElement(root, atom.Title); n != nil {
+		title = strings.TrimSpace(htmlText(n))
+	}
+	// 页面级的 <header> / <footer> 是站点页眉页脚，<main> / <article> 内的则属于正文
+	body := findHTMLElement(root, atom.Main)
+	if body == nil {
+		body = findHTMLElement(root, atom.Article)
+	}
+	pageLevel := body == nil
+	if pageLevel {
+		body = root
+	}
+	if title == "" {
+		if n := findHTMLElement(body, atom.H1); n != nil {
+			title = strings.TrimSpace(htmlText(n))
+		}
+	}
+
+	var sb strings.Builder
+	renderHTMLMarkdown(&sb, body, pageLevel)
+	return title, sb.String(), nil
+}
+
+// findHTMLElement 深度优先查找第一个指定元素
+func findHTMLElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findHTMLElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// htmlText 元素内的全部文本，空白折叠为单个空格
+func htmlText(n *html.Node) string {
+	return strings.Join(strings.Fields(rawHTMLText(n)), " ")
+}
+
+// renderHTMLMarkdown 将 HTML 节点渲染为 Markdown 文本，pageLevel 时跳过页眉页脚
+func renderHTMLMarkdown(sb *strings.Builder, n *html.Node, pageLevel bool) {
+	switch n.Type {
+	case html.TextNode:
+		if text := strings.Join(strings.Fields(n.Data), " "); text != "" {
+			if strings.HasPrefix(n.Data, " ") || strings.HasPrefix(n.Data, "\n") {
+				text = " " + text
+			}
+			if strings.HasSuffix(n.Data, " ") || strings.HasSuffix(n.Data, "\n") {
+				text += " "
+			}
+			sb.WriteString(text)
+		}
+		return
+	case html.ElementNode:
+		if htmlSkipped[n.DataAtom] || isHiddenHTML(n) ||
+			(pageLevel && (n.DataAtom == atom.Header || n.DataAtom == atom.Footer)) {
+			return
+		}
+		if level, ok := htmlHeadings[n.DataAtom]; ok {
+			sb.WriteString("\n\n" + strings.Repeat("#", level) + " " + htmlText(n) + "\n\n")
+			return
+		}
+		switch n.DataAtom {
+		case atom.Pre:
+			sb.WriteString("\n\n```\n" + strings.Trim(rawHTMLText(n), "\n") + "\n```\n\n")
+			return
+		case atom.Br:
+			sb.WriteString("\n")
+			return
+		case atom.Li:
+			sb.WriteString("\n- ")
+		case atom.Td, atom.Th:
+			sb.WriteString(" | ")
+		}
+	}
+
+	block := n.Type == html.ElementNode && htmlBlocks[n.DataAtom]
+	if block {
+		sb.WriteString("\n\n")
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		renderHTMLMarkdown(sb, c, pageLevel)
+	}
+	if block {
+		sb.WriteString("\n\n")
+	}
+}
+
+// rawHTMLText 元素内的原始文本，保留空白（用于 <pre>）
+func rawHTMLText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+// isHiddenHTML 是否为隐藏元素或导航类角色
+func isHiddenHTML(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "hidden":
+			return true
+		case "aria-hidden":
+			if attr.Val == "true" {
+				return true
+			}
+		case "role":
+			switch attr.Val {
+			case "navigation", "banner", "contentinfo", "complementary":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// extractPDF 逐页提取 PDF 文本，页之间以空行分隔。解析库遇到损坏文件可能 panic，这里统一转为错误
+func extractPDF(data []byte) (content string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("解析 PDF 失败: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("解析 PDF 失败: %w", err)
+	}
+	var pages []string
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			return "", fmt.Errorf("解析 PDF 第 %d 页失败: %w", i, err)
+		}
+		pages = append(pages, text)
+	}
+	return strings.Join(pages, "\n\n"), nil
+}
+
+// docxHeadingStyle Word 标题样式，如 Heading1、heading 2、Title
+var docxHeadingStyle = regexp.MustCompile(`(?i)^heading\s*([1-6])$`)
+
+// extractDOCX 提取 DOCX 正文：段落之间以空行分隔，标题样式转换为 #，列表段落转换为 -
+func extractDOCX(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("解析 DOCX 失败: %w", err)
+	}
+	var doc *zip.File
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			doc = f
+			break
+		}
+	}
+	if doc == nil {
+		return "", errors.New("解析 DOCX 失败: 缺少 word/document.xml")
+	}
+	rc, err := doc.Open()
+	if err != nil {
+		return "", fmt.Errorf("解析 DOCX 失败: %w", err)
+	}
+	defer rc.Close()
+
+	// 多读 1 字节用于判断是否超过上限
+	lr := &io.LimitedReader{R: rc, N: docxMaxDocumentBytes + 1}
+	var sb strings.Builder
+	var para strings.Builder
+	prefix := ""
+	inText := false
+	dec := xml.NewDecoder(lr)
+	for {
+		tok, err := dec.Token()
+		if lr.N <= 0 {
+			return "", fmt.Errorf("%w: DOCX 正文解压后超过 %d MB", ErrFileTooLarge, docxMaxDocumentBytes>>20)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("解析 DOCX 失败: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				para.Reset()
+				prefix = ""
+			case "pStyle":
+				style := docxAttr(t, "val")
+				if m := docxHeadingStyle.FindStringSubmatch(style); m != nil {
+					prefix = strings.Repeat("#", int(m[1][0]-'0')) + " "
+				} else if strings.EqualFold(style, "Title") {
+					prefix = "# "
+				}
+			case "numPr":
+				if prefix == "" {
+					prefix = "- "
+				}
+			case "t":
+				inText = true
+			case "tab":
+				para.WriteString("\t")
+			case "br", "cr":
+				para.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if text := strings.TrimSpace(para.String()); text != "" {
+					sb.WriteString(prefix + text + "\n\n")
+				}
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		}
+	}
+	return sb.String(), nil
+}
+
+// docxAttr 读取 WordprocessingML 元素属性（忽略命名空间）
+func docxAttr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"AiDemo/utils"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// summaryPrefix 摘要作为系统消息注入时的前缀
+const summaryPrefix = "以下是此前对话的摘要，供参考：\n"
+
+// HistoryBuilder 按 token 预算构建发送给模型的对话历史：
+// 始终保留系统提示词与最新的消息，超出预算的早期对话压缩为摘要（或直接丢弃）。
+// 摘要保存在会话上，只有当新的消息被挤出窗口时才增量更新。
+type HistoryBuilder struct {
+	Budget        int  // 总 token 预算
+	MinRecent     int  // 预算允许时至少保留的最近消息条数
+	SummaryTokens int  // 摘要 token 上限
+	Summarize     bool // 是否生成摘要
+
+	sessionService *SessionService
+}
+
+// NewHistoryBuilder 按配置创建历史构建器
+func NewHistoryBuilder() *HistoryBuilder {
+	return &HistoryBuilder{
+		Budget:         config.ContextTokenBudget,
+		MinRecent:      config.ContextMinRecent,
+		SummaryTokens:  config.ContextSummaryTokens,
+		Summarize:      config.ContextSummarize,
+		sessionService: NewSessionService(),
+	}
+}
+
+// Build 构建会话的上下文消息，包含系统提示词、摘要（如有）与最近的对话
+func (b *HistoryBuilder) Build(ctx context.Context, sessionID, systemPrompt string) ([]models.Message, error) {
+	return b.build(ctx, sessionID, models.Message{Role: "system", Content: systemPrompt}, 0)
+}
+
+// BuildWithPrompt 用于本次的用户消息尚未保存到会话的场景（如 RAG 的知识提示词）：
+// 预算先扣除 userPrompt，再构建系统提示词、摘要与最近的对话，最后追加 userPrompt。systemPrompt 为空时不发送系统消息
+func (b *HistoryBuilder) BuildWithPrompt(ctx context.Context, sessionID, systemPrompt, userPrompt string) ([]models.Message, error) {
+	user := models.Message{Role: "user", Content: userPrompt}
+	messages, err := b.build(ctx, sessionID, models.Message{Role: "system", Content: systemPrompt}, EstimateMessageTokens(user))
+	if err != nil {
+		return nil, err
+	}
+	return append(messages, user), nil
+}
+
+// build 按扣除 reserved 后的预算构建上下文消息
+func (b *HistoryBuilder) build(ctx context.Context, sessionID string, system models.Message, reserved int) ([]models.Message, error) {
+	session, err := b.sessionService.GetSession(sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		// 客户端自行指定、尚未创建的会话 ID 同样可以对话，只是没有摘要
+		session, err = &models.Session{ID: sessionID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	records, err := b.sessionService.GetSessionMessages(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	available := b.Budget - reserved
+	if system.Content != "" {
+		available -= EstimateMessageTokens(system)
+	}
+
+	// 已被摘要覆盖的消息不再原样发送
+	start := 0
+	for start < len(records) && records[start].ID <= session.SummaryUntilID {
+		start++
+	}
+	recent := records[start:]
+
+	summary := session.Summary
+	if b.fits(summary, recent, available) {
+		return b.assemble(system, summary, recent), nil
+	}
+
+	if !b.Summarize {
+		kept := b.trimToBudget(recent, available)
+		utils.Info("会话 %s 超出上下文预算，丢弃 %d 条早期消息", sessionID, len(recent)-len(kept))
+		return b.assemble(system, summary, kept), nil
+	}
+
+	// 为摘要预留空间后，只保留一半预算给最近的消息，避免窗口每前进一条就重新摘要
+	keepBudget := (available - b.SummaryTokens - messageOverheadTokens) / 2
+	cut := b.splitPoint(recent, keepBudget, available-b.SummaryTokens-messageOverheadTokens)
+	dropped, kept := recent[:cut], recent[cut:]
+
+	if len(dropped) > 0 {
+		newSummary, err := b.summarize(ctx, sessionID, summary, dropped)
+		if err != nil {
+			// 摘要失败时退化为直接丢弃，保证本次请求可用
+			utils.Warning("会话 %s 生成摘要失败，丢弃早期消息: %v", sessionID, err)
+		} else {
+			summary = newSummary
+			untilID := dropped[len(dropped)-1].ID
+			if err := b.sessionService.UpdateSummary(sessionID, summary, untilID); err != nil {
+				utils.Error("保存会话摘要失败: %v", err)
+			}
+			utils.Info("会话 %s 已摘要 %d 条早期消息，覆盖至消息 %d", sessionID, len(dropped), untilID)
+		}
+	}
+
+	kept = b.trimToBudget(kept, available-b.summaryCost(summary))
+	return b.assemble(system, summary, kept), nil
+}
+
+// fits 判断摘要与消息是否在预算内
+func (b *HistoryBuilder) fits(summary string, records []models.ChatMessage, budget int) bool {
+	total := b.summaryCost(summary)
+	for _, r := range records {
+		total += EstimateMessageTokens(toMessage(r))
+	}
+	return total <= budget
+}
+
+// splitPoint 从最新消息往前累计，返回保留部分的起始下标：
+// 优先控制在 keepBudget 内，但在不超过 maxBudget 的前提下至少保留 MinRecent 条，且始终保留最后一条
+func (b *HistoryBuilder) splitPoint(records []models.ChatMessage, keepBudget, maxBudget int) int {
+	total := 0
+	cut := len(records)
+	for i := len(records) - 1; i >= 0; i-- {
+		cost := EstimateMessageTokens(toMessage(records[i]))
+		kept := len(records) - i - 1
+		withinKeep := total+cost <= keepBudget
+		withinMin := kept < b.MinRecent && total+cost <= maxBudget
+		if kept > 0 && !withinKeep && !withinMin {
+			break
+		}
+		total += cost
+		cut = i
+	}
+	return cut
+}
+
+// trimToBudget 从最早的消息开始丢弃直到满足预算，始终保留最后一条
+func (b *HistoryBuilder) trimToBudget(records []models.ChatMessage, budget int) []models.ChatMessage {
+	total := 0
+	for _, r := range records {
+		total += EstimateMessageTokens(toMessage(r))
+	}
+	for len(records) > 1 && total > budget {
+		total -= EstimateMessageTokens(toMessage(records[0]))
+		records = records[1:]
+	}
+	return records
+}
+
+// summaryCost 摘要消息的 token 开销
+func (b *HistoryBuilder) summaryCost(summary string) int {
+	if summary == "" {
+		return 0
+	}
+	return EstimateTokens(summaryPrefix+summary) + messageOverheadTokens
+}
+
+// summarize 将已有摘要与新挤出窗口的消息合并为新的摘要
+func (b *HistoryBuilder) summarize(ctx context.Context, sessionID, previous string, dropped []models.ChatMessage) (string, error) {
+	var sb strings.Builder
+	if previous != "" {
+		sb.WriteString("【已有摘要】\n")
+		sb.WriteString(previous)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("【新增对话】\n")
+	for _, r := range dropped {
+		role := "用户"
+		if r.Role == "assistant" {
+			role = "助手"
+		}
+		sb.WriteString(role + "：" + r.Content + "\n")
+	}
+
+	messages := []models.Message{
+		{Role: "system", Content: fmt.Sprintf(
+			"你负责压缩对话历史。请将已有摘要与新增对话合并为一段简洁的中文摘要，"+
+				"保留关键事实、用户的偏好与约束、已得出的结论和尚未解决的问题，不要编造内容，长度不超过 %d 字。",
+			b.SummaryTokens)},
+		{Role: "user", Content: sb.String()},
+	}
+
+	result, err := GetChatProvider().Chat(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	RecordUsage(sessionID, "summary", "system", result)
+	return strings.TrimSpace(result.Content), nil
+}
+
+// assemble 组装最终发送给模型的消息
+func (b *HistoryBuilder) assemble(system models.Message, summary string, records []models.ChatMessage) []models.Message {
+	var messages []models.Message
+	if system.Content != "" {
+		messages = append(messages, system)
+	}
+	if summary != "" {
+		messages = append(messages, models.Message{Role: "system", Content: summaryPrefix + summary})
+	}
+	for _, r := range records {
+		messages = append(messages, toMessage(r))
+	}
+	return messages
+}
+
+func toMessage(r models.ChatMessage) models.Message {
+	return models.Message{Role: r.Role, Content: r.Content}
+}
@@ -0,0 +1,554 @@
+package services
+
+import (
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// hnswSnapshotVersion 持久化格式版本，格式变化时旧文件将被忽略并重建
+const hnswSnapshotVersion = 1
+
+// HNSWParams HNSW 索引参数
+type HNSWParams struct {
+	M              int // 每个节点在上层的最大邻居数，第 0 层为 2M
+	EfConstruction int // 建图时的候选集大小，越大召回越高、建图越慢
+	EfSearch       int // 查询时的候选集大小，越大召回越高、查询越慢
+}
+
+// hnswNode 图中的节点，字段导出以便 gob 持久化
+type hnswNode struct {
+	ID        string
+	Namespace string
+	UpdatedAt int64 // 知识片段的更新时间（UnixNano），启动时用于与数据库对账
+	Vec       []float32
+	Level     int
+	Links     [][]int32 // 每层的邻居
+	Deleted   bool      // 墓碑标记，删除的节点仍参与图遍历，但不出现在结果中
+}
+
+// hnswSnapshot 持久化快照
+type hnswSnapshot struct {
+	Version  int
+	Model    string
+	Dim      int
+	Params   HNSWParams
+	Nodes    []*hnswNode
+	Entry    int32
+	MaxLevel int
+}
+
+// HNSWHit 检索命中
+type HNSWHit struct {
+	ID    string
+	Score float64 // 余弦相似度
+}
+
+// HNSWIndex 内存中的 HNSW（分层可导航小世界图）近似最近邻索引。
+// 向量归一化后以 float32 存储，距离为 1 - 余弦相似度；删除采用墓碑标记，墓碑过多时应整体重建
+type HNSWIndex struct {
+	mu        sync.RWMutex
+	model     string
+	dim       int
+	params    HNSWParams
+	levelMult float64
+	nodes     []*hnswNode
+	byID      map[string]int32
+	byNS      map[string]map[int32]struct{} // 命名空间 -> 有效节点，用于小命名空间的精确检索
+	entry     int32
+	maxLevel  int
+	deleted   int
+	rng       *rand.Rand
+	dirty     bool
+}
+
+// NewHNSWIndex 创建空索引，model 为索引所属的向量模型版本
+func NewHNSWIndex(model string, params HNSWParams) *HNSWIndex {
+	if params.M <= 0 {
+		params.M = 16
+	}
+	if params.EfConstruction <= 0 {
+		params.EfConstruction = 100
+	}
+	if params.EfSearch <= 0 {
+		params.EfSearch = 64
+	}
+	return &HNSWIndex{
+		model:     model,
+		params:    params,
+		levelMult: 1 / math.Log(float64(params.M)),
+		byID:      map[string]int32{},
+		byNS:      map[string]map[int32]struct{}{},
+		entry:     -1,
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Model 索引所属的向量模型版本
+func (h *HNSWIndex) Model() string {
+	return h.model
+}
+
+// Len 有效节点数
+func (h *HNSWIndex) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.nodes) - h.deleted
+}
+
+// TombstoneRatio 墓碑节点占比
+func (h *HNSWIndex) TombstoneRatio() float64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.nodes) == 0 {
+		return 0
+	}
+	return float64(h.deleted) / float64(len(h.nodes))
+}
+
+// Add 插入或替换节点，向量维度须与索引一致
+func (h *HNSWIndex) Add(id, namespace string, updatedAt int64, vec []float64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.dim == 0 {
+		h.dim = len(vec)
+	}
+	if len(vec) != h.dim {
+		return fmt.Errorf("向量维度不匹配: 索引为 %d, 片段 %s 为 %d", h.dim, id, len(vec))
+	}
+	h.remove(id)
+
+	node := &hnswNode{
+		ID:        id,
+		Namespace: namespace,
+		UpdatedAt: updatedAt,
+		Vec:       normalizeFloat32(vec),
+		Level:     h.randomLevel(),
+	}
+	node.Links = make([][]int32, node.Level+1)
+	nid := int32(len(h.nodes))
+	h.nodes = append(h.nodes, node)
+	h.byID[id] = nid
+	h.addToNamespace(namespace, nid)
+	h.dirty = true
+
+	if h.entry < 0 {
+		h.entry = nid
+		h.maxLevel = node.Level
+		return nil
+	}
+
+	ep := []int32{h.entry}
+	for l := h.maxLevel; l > node.Level; l-- {
+		ep = []int32{h.searchLayer(node.Vec, ep, 1, l, nil)[0].id}
+	}
+	for l := min(node.Level, h.maxLevel); l >= 0; l-- {
+		candidates := h.searchLayer(node.Vec, ep, h.params.EfConstruction, l, nil)
+		neighbors := h.selectNeighbors(candidates, h.params.M)
+		node.Links[l] = candidateIDs(neighbors)
+		for _, nb := range neighbors {
+			h.link(nb.id, nid, l)
+		}
+		ep = candidateIDs(candidates)
+	}
+
+	if node.Level > h.maxLevel {
+		h.entry = nid
+		h.maxLevel = node.Level
+	}
+	return nil
+}
+
+// Remove 删除节点（墓碑标记），返回节点是否存在
+func (h *HNSWIndex) Remove(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.remove(id)
+}
+
+// Search 检索与 vec 最相似的 k 个有效节点，namespace 为空时不过滤命名空间，allowed 非 nil 时只返回其中的节点
+func (h *HNSWIndex) Search(vec []float64, namespace string, allowed map[string]struct{}, k int) []HNSWHit {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.entry < 0 || k <= 0 || len(vec) != h.dim {
+		return nil
+	}
+	q := normalizeFloat32(vec)
+	ef := h.params.EfSearch
+	if k > ef {
+		ef = k
+	}
+
+	accept := func(n *hnswNode) bool {
+		if n.Deleted || (namespace != "" && n.Namespace != namespace) {
+			return false
+		}
+		if allowed != nil {
+			_, ok := allowed[n.ID]
+			return ok
+		}
+		return true
+	}
+
+	// 候选范围较小时直接精确计算，避免图遍历大量跳过不匹配的节点
+	var results []hnswCandidate
+	members, ok := h.byNS[namespace]
+	switch {
+	case allowed != nil && len(allowed) <= ef*4:
+		results = h.scan(q, h.nodeIDs(allowed), accept)
+	case namespace != "" && (!ok || len(members) <= ef*4):
+		results = h.scan(q, members, accept)
+	default:
+		ep := []int32{h.entry}
+		for l := h.maxLevel; l > 0; l-- {
+			ep = []int32{h.searchLayer(q, ep, 1, l, nil)[0].id}
+		}
+		results = h.searchLayer(q, ep, ef, 0, accept)
+	}
+
+	if len(results) > k {
+		results = results[:k]
+	}
+	hits := make([]HNSWHit, len(results))
+	for i, r := range results {
+		hits[i] = HNSWHit{ID: h.nodes[r.id].ID, Score: 1 - float64(r.dist)}
+	}
+	return hits
+}
+
+// UpdatedAt 返回节点记录的更新时间，节点不存在时 ok 为 false
+func (h *HNSWIndex) UpdatedAt(id string) (int64, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	nid, ok := h.byID[id]
+	if !ok {
+		return 0, false
+	}
+	return h.nodes[nid].UpdatedAt, true
+}
+
+// IDs 返回全部有效节点 ID
+func (h *HNSWIndex) IDs() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ids := make([]string, 0, len(h.byID))
+	for id := range h.byID {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Save 持久化到文件（先写临时文件再重命名，避免写入中断产生损坏的索引）
+func (h *HNSWIndex) Save(path string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	snapshot := hnswSnapshot{
+		Version:  hnswSnapshotVersion,
+		Model:    h.model,
+		Dim:      h.dim,
+		Params:   h.params,
+		Nodes:    h.nodes,
+		Entry:    h.entry,
+		MaxLevel: h.maxLevel,
+	}
+	if err := gob.NewEncoder(f).Encode(&snapshot); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	h.dirty = false
+	return nil
+}
+
+// Dirty 自上次持久化后是否有变更
+func (h *HNSWIndex) Dirty() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.dirty
+}
+
+// LoadHNSWIndex 从文件加载索引
+func LoadHNSWIndex(path string) (*HNSWIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var snapshot hnswSnapshot
+	if err := gob.NewDecoder(f).Decode(&snapshot); err != nil {
+		return nil, err
+	}
+	if snapshot.Version != hnswSnapshotVersion {
+		return nil, fmt.Errorf("索引文件版本 %d 与当前版本 %d 不一致", snapshot.Version, hnswSnapshotVersion)
+	}
+
+	h := NewHNSWIndex(snapshot.Model, snapshot.Params)
+	h.dim = snapshot.Dim
+	h.nodes = snapshot.Nodes
+	h.entry = snapshot.Entry
+	h.maxLevel = snapshot.MaxLevel
+	for i, n := range h.nodes {
+		if n.Deleted {
+			h.deleted++
+			continue
+		}
+		h.byID[n.ID] = int32(i)
+		h.addToNamespace(n.Namespace, int32(i))
+	}
+	return h, nil
+}
+
+// remove 删除节点，调用方需持有写锁
+func (h *HNSWIndex) remove(id string) bool {
+	nid, ok := h.byID[id]
+	if !ok {
+		return false
+	}
+	node := h.nodes[nid]
+	node.Deleted = true
+	delete(h.byID, id)
+	if members := h.byNS[node.Namespace]; members != nil {
+		delete(members, nid)
+		if len(members) == 0 {
+			delete(h.byNS, node.Namespace)
+		}
+	}
+	h.deleted++
+	h.dirty = true
+	return true
+}
+
+func (h *HNSWIndex) addToNamespace(namespace string, nid int32) {
+	members := h.byNS[namespace]
+	if members == nil {
+		members = map[int32]struct{}{}
+		h.byNS[namespace] = members
+	}
+	members[nid] = struct{}{}
+}
+
+// link 为节点 from 在第 layer 层添加指向 to 的边，超出上限时按启发式裁剪
+func (h *HNSWIndex) link(from, to int32, layer int) {
+	node := h.nodes[from]
+	node.Links[layer] = append(node.Links[layer], to)
+
+	maxLinks := h.params.M
+	if layer == 0 {
+		maxLinks = 2 * h.params.M
+	}
+	if len(node.Links[layer]) <= maxLinks {
+		return
+	}
+
+	candidates := make([]hnswCandidate, len(node.Links[layer]))
+	for i, nb := range node.Links[layer] {
+		candidates[i] = hnswCandidate{id: nb, dist: cosineDistance(node.Vec, h.nodes[nb].Vec)}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].dist < candidates[j].dist })
+	node.Links[layer] = candidateIDs(h.selectNeighbors(candidates, maxLinks))
+}
+
+// selectNeighbors 邻居选择启发式：优先保留彼此不相近的候选，使图在各方向上都有连接，
+// 名额不足时再用被裁掉的候选补齐。candidates 须按距离升序
+func (h *HNSWIndex) selectNeighbors(candidates []hnswCandidate, m int) []hnswCandidate {
+	if len(candidates) <= m {
+		return candidates
+	}
+	selected := make([]hnswCandidate, 0, m)
+	var pruned []hnswCandidate
+	for _, c := range candidates {
+		if len(selected) >= m {
+			break
+		}
+		good := true
+		for _, s := range selected {
+			if cosineDistance(h.nodes[c.id].Vec, h.nodes[s.id].Vec) < c.dist {
+				good = false
+				break
+			}
+		}
+		if good {
+			selected = append(selected, c)
+		} else {
+			pruned = append(pruned, c)
+		}
+	}
+	for _, p := range pruned {
+		if len(selected) >= m {
+			break
+		}
+		selected = append(selected, p)
+	}
+	return selected
+}
+
+// searchLayer 在指定层做贪心束搜索，返回按距离升序的最多 ef 个结果。
+// accept 为 nil 时所有节点均可作为结果，否则不满足条件的节点只参与遍历
+func (h *HNSWIndex) searchLayer(q []float32, entryPoints []int32, ef, layer int, accept func(*hnswNode) bool) []hnswCandidate {
+	visited := make(map[int32]struct{}, ef*4)
+	candidates := &candidateMinHeap{}
+	results := &candidateMaxHeap{}
+
+	for _, ep := range entryPoints {
+		visited[ep] = struct{}{}
+		c := hnswCandidate{id: ep, dist: cosineDistance(q, h.nodes[ep].Vec)}
+		heap.Push(candidates, c)
+		if accept == nil || accept(h.nodes[ep]) {
+			heap.Push(results, c)
+		}
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() >= ef && c.dist > (*results)[0].dist {
+			break
+		}
+		node := h.nodes[c.id]
+		if layer >= len(node.Links) {
+			continue
+		}
+		for _, nb := range node.Links[layer] {
+			if _, ok := visited[nb]; ok {
+				continue
+			}
+			visited[nb] = struct{}{}
+			d := cosineDistance(q, h.nodes[nb].Vec)
+			if results.Len() < ef || d < (*results)[0].dist {
+				heap.Push(candidates, hnswCandidate{id: nb, dist: d})
+				if accept == nil || accept(h.nodes[nb]) {
+					heap.Push(results, hnswCandidate{id: nb, dist: d})
+					if results.Len() > ef {
+						heap.Pop(results)
+					}
+				}
+			}
+		}
+	}
+
+	sorted := make([]hnswCandidate, results.Len())
+	for i := len(sorted) - 1; i >= 0; i-- {
+		sorted[i] = heap.Pop(results).(hnswCandidate)
+	}
+	return sorted
+}
+
+// scan 对给定节点集合中满足条件的节点精确计算距离
+func (h *HNSWIndex) scan(q []float32, members map[int32]struct{}, accept func(*hnswNode) bool) []hnswCandidate {
+	results := make([]hnswCandidate, 0, len(members))
+	for nid := range members {
+		if !accept(h.nodes[nid]) {
+			continue
+		}
+		results = append(results, hnswCandidate{id: nid, dist: cosineDistance(q, h.nodes[nid].Vec)})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].dist < results[j].dist })
+	return results
+}
+
+// nodeIDs 将片段 ID 集合转换为索引中的有效节点集合
+func (h *HNSWIndex) nodeIDs(ids map[string]struct{}) map[int32]struct{} {
+	members := make(map[int32]struct{}, len(ids))
+	for id := range ids {
+		if nid, ok := h.byID[id]; ok {
+			members[nid] = struct{}{}
+		}
+	}
+	return members
+}
+
+// randomLevel 按指数分布随机生成节点层数
+func (h *HNSWIndex) randomLevel() int {
+	return int(math.Floor(-math.Log(1-h.rng.Float64()) * h.levelMult))
+}
+
+// hnswCandidate 检索候选
+type hnswCandidate struct {
+	id   int32
+	dist float32
+}
+
+// candidateMinHeap 距离最小的在堆顶
+type candidateMinHeap []hnswCandidate
+
+func (h candidateMinHeap) Len() int            { return len(h) }
+func (h candidateMinHeap) Less(i, j int) bool  { return h[i].dist < h[j].dist }
+func (h candidateMinHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *candidateMinHeap) Push(x interface{}) { *h = append(*h, x.(hnswCandidate)) }
+func (h *candidateMinHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// candidateMaxHeap 距离最大的在堆顶
+type candidateMaxHeap []hnswCandidate
+
+func (h candidateMaxHeap) Len() int            { return len(h) }
+func (h candidateMaxHeap) Less(i, j int) bool  { return h[i].dist > h[j].dist }
+func (h candidateMaxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *candidateMaxHeap) Push(x interface{}) { *h = append(*h, x.(hnswCandidate)) }
+func (h *candidateMaxHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func candidateIDs(candidates []hnswCandidate) []int32 {
+	ids := make([]int32, len(candidates))
+	for i, c := range candidates {
+		ids[i] = c.id
+	}
+	return ids
+}
+
+// normalizeFloat32 L2 归一化并转换为 float32，零向量保持为零
+func normalizeFloat32(vec []float64) []float32 {
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	out := make([]float32, len(vec))
+	if norm == 0 {
+		return out
+	}
+	norm = math.Sqrt(norm)
+	for i, v := range vec {
+		out[i] = float32(v / norm)
+	}
+	return out
+}
+
+// cosineDistance 归一化向量的余弦距离
+func cosineDistance(a, b []float32) float32 {
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return 1 - dot
+}
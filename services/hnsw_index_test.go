@@ -0,0 +1,248 @@
+package services
+
+import (
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+var testHNSWParams = HNSWParams{M: 16, EfConstruction: 100, EfSearch: 64}
+
+// clusteredVectors 生成围绕 clusters 个中心分布的合成向量，接近真实嵌入的聚簇分布
+type clusteredVectors struct {
+	rng     *rand.Rand
+	dim     int
+	centers [][]float64
+}
+
+func newClusteredVectors(seed int64, dim, clusters int) *clusteredVectors {
+	g := &clusteredVectors{rng: rand.New(rand.NewSource(seed)), dim: dim}
+	for i := 0; i < clusters; i++ {
+		g.centers = append(g.centers, g.gaussian(1))
+	}
+	return g
+}
+
+func (g *clusteredVectors) gaussian(scale float64) []float64 {
+	vec := make([]float64, g.dim)
+	for i := range vec {
+		vec[i] = g.rng.NormFloat64() * scale
+	}
+	return vec
+}
+
+func (g *clusteredVectors) next() []float64 {
+	vec := g.gaussian(0.5)
+	center := g.centers[g.rng.Intn(len(g.centers))]
+	for i := range vec {
+		vec[i] += center[i]
+	}
+	return vec
+}
+
+// bruteForceTopK 精确计算全部距离后取 TopK，作为召回率的基准
+func bruteForceTopK(q []float64, ids []string, data [][]float32, k int) []string {
+	nq := normalizeFloat32(q)
+	candidates := make([]hnswCandidate, len(data))
+	for i, vec := range data {
+		candidates[i] = hnswCandidate{id: int32(i), dist: cosineDistance(nq, vec)}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].dist < candidates[j].dist })
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	result := make([]string, len(candidates))
+	for i, c := range candidates {
+		result[i] = ids[c.id]
+	}
+	return result
+}
+
+// buildTestIndex 向索引写入 n 个合成向量，返回 ID 与归一化后的向量供暴力检索使用
+func buildTestIndex(tb testing.TB, g *clusteredVectors, n int, namespace func(i int) string) (*HNSWIndex, []string, [][]float32) {
+	tb.Helper()
+	index := NewHNSWIndex("test", testHNSWParams)
+	ids := make([]string, n)
+	data := make([][]float32, n)
+	for i := 0; i < n; i++ {
+		vec := g.next()
+		ids[i] = "k_" + strconv.Itoa(i)
+		data[i] = normalizeFloat32(vec)
+		ns := ""
+		if namespace != nil {
+			ns = namespace(i)
+		}
+		if err := index.Add(ids[i], ns, int64(i), vec); err != nil {
+			tb.Fatalf("Add(%s) 失败: %v", ids[i], err)
+		}
+	}
+	return index, ids, data
+}
+
+// recallAt 计算 HNSW 结果与暴力检索 TopK 的重合率
+func recallAt(hits []HNSWHit, exact []string) float64 {
+	truth := make(map[string]struct{}, len(exact))
+	for _, id := range exact {
+		truth[id] = struct{}{}
+	}
+	found := 0
+	for _, h := range hits {
+		if _, ok := truth[h.ID]; ok {
+			found++
+		}
+	}
+	return float64(found) / float64(len(exact))
+}
+
+func TestHNSWRecall(t *testing.T) {
+	tests := []struct {
+		name       string
+		docs, dim  int
+		k          int
+		minRecall  float64
+		queryCount int
+	}{
+		{name: "低维小规模", docs: 1000, dim: 32, k: 5, minRecall: 0.95, queryCount: 50},
+		{name: "高维", docs: 3000, dim: 128, k: 10, minRecall: 0.9, queryCount: 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newClusteredVectors(42, tt.dim, 32)
+			index, ids, data := buildTestIndex(t, g, tt.docs, nil)
+
+			var sum float64
+			for q := 0; q < tt.queryCount; q++ {
+				vec := g.next()
+				hits := index.Search(vec, "", nil, tt.k)
+				if len(hits) != tt.k {
+					t.Fatalf("返回 %d 个结果，期望 %d", len(hits), tt.k)
+				}
+				for i := 1; i < len(hits); i++ {
+					if hits[i].Score > hits[i-1].Score {
+						t.Fatalf("结果未按相似度降序排列: %v", hits)
+					}
+				}
+				sum += recallAt(hits, bruteForceTopK(vec, ids, data, tt.k))
+			}
+			if recall := sum / float64(tt.queryCount); recall < tt.minRecall {
+				t.Errorf("recall@%d = %.3f，低于 %.2f", tt.k, recall, tt.minRecall)
+			}
+		})
+	}
+}
+
+func TestHNSWSearchFilters(t *testing.T) {
+	g := newClusteredVectors(7, 32, 8)
+	namespaces := []string{"golang", "faq", "company-doc"}
+	index, ids, _ := buildTestIndex(t, g, 600, func(i int) string { return namespaces[i%len(namespaces)] })
+
+	query := g.next()
+	for _, ns := range namespaces {
+		hits := index.Search(query, ns, nil, 10)
+		if len(hits) != 10 {
+			t.Fatalf("命名空间 %s 返回 %d 个结果", ns, len(hits))
+		}
+		for _, h := range hits {
+			i, _ := strconv.Atoi(h.ID[2:])
+			if namespaces[i%len(namespaces)] != ns {
+				t.Errorf("命名空间 %s 的结果中出现了 %s", ns, h.ID)
+			}
+		}
+	}
+
+	if hits := index.Search(query, "missing", nil, 10); len(hits) != 0 {
+		t.Errorf("不存在的命名空间返回了 %d 个结果", len(hits))
+	}
+
+	allowed := map[string]struct{}{ids[3]: {}, ids[30]: {}, ids[300]: {}}
+	hits := index.Search(query, "", allowed, 10)
+	if len(hits) != len(allowed) {
+		t.Fatalf("限定候选 ID 时返回 %d 个结果，期望 %d", len(hits), len(allowed))
+	}
+	for _, h := range hits {
+		if _, ok := allowed[h.ID]; !ok {
+			t.Errorf("结果 %s 不在候选 ID 中", h.ID)
+		}
+	}
+
+	if hits := index.Search(query[:8], "", nil, 10); hits != nil {
+		t.Errorf("维度不一致时应返回空结果，实际 %d 个", len(hits))
+	}
+}
+
+func TestHNSWRemoveAndPersist(t *testing.T) {
+	g := newClusteredVectors(3, 16, 4)
+	index, ids, _ := buildTestIndex(t, g, 200, nil)
+
+	query := g.next()
+	top := index.Search(query, "", nil, 1)[0].ID
+	if !index.Remove(top) {
+		t.Fatalf("Remove(%s) 返回 false", top)
+	}
+	if index.Remove(top) {
+		t.Errorf("重复删除 %s 应返回 false", top)
+	}
+	for _, h := range index.Search(query, "", nil, 20) {
+		if h.ID == top {
+			t.Fatalf("已删除的 %s 仍出现在结果中", top)
+		}
+	}
+	if index.Len() != len(ids)-1 || index.TombstoneRatio() <= 0 {
+		t.Errorf("删除后 Len = %d，墓碑比例 = %.3f", index.Len(), index.TombstoneRatio())
+	}
+
+	path := filepath.Join(t.TempDir(), "index.gob")
+	if err := index.Save(path); err != nil {
+		t.Fatalf("Save 失败: %v", err)
+	}
+	if index.Dirty() {
+		t.Error("持久化后仍标记为有变更")
+	}
+	loaded, err := LoadHNSWIndex(path)
+	if err != nil {
+		t.Fatalf("LoadHNSWIndex 失败: %v", err)
+	}
+	if loaded.Model() != "test" || loaded.Len() != index.Len() {
+		t.Fatalf("加载后 Model = %s, Len = %d", loaded.Model(), loaded.Len())
+	}
+	want := index.Search(query, "", nil, 10)
+	got := loaded.Search(query, "", nil, 10)
+	for i := range want {
+		if got[i].ID != want[i].ID {
+			t.Fatalf("加载后第 %d 个结果为 %s，期望 %s", i, got[i].ID, want[i].ID)
+		}
+	}
+	if updatedAt, ok := loaded.UpdatedAt(ids[5]); !ok || updatedAt != 5 {
+		t.Errorf("UpdatedAt(%s) = %d, %v", ids[5], updatedAt, ok)
+	}
+}
+
+// BenchmarkHNSWSearch 在合成聚簇数据上对比 HNSW 与暴力检索的延迟，并报告 HNSW 的 recall@k
+func BenchmarkHNSWSearch(b *testing.B) {
+	const docs, dim, k = 10000, 512, DefaultTopK
+	g := newClusteredVectors(42, dim, 64)
+	index, ids, data := buildTestIndex(b, g, docs, nil)
+	queries := make([][]float64, 200)
+	for i := range queries {
+		queries[i] = g.next()
+	}
+
+	b.Run("hnsw", func(b *testing.B) {
+		var recall float64
+		for i := 0; i < b.N; i++ {
+			q := queries[i%len(queries)]
+			hits := index.Search(q, "", nil, k)
+			b.StopTimer()
+			recall += recallAt(hits, bruteForceTopK(q, ids, data, k))
+			b.StartTimer()
+		}
+		b.ReportMetric(recall/float64(b.N), "recall")
+	})
+	b.Run("brute_force", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			bruteForceTopK(queries[i%len(queries)], ids, data, k)
+		}
+	})
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"AiDemo/utils"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// hnswRebuildTombstoneRatio 墓碑节点超过该比例时启动重建
+const hnswRebuildTombstoneRatio = 0.3
+
+// VectorIndexer 支持增量更新的向量存储，知识片段写入或删除后同步索引
+type VectorIndexer interface {
+	Upsert(docs ...models.Knowledge)
+	Remove(ids ...string)
+}
+
+// HNSWVectorStore 基于内存 HNSW 索引的向量存储，索引只存放当前向量模型的片段，
+// 查询其他模型版本时退化为 SQLite 精确检索。变更在关闭时持久化，
+// 异常退出导致的缺失由下次启动时与数据库对账补齐
+type HNSWVectorStore struct {
+	index    *HNSWIndex
+	path     string
+	fallback VectorStore
+}
+
+// NewHNSWVectorStore 加载或重建索引，并与数据库对账
+func NewHNSWVectorStore(path, model string, params HNSWParams) (*HNSWVectorStore, error) {
+	index, err := LoadHNSWIndex(path)
+	switch {
+	case err == nil && index.Model() != model:
+		utils.Info("向量索引模型 %s 与当前模型 %s 不一致，重建索引", index.Model(), model)
+		index = nil
+	case err == nil && index.TombstoneRatio() > hnswRebuildTombstoneRatio:
+		utils.Info("向量索引已删除节点占比 %.0f%%，重建索引", index.TombstoneRatio()*100)
+		index = nil
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		utils.Warning("加载向量索引失败，重建索引: %v", err)
+	}
+	if index == nil {
+		index = NewHNSWIndex(model, params)
+	}
+
+	store := &HNSWVectorStore{
+		index:    index,
+		path:     path,
+		fallback: &SQLiteVectorStore{},
+	}
+
+	start := time.Now()
+	if err := store.reconcile(); err != nil {
+		return nil, err
+	}
+	utils.Info("向量索引已就绪: %d 个片段, 模型 %s, 耗时 %s", index.Len(), model, time.Since(start).Round(time.Millisecond))
+
+	if index.Dirty() {
+		if err := store.Persist(); err != nil {
+			utils.Warning("持久化向量索引失败: %v", err)
+		}
+	}
+	return store, nil
+}
+
+// Search 在索引中检索，命中后按 ID 回表读取片段内容
+func (s *HNSWVectorStore) Search(queryVec []float64, filter models.SearchFilter, topK int) ([]ScoredDoc, error) {
+	if filter.EmbeddingModel != s.index.Model() {
+		return s.fallback.Search(queryVec, filter, topK)
+	}
+	warnStaleVectors(filter.Namespace, filter.EmbeddingModel)
+
+	// 命名空间之外的条件先在 SQL 中求出候选 ID，索引只在该范围内检索
+	var allowed map[string]struct{}
+	if filter.HasMetadata() {
+		var err error
+		if allowed, err = filteredKnowledgeIDs(filter); err != nil {
+			return nil, err
+		}
+		if len(allowed) == 0 {
+			return []ScoredDoc{}, nil
+		}
+	}
+
+	hits := s.index.Search(queryVec, filter.Namespace, allowed, topK)
+	if len(hits) == 0 {
+		return []ScoredDoc{}, nil
+	}
+
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+	var docs []models.Knowledge
+	if err := config.DB.Where("id IN ?", ids).Find(&docs).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Knowledge, len(docs))
+	for _, d := range docs {
+		byID[d.ID] = d
+	}
+
+	scored := make([]ScoredDoc, 0, len(hits))
+	for _, h := range hits {
+		doc, ok := byID[h.ID]
+		if !ok || h.Score < MinSimilarityThreshold {
+			continue
+		}
+		scored = append(scored, ScoredDoc{Doc: doc, Score: h.Score, VectorScore: h.Score})
+	}
+	return scored, nil
+}
+
+// Upsert 写入或更新片段，向量模型不是索引模型的片段从索引中移除
+func (s *HNSWVectorStore) Upsert(docs ...models.Knowledge) {
+	for _, d := range docs {
+		if d.EmbeddingModel != s.index.Model() {
+			s.index.Remove(d.ID)
+			continue
+		}
+		var vec []float64
+		if err := json.Unmarshal([]byte(d.Vector), &vec); err != nil {
+			utils.Warning("片段 %s 向量解析失败，未加入索引: %v", d.ID, err)
+			continue
+		}
+		if err := s.index.Add(d.ID, d.Namespace, d.UpdatedAt.UnixNano(), vec); err != nil {
+			utils.Warning("片段 %s 加入索引失败: %v", d.ID, err)
+		}
+	}
+}
+
+// Remove 从索引中删除片段
+func (s *HNSWVectorStore) Remove(ids ...string) {
+	for _, id := range ids {
+		s.index.Remove(id)
+	}
+}
+
+// Persist 将索引写入磁盘
+func (s *HNSWVectorStore) Persist() error {
+	return s.index.Save(s.path)
+}
+
+// Index 返回底层索引
+func (s *HNSWVectorStore) Index() *HNSWIndex {
+	return s.index
+}
+
+// reconcile 与数据库对账：补充缺失或已更新的片段，移除数据库中已不存在的片段
+func (s *HNSWVectorStore) reconcile() error {
+	type row struct {
+		ID        string
+		UpdatedAt time.Time
+	}
+	var rows []row
+	if err := config.DB.Model(&models.Knowledge{}).Select("id", "updated_at").
+		Where("embedding_model = ?", s.index.Model()).Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	inDB := make(map[string]struct{}, len(rows))
+	var pending []string
+	for _, r := range rows {
+		inDB[r.ID] = struct{}{}
+		if updatedAt, ok := s.index.UpdatedAt(r.ID); !ok || updatedAt != r.UpdatedAt.UnixNano() {
+			pending = append(pending, r.ID)
+		}
+	}
+
+	removed := 0
+	for _, id := range s.index.IDs() {
+		if _, ok := inDB[id]; !ok {
+			s.index.Remove(id)
+			removed++
+		}
+	}
+
+	const batchSize = 500
+	for start := 0; start < len(pending); start += batchSize {
+		end := min(start+batchSize, len(pending))
+		var docs []models.Knowledge
+		if err := config.DB.Where("id IN ?", pending[start:end]).Find(&docs).Error; err != nil {
+			return err
+		}
+		s.Upsert(docs...)
+	}
+
+	if len(pending) > 0 || removed > 0 {
+		utils.Info("向量索引对账: 新增或更新 %d 个片段, 移除 %d 个片段", len(pending), removed)
+	}
+	return nil
+}
+
+// InitVectorStore 按配置初始化默认向量存储，需在数据库与向量化服务初始化之后调用
+func InitVectorStore() error {
+	if config.VectorIndex != "hnsw" {
+		defaultVectorStore = &SQLiteVectorStore{}
+		utils.Info("向量检索使用 SQLite 精确检索")
+		return nil
+	}
+
+	params := HNSWParams{
+		M:              config.HNSWM,
+		EfConstruction: config.HNSWEfConstruction,
+		EfSearch:       config.HNSWEfSearch,
+	}
+	store, err := NewHNSWVectorStore(config.VectorIndexPath, GetEmbeddingModelVersion(), params)
+	if err != nil {
+		return err
+	}
+	defaultVectorStore = store
+	return nil
+}
+
+// CloseVectorStore 持久化有变更的向量索引
+func CloseVectorStore() {
+	store, ok := defaultVectorStore.(*HNSWVectorStore)
+	if !ok || !store.index.Dirty() {
+		return
+	}
+	if err := store.Persist(); err != nil {
+		utils.Error("持久化向量索引失败: %v", err)
+		return
+	}
+	utils.Info("向量索引已持久化: %s", store.path)
+}
+
+// indexVectors 片段向量写入后同步到支持增量更新的向量存储
+func indexVectors(docs ...models.Knowledge) {
+	if indexer, ok := defaultVectorStore.(VectorIndexer); ok {
+		indexer.Upsert(docs...)
+	}
+}
+
+// unindexVectors 片段删除后从支持增量更新的向量存储中移除
+func unindexVectors(ids ...string) {
+	if indexer, ok := defaultVectorStore.(VectorIndexer); ok {
+		indexer.Remove(ids...)
+	}
+}
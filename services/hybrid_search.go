@@ -0,0 +1,122 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 检索模式
+const (
+	RetrievalModeVector  = "vector"  // 向量检索
+	RetrievalModeKeyword = "keyword" // BM25 关键词检索
+	RetrievalModeHybrid  = "hybrid"  // 两路检索后按 RRF 融合
+)
+
+// rrfK RRF 平滑常数，取论文中的经验值
+const rrfK = 60
+
+// RetrieveOptions 检索参数
+type RetrieveOptions struct {
+	Filter    models.SearchFilter // 检索前应用的元数据过滤，Namespace 为空时检索全部命名空间
+	TopK      int                 // <= 0 时使用 DefaultTopK
+	Mode      string              // vector / keyword / hybrid，为空时使用配置的默认模式
+	Reranker  string              // none / lexical / llm，为空时使用配置的默认重排器
+	Strategy  string              // 查询扩展策略：none / multi_query / hyde，为空时使用配置的默认策略
+	SessionID string              // 查询扩展与 llm 重排的用量计入的会话，为空时不关联会话
+
+	MMRLambda       *float64 // MMR 相关性权重，>= 1 时不做多样化，nil 时使用配置值
+	MaxChunksPerDoc *int     // 同一文档最多返回的片段数，<= 0 表示不限制，nil 时使用配置值
+}
+
+// ParseRetrievalMode 校验检索模式，为空时返回配置的默认模式
+func ParseRetrievalMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		mode = config.RetrievalMode
+	}
+	switch mode {
+	case RetrievalModeVector, RetrievalModeKeyword, RetrievalModeHybrid:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("不支持的检索模式: %s（可选 vector / keyword / hybrid）", mode)
+	}
+}
+
+// hybridCandidateDepth 混合检索时每一路召回的候选数，多取一些以便融合后仍有足够结果
+func hybridCandidateDepth(topK int) int {
+	return max(topK*4, 20)
+}
+
+// keywordSearch 关键词检索，命中后按 ID 回表读取片段。
+// 除命名空间外的过滤条件（含向量模型）先在 SQL 中求出候选 ID，再在索引中限定范围
+func keywordSearch(filter models.SearchFilter, query string, topK int) ([]ScoredDoc, error) {
+	var allowed map[string]struct{}
+	if filter.HasMetadata() || filter.EmbeddingModel != "" {
+		var err error
+		if allowed, err = filteredKnowledgeIDs(filter); err != nil {
+			return nil, err
+		}
+		if len(allowed) == 0 {
+			return []ScoredDoc{}, nil
+		}
+	}
+
+	hits := defaultKeywordIndex.Search(query, filter.Namespace, allowed, topK)
+	if len(hits) == 0 {
+		return []ScoredDoc{}, nil
+	}
+
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+	var docs []models.Knowledge
+	if err := config.DB.Where("id IN ?", ids).Find(&docs).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Knowledge, len(docs))
+	for _, d := range docs {
+		byID[d.ID] = d
+	}
+
+	scored := make([]ScoredDoc, 0, len(hits))
+	for _, h := range hits {
+		if doc, ok := byID[h.ID]; ok {
+			scored = append(scored, ScoredDoc{Doc: doc, Score: h.Score, KeywordScore: h.Score})
+		}
+	}
+	return scored, nil
+}
+
+// fuseRRF 倒数排名融合：score = Σ 1/(k + rank)，只依赖各路排名，无需对不同量纲的分数做归一化
+func fuseRRF(topK int, vectorDocs, keywordDocs []ScoredDoc) []ScoredDoc {
+	fused := map[string]*ScoredDoc{}
+	var order []string
+	add := func(docs []ScoredDoc, apply func(dst *ScoredDoc, src ScoredDoc)) {
+		for rank, d := range docs {
+			entry, ok := fused[d.Doc.ID]
+			if !ok {
+				entry = &ScoredDoc{Doc: d.Doc}
+				fused[d.Doc.ID] = entry
+				order = append(order, d.Doc.ID)
+			}
+			entry.Score += 1.0 / float64(rrfK+rank+1)
+			apply(entry, d)
+		}
+	}
+	add(vectorDocs, func(dst *ScoredDoc, src ScoredDoc) { dst.VectorScore = src.VectorScore })
+	add(keywordDocs, func(dst *ScoredDoc, src ScoredDoc) { dst.KeywordScore = src.KeywordScore })
+
+	result := make([]ScoredDoc, 0, len(order))
+	for _, id := range order {
+		result = append(result, *fused[id])
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Score > result[j].Score })
+	if len(result) > topK {
+		result = result[:topK]
+	}
+	return result
+}
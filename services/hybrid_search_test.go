@@ -0,0 +1,88 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"math"
+	"testing"
+)
+
+func TestParseRetrievalMode(t *testing.T) {
+	defer func(mode string) { config.RetrievalMode = mode }(config.RetrievalMode)
+	config.RetrievalMode = RetrievalModeVector
+
+	tests := []struct {
+		mode    string
+		want    string
+		wantErr bool
+	}{
+		{mode: "", want: RetrievalModeVector},
+		{mode: " Hybrid ", want: RetrievalModeHybrid},
+		{mode: "keyword", want: RetrievalModeKeyword},
+		{mode: "semantic", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRetrievalMode(tt.mode)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRetrievalMode(%q) = %q, %v，期望 %q", tt.mode, got, err, tt.want)
+		}
+	}
+}
+
+func TestFuseRRF(t *testing.T) {
+	doc := func(id string, vector, keyword float64) ScoredDoc {
+		return ScoredDoc{Doc: models.Knowledge{ID: id}, VectorScore: vector, KeywordScore: keyword}
+	}
+	rrf := func(ranks ...int) float64 {
+		var s float64
+		for _, r := range ranks {
+			s += 1.0 / float64(rrfK+r)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		topK    int
+		vector  []ScoredDoc
+		keyword []ScoredDoc
+		want    []ScoredDoc
+	}{
+		{
+			name:    "两路都命中的排在最前，同分保持先出现的顺序",
+			topK:    3,
+			vector:  []ScoredDoc{doc("a", 0.9, 0), doc("b", 0.8, 0), doc("c", 0.7, 0)},
+			keyword: []ScoredDoc{doc("c", 0, 5.1), doc("d", 0, 3.2)},
+			want: []ScoredDoc{
+				{Doc: models.Knowledge{ID: "c"}, Score: rrf(3, 1), VectorScore: 0.7, KeywordScore: 5.1},
+				{Doc: models.Knowledge{ID: "a"}, Score: rrf(1), VectorScore: 0.9},
+				{Doc: models.Knowledge{ID: "b"}, Score: rrf(2), VectorScore: 0.8},
+			},
+		},
+		{
+			name:    "只有关键词结果",
+			topK:    5,
+			keyword: []ScoredDoc{doc("x", 0, 2), doc("y", 0, 1)},
+			want: []ScoredDoc{
+				{Doc: models.Knowledge{ID: "x"}, Score: rrf(1), KeywordScore: 2},
+				{Doc: models.Knowledge{ID: "y"}, Score: rrf(2), KeywordScore: 1},
+			},
+		},
+		{name: "两路都为空", topK: 5, want: []ScoredDoc{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fuseRRF(tt.topK, tt.vector, tt.keyword)
+			if len(got) != len(tt.want) {
+				t.Fatalf("返回 %d 个结果，期望 %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, w := range tt.want {
+				g := got[i]
+				if g.Doc.ID != w.Doc.ID || math.Abs(g.Score-w.Score) > 1e-12 ||
+					g.VectorScore != w.VectorScore || g.KeywordScore != w.KeywordScore {
+					t.Errorf("第 %d 个结果 = %+v，期望 %+v", i, g, w)
+				}
+			}
+		})
+	}
+}
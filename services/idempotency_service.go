@@ -0,0 +1,127 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"AiDemo/utils"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// idempotencyPurgeInterval 过期幂等键的清理间隔
+const idempotencyPurgeInterval = 10 * time.Minute
+
+var (
+	// ErrIdempotencyKeyReused 幂等键已用于内容不同的请求
+	ErrIdempotencyKeyReused = errors.New("幂等键已用于不同的请求")
+	// ErrIdempotencyInProgress 相同幂等键的首次请求仍在处理中
+	ErrIdempotencyInProgress = errors.New("相同幂等键的请求正在处理中")
+)
+
+// IdempotencyService 幂等键服务：首次请求占用幂等键并在结束后保存响应，重复请求回放保存的响应
+type IdempotencyService struct{}
+
+// NewIdempotencyService 创建新的幂等键服务实例
+func NewIdempotencyService() *IdempotencyService {
+	return &IdempotencyService{}
+}
+
+// Begin 占用幂等键。首次使用时返回 nil，调用方处理请求后须调用 Complete；
+// 已有完成的记录时返回该记录供回放。已过期但尚未被清理的记录视为不存在
+func (s *IdempotencyService) Begin(key, requestHash string) (*models.IdempotencyRecord, error) {
+	var record models.IdempotencyRecord
+	for attempt := 0; ; attempt++ {
+		res := config.DB.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.IdempotencyRecord{Key: key, RequestHash: requestHash})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected > 0 {
+			return nil, nil
+		}
+
+		if err := config.DB.Where("key = ?", key).First(&record).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// 首次请求恰好失败并释放了幂等键
+				return nil, ErrIdempotencyInProgress
+			}
+			return nil, err
+		}
+		if attempt > 0 || !idempotencyExpired(record) {
+			break
+		}
+		// 删除过期记录后重新占用；按创建时间限定，避免删掉其他请求刚写入的记录
+		err := config.DB.Where("key = ? AND created_at = ?", key, record.CreatedAt).
+			Delete(&models.IdempotencyRecord{}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case record.RequestHash != requestHash:
+		return nil, ErrIdempotencyKeyReused
+	case record.StatusCode == 0:
+		return nil, ErrIdempotencyInProgress
+	}
+	return &record, nil
+}
+
+// PurgeExpired 删除超过 IDEMPOTENCY_TTL 的幂等键，返回删除的条数
+func (s *IdempotencyService) PurgeExpired() (int64, error) {
+	if config.IdempotencyTTL <= 0 {
+		return 0, nil
+	}
+	res := config.DB.Where("created_at < ?", time.Now().Add(-config.IdempotencyTTL)).
+		Delete(&models.IdempotencyRecord{})
+	return res.RowsAffected, res.Error
+}
+
+// StartIdempotencyPurge 启动后台清理：启动时及此后每隔 idempotencyPurgeInterval 删除过期的幂等键，ctx 结束时停止
+func StartIdempotencyPurge(ctx context.Context) {
+	if config.IdempotencyTTL <= 0 {
+		return
+	}
+	svc := NewIdempotencyService()
+	go func() {
+		ticker := time.NewTicker(idempotencyPurgeInterval)
+		defer ticker.Stop()
+		for {
+			if n, err := svc.PurgeExpired(); err != nil {
+				utils.Error("清理过期幂等键失败: %v", err)
+			} else if n > 0 {
+				utils.Info("已清理过期幂等键: %d 个", n)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// idempotencyExpired 幂等键是否已超过 IDEMPOTENCY_TTL
+func idempotencyExpired(record models.IdempotencyRecord) bool {
+	return config.IdempotencyTTL > 0 && time.Since(record.CreatedAt) > config.IdempotencyTTL
+}
+
+// Complete 保存首次请求的响应。5xx 响应不保存并释放幂等键，客户端可用同一幂等键重试
+func (s *IdempotencyService) Complete(key string, statusCode int, contentType string, body []byte) {
+	var err error
+	if statusCode >= 500 || statusCode == 0 {
+		err = config.DB.Where("key = ?", key).Delete(&models.IdempotencyRecord{}).Error
+	} else {
+		err = config.DB.Model(&models.IdempotencyRecord{}).Where("key = ?", key).Updates(map[string]interface{}{
+			"status_code":  statusCode,
+			"content_type": contentType,
+			"response":     string(body),
+		}).Error
+	}
+	if err != nil {
+		utils.Error("保存幂等键 %s 的响应失败: %v", key, err)
+	}
+}
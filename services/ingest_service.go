@@ -0,0 +1,354 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"AiDemo/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// IngestMaxAttempts 执行中被重启打断的任务最多续跑的次数，超过后标记为失败
+	IngestMaxAttempts = 3
+
+	// ingestPollInterval worker 空闲时轮询排队任务的间隔（提交任务时会立即唤醒）
+	ingestPollInterval = 5 * time.Second
+)
+
+// ingestWake 唤醒空闲 worker 的信号
+var ingestWake = make(chan struct{}, 1)
+
+// IngestService 异步入库服务：任务持久化在数据库中，由进程内的 worker 按提交顺序执行。
+// 文档与片段写入和任务完成标记在同一事务中提交，任务中断后重新执行即可，不会重复入库
+type IngestService struct {
+	documentService *DocumentService
+}
+
+// NewIngestService 创建新的异步入库服务实例
+func NewIngestService() *IngestService {
+	return &IngestService{
+		documentService: NewDocumentService(),
+	}
+}
+
+// Submit 提交新建文档任务，文档 ID 在提交时分配，立即返回排队中的任务。
+// 同一命名空间下已有相同内容的文档时不再排队，返回已完成的重复任务及已有文档与片段
+func (s *IngestService) Submit(in KnowledgeInput) (*models.IngestJob, error) {
+	job, err := s.prepare(in)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.enqueue(job); err != nil {
+		return nil, err
+	}
+	if job.Duplicate {
+		if job.Document, err = s.documentService.Get(job.DocumentID); err != nil {
+			return nil, err
+		}
+		utils.Info("命名空间 %s 下已有相同内容的文档 %s，跳过入库", in.Namespace, job.DocumentID)
+	}
+	return job, nil
+}
+
+// SubmitReplace 提交整体替换文档的任务；来源与命名空间为空时沿用原值。
+// 替换内容与同一命名空间下的其他文档相同时不再排队，与 Submit 一样返回已完成的重复任务及已有文档与片段
+func (s *IngestService) SubmitReplace(id string, in KnowledgeInput) (*models.IngestJob, error) {
+	var doc models.Document
+	if err := config.DB.Select("id", "namespace").Where("id = ?", id).First(&doc).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+	if in.Namespace == "" {
+		in.Namespace = doc.Namespace
+	}
+	existing, err := findDuplicateDocument(config.DB, in.Namespace, contentHash(in.Content), id)
+	if err != nil {
+		return nil, err
+	}
+	var job *models.IngestJob
+	if existing != nil {
+		job = duplicateIngestJob(models.IngestKindReplace, existing, in)
+	} else if job, err = newIngestJob(models.IngestKindReplace, id, in); err != nil {
+		return nil, err
+	}
+	if err := s.enqueue(job); err != nil {
+		return nil, err
+	}
+	if job.Duplicate {
+		if job.Document, err = s.documentService.Get(job.DocumentID); err != nil {
+			return nil, err
+		}
+		utils.Info("文档 %s 的替换内容与命名空间 %s 下的文档 %s 相同，跳过替换", id, in.Namespace, job.DocumentID)
+	}
+	return job, nil
+}
+
+// prepare 构造新建文档任务（尚未持久化）：同一命名空间下已有相同内容时构造已完成的重复任务
+func (s *IngestService) prepare(in KnowledgeInput) (*models.IngestJob, error) {
+	existing, err := findDuplicateDocument(config.DB, in.Namespace, contentHash(in.Content), "")
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return newIngestJob(models.IngestKindCreate, generateDocumentID(), in)
+	}
+	return duplicateIngestJob(models.IngestKindCreate, existing, in), nil
+}
+
+// duplicateIngestJob 构造指向已有文档的已完成重复任务
+func duplicateIngestJob(kind string, existing *models.Document, in KnowledgeInput) *models.IngestJob {
+	now := time.Now()
+	return &models.IngestJob{
+		Kind:            kind,
+		Status:          models.IngestStatusCompleted,
+		DocumentID:      existing.ID,
+		Duplicate:       true,
+		Title:           in.Title,
+		Namespace:       in.Namespace,
+		TotalChunks:     existing.ChunkCount,
+		ProcessedChunks: existing.ChunkCount,
+		FinishedAt:      &now,
+	}
+}
+
+// newIngestJob 校验入库参数并构造排队中的任务，参数错误在提交时返回，不进入队列
+func newIngestJob(kind, documentID string, in KnowledgeInput) (*models.IngestJob, error) {
+	if _, err := NewChunker(in.Chunking); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(in.Content) == "" {
+		return nil, ErrEmptyContent
+	}
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.IngestJob{
+		Kind:       kind,
+		Status:     models.IngestStatusQueued,
+		DocumentID: documentID,
+		Title:      in.Title,
+		Namespace:  in.Namespace,
+		Payload:    string(payload),
+	}, nil
+}
+
+// enqueue 在一条插入语句中持久化一批任务并唤醒 worker
+func (s *IngestService) enqueue(jobs ...*models.IngestJob) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	if err := config.DB.Create(jobs).Error; err != nil {
+		return err
+	}
+	wakeIngestWorkers()
+	return nil
+}
+
+// GetJob 根据 ID 获取入库任务
+func (s *IngestService) GetJob(id uint) (*models.IngestJob, error) {
+	var job models.IngestJob
+	if err := config.DB.First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// StartIngestWorkers 将上次执行中被打断的任务重新排队，并启动 n 个 worker，ctx 取消时退出
+func StartIngestWorkers(ctx context.Context, n int) error {
+	if n <= 0 {
+		n = 1
+	}
+	if err := requeueInterruptedIngestJobs(); err != nil {
+		return err
+	}
+
+	s := NewIngestService()
+	for i := 0; i < n; i++ {
+		go s.work(ctx)
+	}
+	wakeIngestWorkers()
+	utils.Info("入库任务 worker 已启动: %d 个", n)
+	return nil
+}
+
+// requeueInterruptedIngestJobs 重启后续跑执行中的任务，超过次数上限的标记为失败
+func requeueInterruptedIngestJobs() error {
+	now := time.Now()
+	err := config.DB.Model(&models.IngestJob{}).
+		Where("status = ? AND attempts >= ?", models.IngestStatusRunning, IngestMaxAttempts).
+		UpdateColumns(map[string]interface{}{
+			"status":      models.IngestStatusFailed,
+			"error":       "任务多次被中断，已放弃执行",
+			"payload":     "",
+			"finished_at": now,
+			"updated_at":  now,
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	res := config.DB.Model(&models.IngestJob{}).Where("status = ?", models.IngestStatusRunning).
+		UpdateColumns(map[string]interface{}{"status": models.IngestStatusQueued, "updated_at": now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		utils.Info("发现 %d 个未完成的入库任务，重新排队", res.RowsAffected)
+	}
+	return nil
+}
+
+// wakeIngestWorkers 通知空闲 worker 领取任务
+func wakeIngestWorkers() {
+	select {
+	case ingestWake <- struct{}{}:
+	default:
+	}
+}
+
+// work worker 主循环：领取最早的排队任务执行，没有任务时等待唤醒或定时轮询
+func (s *IngestService) work(ctx context.Context) {
+	ticker := time.NewTicker(ingestPollInterval)
+	defer ticker.Stop()
+
+	for ctx.Err() == nil {
+		job, err := s.claim()
+		if err != nil {
+			utils.Error("领取入库任务失败: %v", err)
+		}
+		if job != nil {
+			// 队列中可能还有任务，交给其他空闲 worker
+			wakeIngestWorkers()
+			s.execute(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-ingestWake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim 领取最早的排队任务，通过带状态条件的更新保证同一任务只被一个 worker 领取
+func (s *IngestService) claim() (*models.IngestJob, error) {
+	for {
+		var job models.IngestJob
+		err := config.DB.Where("status = ?", models.IngestStatusQueued).Order("id").First(&job).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		now := time.Now()
+		res := config.DB.Model(&models.IngestJob{}).
+			Where("id = ? AND status = ?", job.ID, models.IngestStatusQueued).
+			UpdateColumns(map[string]interface{}{
+				"status":           models.IngestStatusRunning,
+				"attempts":         gorm.Expr("attempts + 1"),
+				"error":            "",
+				"processed_chunks": 0, // 重新执行时从头向量化，进度随之清零
+				"started_at":       now,
+				"updated_at":       now,
+			})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+
+		job.Status = models.IngestStatusRunning
+		job.Attempts++
+		job.ProcessedChunks = 0
+		job.StartedAt = &now
+		return &job, nil
+	}
+}
+
+// execute 执行入库任务：向量化进度按批持久化，完成标记随文档写入同一事务提交
+func (s *IngestService) execute(ctx context.Context, job *models.IngestJob) {
+	utils.Info("入库任务 #%d 开始: 类型=%s, 文档=%s, 第 %d 次执行", job.ID, job.Kind, job.DocumentID, job.Attempts)
+
+	var in KnowledgeInput
+	if err := json.Unmarshal([]byte(job.Payload), &in); err != nil {
+		s.fail(job, err)
+		return
+	}
+
+	progress := func(processed, total int) {
+		err := config.DB.Model(&models.IngestJob{}).Where("id = ?", job.ID).UpdateColumns(map[string]interface{}{
+			"total_chunks":     total,
+			"processed_chunks": processed,
+			"updated_at":       time.Now(),
+		}).Error
+		if err != nil {
+			utils.Error("保存入库任务 #%d 进度失败: %v", job.ID, err)
+		}
+	}
+	finish := func(tx *gorm.DB, doc *models.Document) error {
+		now := time.Now()
+		return tx.Model(&models.IngestJob{}).Where("id = ?", job.ID).UpdateColumns(map[string]interface{}{
+			"status":           models.IngestStatusCompleted,
+			"document_id":      doc.ID,
+			"duplicate":        doc.ID != job.DocumentID,
+			"total_chunks":     doc.ChunkCount,
+			"processed_chunks": doc.ChunkCount,
+			"payload":          "",
+			"finished_at":      now,
+			"updated_at":       now,
+		}).Error
+	}
+
+	var doc *models.Document
+	var chunks []*models.Knowledge
+	var err error
+	if job.Kind == models.IngestKindReplace {
+		doc, chunks, err = s.documentService.replace(ctx, job.DocumentID, in, progress, finish)
+	} else {
+		doc, chunks, _, err = saveDocument(ctx, job.DocumentID, in, progress, finish)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			// 服务退出导致的中断，重新排队等待下次启动续跑
+			s.update(job, map[string]interface{}{"status": models.IngestStatusQueued})
+			utils.Warning("入库任务 #%d 被中断，已重新排队: %v", job.ID, err)
+			return
+		}
+		s.fail(job, err)
+		return
+	}
+	utils.Info("入库任务 #%d 完成: 文档 %s, %d 个片段", job.ID, doc.ID, len(chunks))
+}
+
+// fail 标记任务失败并清空入库参数
+func (s *IngestService) fail(job *models.IngestJob, err error) {
+	s.update(job, map[string]interface{}{
+		"status":      models.IngestStatusFailed,
+		"error":       err.Error(),
+		"payload":     "",
+		"finished_at": time.Now(),
+	})
+	utils.Error("入库任务 #%d 失败: %v", job.ID, err)
+}
+
+// update 更新任务状态字段
+func (s *IngestService) update(job *models.IngestJob, fields map[string]interface{}) {
+	fields["updated_at"] = time.Now()
+	if err := config.DB.Model(&models.IngestJob{}).Where("id = ?", job.ID).UpdateColumns(fields).Error; err != nil {
+		utils.Error("更新入库任务 #%d 状态失败: %v", job.ID, err)
+	}
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"AiDemo/utils"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// ImportBatchSize JSONL 导入时每批处理的记录数，排队的入库任务按批写入
+	ImportBatchSize = 50
+
+	// exportBatchSize JSONL 导出时每批读取的文档数
+	exportBatchSize = 100
+
+	// DefaultImportSource 导入记录未指定来源时使用的来源
+	DefaultImportSource = "import"
+
+	// defaultImportMaxLineBytes 未配置 IMPORT_MAX_LINE_MB 时单行记录的大小上限
+	defaultImportMaxLineBytes = 16 << 20
+)
+
+// ErrImportLineTooLong JSONL 导入时单行记录超过大小上限
+var ErrImportLineTooLong = errors.New("单行记录过大")
+
+// ImportOptions JSONL 导入选项
+type ImportOptions struct {
+	Namespace string // 记录未指定命名空间时使用，为空时为 default
+	Wait      bool   // 在当前 goroutine 中同步切分与向量化（命令行使用），否则提交异步入库任务
+}
+
+// importLine 已读取的一行记录
+type importLine struct {
+	number int
+	record models.KnowledgeRecord
+	err    error
+}
+
+// KnowledgeIOService 知识库 JSONL 导入导出服务：一行一个文档，导出结果可直接导入其他环境
+type KnowledgeIOService struct {
+	ingestService *IngestService
+}
+
+// NewKnowledgeIOService 创建新的知识库导入导出服务实例
+func NewKnowledgeIOService() *KnowledgeIOService {
+	return &KnowledgeIOService{
+		ingestService: NewIngestService(),
+	}
+}
+
+// Import 流式读取 JSONL 并按批入库。带有当前向量模型向量的记录直接写入，其余记录走切分与向量化流程；
+// 单行解析或入库失败只记录在该行结果中，读取失败或 ctx 取消时返回已处理部分的结果与错误
+func (s *KnowledgeIOService) Import(ctx context.Context, r io.Reader, opts ImportOptions) (*models.ImportSummary, error) {
+	if opts.Namespace == "" {
+		opts.Namespace = "default"
+	}
+	summary := &models.ImportSummary{Results: []models.ImportLineResult{}}
+	reader := bufio.NewReader(r)
+	maxLine := importMaxLineBytes()
+
+	var batch []importLine
+	number := 0
+	for {
+		line, tooLong, readErr := readImportLine(reader, maxLine)
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return summary, readErr
+		}
+		if tooLong {
+			number++
+			batch = append(batch, importLine{
+				number: number,
+				err:    fmt.Errorf("%w: 超过 %d 字节", ErrImportLineTooLong, maxLine),
+			})
+		} else if len(line) > 0 {
+			number++
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				item := importLine{number: number}
+				item.err = json.Unmarshal(line, &item.record)
+				batch = append(batch, item)
+			}
+		}
+
+		if len(batch) >= ImportBatchSize || (readErr != nil && len(batch) > 0) {
+			if err := ctx.Err(); err != nil {
+				return summary, err
+			}
+			s.importBatch(ctx, batch, opts, summary)
+			utils.Info("JSONL 导入进度: 已处理 %d 行", number)
+			batch = batch[:0]
+		}
+		if readErr != nil {
+			return summary, nil
+		}
+	}
+}
+
+// importMaxLineBytes 返回 JSONL 导入时单行记录的大小上限（字节）
+func importMaxLineBytes() int {
+	if config.ImportMaxLineMB > 0 {
+		return config.ImportMaxLineMB << 20
+	}
+	return defaultImportMaxLineBytes
+}
+
+// readImportLine 读取一行（含换行符）。行长超过 maxLine 时丢弃该行剩余内容并返回 tooLong，
+// 内存占用不超过 maxLine 加一个读缓冲区
+func readImportLine(reader *bufio.Reader, maxLine int) (line []byte, tooLong bool, err error) {
+	for {
+		var frag []byte
+		frag, err = reader.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(bytes.TrimRight(frag, "\r\n")) > maxLine {
+				tooLong, line = true, nil
+			} else {
+				line = append(line, frag...)
+			}
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return line, tooLong, err
+		}
+	}
+}
+
+// importBatch 处理一批记录，排队的入库任务在一条插入语句中提交
+func (s *KnowledgeIOService) importBatch(ctx context.Context, batch []importLine, opts ImportOptions, summary *models.ImportSummary) {
+	start := len(summary.Results)
+	var jobs []*models.IngestJob
+	var jobIndexes []int
+
+	for _, item := range batch {
+		result := models.ImportLineResult{Line: item.number, Title: item.record.Title}
+		if err := s.importRecord(ctx, item, opts, &result, &jobs); err != nil {
+			result.Error = err.Error()
+		} else if len(jobs) > len(jobIndexes) {
+			jobIndexes = append(jobIndexes, len(summary.Results))
+		}
+		summary.Results = append(summary.Results, result)
+	}
+
+	if err := s.ingestService.enqueue(jobs...); err != nil {
+		for _, i := range jobIndexes {
+			summary.Results[i].Error = "提交入库任务失败: " + err.Error()
+		}
+	} else {
+		for n, i := range jobIndexes {
+			summary.Results[i].JobID = jobs[n].ID
+			summary.Results[i].DocumentID = jobs[n].DocumentID
+			summary.Results[i].Duplicate = jobs[n].Duplicate
+		}
+	}
+
+	for _, result := range summary.Results[start:] {
+		summary.Total++
+		switch {
+		case result.Error != "":
+			summary.Failed++
+			utils.Warning("JSONL 导入第 %d 行失败: %s", result.Line, result.Error)
+		case result.Duplicate:
+			summary.Duplicates++
+		case result.JobID != 0:
+			summary.Queued++
+		default:
+			summary.Imported++
+		}
+	}
+}
+
+// importRecord 处理单行记录：直接写入时填充 result，需要排队时将任务追加到 jobs
+func (s *KnowledgeIOService) importRecord(ctx context.Context, item importLine, opts ImportOptions, result *models.ImportLineResult, jobs *[]*models.IngestJob) error {
+	if errors.Is(item.err, ErrImportLineTooLong) {
+		return item.err
+	}
+	if item.err != nil {
+		return fmt.Errorf("JSON 格式错误: %w", item.err)
+	}
+	rec := item.record
+	if strings.TrimSpace(rec.Title) == "" || strings.TrimSpace(rec.Content) == "" {
+		return errors.New("title 与 content 不能为空")
+	}
+	in := KnowledgeInput{
+		Title:     rec.Title,
+		Content:   rec.Content,
+		Source:    rec.Source,
+		Namespace: rec.Namespace,
+		Tags:      rec.Tags,
+		Metadata:  rec.Metadata,
+	}
+	if in.Source == "" {
+		in.Source = DefaultImportSource
+	}
+	if in.Namespace == "" {
+		in.Namespace = opts.Namespace
+	}
+
+	if chunks, ok := reusableChunks(rec.Chunks); ok {
+		doc := newDocument(generateDocumentID(), in)
+		knowledges := make([]*models.Knowledge, len(chunks))
+		for i, c := range chunks {
+			vecBytes, err := json.Marshal(c.Vector)
+			if err != nil {
+				return err
+			}
+			knowledges[i] = newChunk(doc, i, Chunk{Content: c.Content, HeadingPath: c.HeadingPath}, string(vecBytes), c.EmbeddingModel)
+		}
+		stored, _, duplicate, err := storeDocument(doc, knowledges, nil)
+		if err != nil {
+			return err
+		}
+		result.DocumentID, result.Duplicate = stored.ID, duplicate
+		return nil
+	}
+
+	if opts.Wait {
+		doc, _, duplicate, err := saveDocument(ctx, generateDocumentID(), in, nil, nil)
+		if err != nil {
+			return err
+		}
+		result.DocumentID, result.Duplicate = doc.ID, duplicate
+		return nil
+	}
+
+	job, err := s.ingestService.prepare(in)
+	if err != nil {
+		return err
+	}
+	*jobs = append(*jobs, job)
+	return nil
+}
+
+// reusableChunks 记录中的片段均带有当前向量模型生成的向量时可直接写入，无需重新向量化
+func reusableChunks(chunks []models.RecordChunk) ([]models.RecordChunk, bool) {
+	if len(chunks) == 0 {
+		return nil, false
+	}
+	active := GetEmbeddingModelVersion()
+	for _, c := range chunks {
+		if c.EmbeddingModel != active || len(c.Vector) == 0 || strings.TrimSpace(c.Content) == "" {
+			return nil, false
+		}
+	}
+	return chunks, true
+}
+
+// Export 按文档 ID 顺序将文档流式写出为 JSONL，namespace 为空时导出全部命名空间；
+// includeVectors 时每条记录附带按顺序排列的片段及向量。返回写出的文档数
+func (s *KnowledgeIOService) Export(ctx context.Context, w io.Writer, namespace string, includeVectors bool) (int, error) {
+	db := config.DB.Model(&models.Document{})
+	if namespace != "" {
+		db = db.Where("namespace = ?", namespace)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	count := 0
+	var docs []models.Document
+	res := db.FindInBatches(&docs, exportBatchSize, func(tx *gorm.DB, batch int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		chunks := map[string][]models.RecordChunk{}
+		if includeVectors {
+			var err error
+			if chunks, err = exportChunks(docs); err != nil {
+				return err
+			}
+		}
+
+		for _, doc := range docs {
+			rec := models.KnowledgeRecord{
+				ID:        doc.ID,
+				Title:     doc.Title,
+				Content:   doc.Content,
+				Source:    doc.Source,
+				Namespace: doc.Namespace,
+				Tags:      doc.Tags,
+				Metadata:  doc.Metadata,
+				Chunks:    chunks[doc.ID],
+			}
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+			count++
+		}
+		if f, ok := w.(interface{ Flush() }); ok {
+			f.Flush()
+		}
+		return nil
+	})
+	return count, res.Error
+}
+
+// exportChunks 读取一批文档的片段及向量，按文档 ID 分组并保持片段顺序
+func exportChunks(docs []models.Document) (map[string][]models.RecordChunk, error) {
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	var rows []models.Knowledge
+	err := config.DB.Select("document_id", "content", "heading_path", "embedding_model", "vector").
+		Where("document_id IN ?", ids).Order("document_id, chunk_index").Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make(map[string][]models.RecordChunk, len(docs))
+	for _, k := range rows {
+		var vec []float64
+		if k.Vector != "" {
+			if err := json.Unmarshal([]byte(k.Vector), &vec); err != nil {
+				return nil, fmt.Errorf("片段向量格式错误（文档 %s）: %w", k.DocumentID, err)
+			}
+		}
+		chunks[k.DocumentID] = append(chunks[k.DocumentID], models.RecordChunk{
+			Content:        k.Content,
+			HeadingPath:    k.HeadingPath,
+			EmbeddingModel: k.EmbeddingModel,
+			Vector:         vec,
+		})
+	}
+	return chunks, nil
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"AiDemo/config"
+	"bufio"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestReadImportLine(t *testing.T) {
+	long := strings.Repeat("x", 64)
+	input := "short\n" + long + "\n" + long[:32] + "\r\n" + "tail"
+	// 读缓冲区小于单行长度，超长行需跨多次 ReadSlice 丢弃
+	reader := bufio.NewReaderSize(strings.NewReader(input), 16)
+
+	tests := []struct {
+		name        string
+		wantLine    string
+		wantTooLong bool
+	}{
+		{name: "普通行", wantLine: "short\n"},
+		{name: "超过上限的行", wantTooLong: true},
+		{name: "恰好等于上限的行", wantLine: long[:32] + "\r\n"},
+		{name: "末尾无换行的行", wantLine: "tail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, tooLong, err := readImportLine(reader, 32)
+			if err != nil && tt.wantLine != "tail" {
+				t.Fatalf("readImportLine 错误: %v", err)
+			}
+			if tooLong != tt.wantTooLong || string(line) != tt.wantLine {
+				t.Errorf("readImportLine = (%q, %v)，期望 (%q, %v)", line, tooLong, tt.wantLine, tt.wantTooLong)
+			}
+		})
+	}
+}
+
+func TestImportLineTooLong(t *testing.T) {
+	old := config.ImportMaxLineMB
+	config.ImportMaxLineMB = 1
+	t.Cleanup(func() { config.ImportMaxLineMB = old })
+
+	// 超长行与校验失败的行都只记入该行结果，不中断后续行
+	input := `{"title": "", "content": "缺少标题"}` + "\n" +
+		`{"title": "超长", "content": "` + strings.Repeat("长", 1<<19) + `"}` + "\n" +
+		"\n" +
+		`{"title": "缺少内容"}` + "\n"
+	summary, err := NewKnowledgeIOService().Import(context.Background(), strings.NewReader(input), ImportOptions{})
+	if err != nil {
+		t.Fatalf("Import 返回错误: %v", err)
+	}
+	if summary.Total != 3 || summary.Failed != 3 {
+		t.Fatalf("Total=%d Failed=%d，期望 3 行全部失败", summary.Total, summary.Failed)
+	}
+	wantLines := []int{1, 2, 4}
+	for i, result := range summary.Results {
+		if result.Line != wantLines[i] {
+			t.Errorf("第 %d 个结果行号 = %d，期望 %d", i, result.Line, wantLines[i])
+		}
+	}
+	if got := summary.Results[1].Error; !strings.HasPrefix(got, ErrImportLineTooLong.Error()) {
+		t.Errorf("超长行错误 = %q，期望以 %q 开头", got, ErrImportLineTooLong.Error())
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"AiDemo/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeoutError 上游调用超过截止时间
+type TimeoutError struct {
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return "大模型服务调用超时: " + e.Err.Error()
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// CanceledError 上游调用被取消（通常是客户端已断开）
+type CanceledError struct {
+	Err error
+}
+
+func (e *CanceledError) Error() string {
+	return "大模型服务调用已取消: " + e.Err.Error()
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// wrapContextError 将 context 超时/取消转换为对应的错误类型，其余错误原样返回
+func wrapContextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return &TimeoutError{Err: err}
+	case errors.Is(ctx.Err(), context.Canceled), errors.Is(err, context.Canceled):
+		return &CanceledError{Err: err}
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return &TimeoutError{Err: err}
+	}
+	return err
+}
+
+// withTimeout 为单次上游调用附加截止时间，d 为 0 时不限制
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// UpstreamError 上游返回的非 200 响应，字段取自提供方的错误响应体
+type UpstreamError struct {
+	StatusCode int           // HTTP 状态码
+	Code       string        // 提供方错误码
+	Type       string        // 提供方错误类型
+	Message    string        // 提供方错误描述
+	RetryAfter time.Duration // Retry-After 响应头给出的等待时间
+}
+
+func (e *UpstreamError) Error() string {
+	msg := fmt.Sprintf("上游返回错误 %d", e.StatusCode)
+	if e.Code != "" {
+		msg += " [" + e.Code + "]"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Retryable 限流与服务端错误可以重试
+func (e *UpstreamError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// CircuitOpenError 熔断器处于打开状态，调用被直接拒绝
+type CircuitOpenError struct {
+	Name       string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("大模型服务 %s 熔断中，请 %.0f 秒后重试", e.Name, math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// parseUpstreamError 从非 200 响应中解析错误信息
+func parseUpstreamError(resp *http.Response, body []byte) *UpstreamError {
+	upErr := &UpstreamError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	var errBody models.APIErrorBody
+	if err := json.Unmarshal(body, &errBody); err == nil && len(errBody.Error) > 0 {
+		var detail models.APIErrorDetail
+		var text string
+		if err := json.Unmarshal(errBody.Error, &detail); err == nil {
+			upErr.Message = detail.Message
+			upErr.Type = detail.Type
+			upErr.Code = strings.Trim(string(detail.Code), `"`)
+			if upErr.Code == "null" {
+				upErr.Code = ""
+			}
+		} else if err := json.Unmarshal(errBody.Error, &text); err == nil {
+			upErr.Message = text
+		}
+	}
+
+	// 无法识别的错误体，截取原文作为描述
+	if upErr.Message == "" {
+		raw := strings.TrimSpace(string(body))
+		if len([]rune(raw)) > 200 {
+			raw = string([]rune(raw)[:200]) + "..."
+		}
+		if raw == "" {
+			raw = http.StatusText(resp.StatusCode)
+		}
+		upErr.Message = raw
+	}
+	return upErr
+}
+
+// parseRetryAfter 解析 Retry-After 头，支持秒数与 HTTP 日期两种格式
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// DefaultLocalEmbeddingDim 本地向量化的默认维度
+const DefaultLocalEmbeddingDim = 512
+
+// 各类特征的权重：中文以二元组为主、单字为辅；英文以整词为主、字符三元组兜底拼写变体
+const (
+	cjkUnigramWeight  = 0.5
+	cjkBigramWeight   = 1.0
+	wordWeight        = 1.0
+	wordTrigramWeight = 0.3
+	stopCharWeight    = 0.1
+)
+
+// stopChars 高频虚词，近似 IDF 的降权，避免"的""了"之类的字主导相似度
+var stopChars = map[rune]bool{
+	'的': true, '了': true, '是': true, '在': true, '和': true, '有': true, '我': true,
+	'你': true, '他': true, '她': true, '它': true, '们': true, '这': true, '那': true,
+	'也': true, '就': true, '都': true, '而': true, '及': true, '与': true, '或': true,
+	'个': true, '一': true, '不': true, '吗': true, '呢': true, '吧': true, '啊': true,
+	'之': true, '其': true, '为': true, '被': true, '把': true, '从': true, '对': true,
+}
+
+// LocalEmbedder 无需联网的本地向量化：字符 n-gram 特征哈希到固定维度，
+// 词频取对数（次线性 TF），每个特征按哈希值带正负号以抵消碰撞偏差，最后做 L2 归一化。
+// 中文按单字与相邻二元组切分，英文按整词与带边界的字符三元组切分
+type LocalEmbedder struct {
+	dim int
+}
+
+// NewLocalEmbedder 创建本地向量化服务，dim <= 0 时使用默认维度
+func NewLocalEmbedder(dim int) *LocalEmbedder {
+	if dim <= 0 {
+		dim = DefaultLocalEmbeddingDim
+	}
+	return &LocalEmbedder{dim: dim}
+}
+
+// Name 提供方名称
+func (e *LocalEmbedder) Name() string {
+	return "local"
+}
+
+// Version 模型版本标识，包含算法版本与维度
+func (e *LocalEmbedder) Version() string {
+	return fmt.Sprintf("local-ngram-v1-d%d", e.dim)
+}
+
+// Dimension 向量维度
+func (e *LocalEmbedder) Dimension() int {
+	return e.dim
+}
+
+// Embed 批量向量化
+func (e *LocalEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vecs := make([][]float64, 0, len(texts))
+	for _, t := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, wrapContextError(ctx, err)
+		}
+		vecs = append(vecs, e.embed(t))
+	}
+	return vecs, nil
+}
+
+// embed 单条文本向量化
+func (e *LocalEmbedder) embed(text string) []float64 {
+	vec := make([]float64, e.dim)
+	for feature, weight := range extractFeatures(text) {
+		idx, sign := e.bucket(feature)
+		vec[idx] += sign * weight
+	}
+
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	if norm == 0 {
+		return vec
+	}
+	norm = math.Sqrt(norm)
+	for i := range vec {
+		vec[i] /= norm
+	}
+	return vec
+}
+
+// bucket 计算特征所在维度与符号
+func (e *LocalEmbedder) bucket(feature string) (int, float64) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(feature))
+	sum := h.Sum64()
+	sign := 1.0
+	if sum>>63 == 1 {
+		sign = -1.0
+	}
+	return int(sum % uint64(e.dim)), sign
+}
+
+// extractFeatures 提取特征并计算权重：权重 = 特征类型权重 × (1 + ln(词频))
+func extractFeatures(text string) map[string]float64 {
+	counts := map[string]int{}
+	weights := map[string]float64{}
+	add := func(feature string, weight float64) {
+		counts[feature]++
+		weights[feature] = weight
+	}
+
+	for _, run := range splitRuns(normalizeText(text)) {
+		if run.cjk {
+			for i, r := range run.runes {
+				w := cjkUnigramWeight
+				if stopChars[r] {
+					w = stopCharWeight
+				}
+				add("u:"+string(r), w)
+				if i+1 < len(run.runes) {
+					add("b:"+string(run.runes[i:i+2]), cjkBigramWeight)
+				}
+			}
+			continue
+		}
+
+		word := string(run.runes)
+		add("w:"+word, wordWeight)
+		padded := []rune("<" + word + ">")
+		for i := 0; i+3 <= len(padded); i++ {
+			add("t:"+string(padded[i:i+3]), wordTrigramWeight)
+		}
+	}
+
+	features := make(map[string]float64, len(counts))
+	for f, n := range counts {
+		features[f] = weights[f] * (1 + math.Log(float64(n)))
+	}
+	return features
+}
+
+// textRun 连续的同类字符：中日韩文字或字母数字
+type textRun struct {
+	runes []rune
+	cjk   bool
+}
+
+// splitRuns 按字符类别切分文本，标点与空白作为分隔符丢弃
+func splitRuns(text string) []textRun {
+	var runs []textRun
+	var cur []rune
+	curCJK := false
+	flush := func() {
+		if len(cur) > 0 {
+			runs = append(runs, textRun{runes: cur, cjk: curCJK})
+			cur = nil
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJKLetter(r):
+			if !curCJK {
+				flush()
+			}
+			curCJK = true
+			cur = append(cur, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if curCJK {
+				flush()
+			}
+			curCJK = false
+			cur = append(cur, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return runs
+}
+
+// normalizeText 统一大小写并将全角字母数字转换为半角
+func normalizeText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 0xFF01 && r <= 0xFF5E {
+			r -= 0xFEE0
+		}
+		return unicode.ToLower(r)
+	}, text)
+}
+
+// isCJKLetter 判断是否为中日韩文字（不含标点）
+func isCJKLetter(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"AiDemo/models"
+	"encoding/json"
+)
+
+// documentKey 片段所属原始文档的标识：文档 ID；尚未关联文档的片段各自视为独立文档
+func documentKey(k models.Knowledge) string {
+	if k.DocumentID != "" {
+		return k.DocumentID
+	}
+	return k.ID
+}
+
+// diversify 从候选中选出 topK 个结果：
+// lambda < 1 时按最大边际相关性（MMR）选择，即每次选取 λ·相关性 − (1−λ)·与已选结果的最大相似度 最高的候选；
+// lambda >= 1 时按得分顺序选择。maxPerDoc > 0 时同一文档最多选取 maxPerDoc 个片段。
+// 相关性为候选得分（byRerank 为 true 时为重排得分，否则为检索得分）的 min-max 归一化，
+// 相似度为片段向量的余弦相似度（向量模型不一致时视为不相似）
+func diversify(docs []ScoredDoc, topK int, lambda float64, maxPerDoc int, byRerank bool) []ScoredDoc {
+	if topK <= 0 || len(docs) == 0 {
+		return docs
+	}
+	useMMR := lambda < 1
+
+	relevance := normalizeScores(docs, byRerank)
+	var vectors [][]float64
+	if useMMR {
+		vectors = decodeCandidateVectors(docs)
+	}
+
+	perDoc := map[string]int{}
+	selected := make([]ScoredDoc, 0, topK)
+	selectedIdx := make([]int, 0, topK)
+	used := make([]bool, len(docs))
+
+	for len(selected) < topK {
+		best := -1
+		bestValue := 0.0
+		for i, d := range docs {
+			if used[i] || (maxPerDoc > 0 && perDoc[documentKey(d.Doc)] >= maxPerDoc) {
+				continue
+			}
+			value := relevance[i]
+			if useMMR {
+				redundancy := 0.0
+				for _, j := range selectedIdx {
+					if sim := cosineSimilarity(vectors[i], vectors[j]); sim > redundancy {
+						redundancy = sim
+					}
+				}
+				value = lambda*relevance[i] - (1-lambda)*redundancy
+			}
+			if best < 0 || value > bestValue {
+				best = i
+				bestValue = value
+			}
+		}
+		if best < 0 {
+			break
+		}
+		used[best] = true
+		perDoc[documentKey(docs[best].Doc)]++
+		selected = append(selected, docs[best])
+		selectedIdx = append(selectedIdx, best)
+	}
+	return selected
+}
+
+// normalizeScores 将候选得分 min-max 归一化到 [0, 1]，得分全部相同时均为 1
+func normalizeScores(docs []ScoredDoc, byRerank bool) []float64 {
+	scores := make([]float64, len(docs))
+	for i, d := range docs {
+		scores[i] = d.Score
+		if byRerank {
+			scores[i] = d.RerankScore
+		}
+	}
+	lo, hi := scores[0], scores[0]
+	for _, s := range scores {
+		lo = min(lo, s)
+		hi = max(hi, s)
+	}
+	out := make([]float64, len(docs))
+	for i, s := range scores {
+		if hi > lo {
+			out[i] = (s - lo) / (hi - lo)
+		} else {
+			out[i] = 1
+		}
+	}
+	return out
+}
+
+// decodeCandidateVectors 解析候选片段的向量，只保留当前向量模型生成的向量
+func decodeCandidateVectors(docs []ScoredDoc) [][]float64 {
+	model := GetEmbeddingModelVersion()
+	vectors := make([][]float64, len(docs))
+	for i, d := range docs {
+		if d.Doc.EmbeddingModel != model || d.Doc.Vector == "" {
+			continue
+		}
+		var vec []float64
+		if err := json.Unmarshal([]byte(d.Doc.Vector), &vec); err == nil {
+			vectors[i] = vec
+		}
+	}
+	return vectors
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"AiDemo/models"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDiversify(t *testing.T) {
+	model := GetEmbeddingModelVersion()
+	doc := func(id, documentID string, score float64, vec []float64) ScoredDoc {
+		data, _ := json.Marshal(vec)
+		return ScoredDoc{
+			Doc:   models.Knowledge{ID: id, DocumentID: documentID, Title: "退货政策 (片段 1/2)", Vector: string(data), EmbeddingModel: model},
+			Score: score,
+		}
+	}
+	candidates := func() []ScoredDoc {
+		return []ScoredDoc{
+			doc("a", "doc_1", 1.0, []float64{1, 0}),
+			doc("b", "doc_1", 0.95, []float64{0.99, 0.14}), // 与 a 几乎重复
+			doc("c", "doc_2", 0.9, []float64{0, 1}),
+			doc("d", "", 0.5, []float64{0.7, 0.7}),
+			doc("e", "", 0.4, []float64{0.6, 0.8}), // 与 d 同标题但未关联文档
+		}
+	}
+
+	tests := []struct {
+		name      string
+		topK      int
+		lambda    float64
+		maxPerDoc int
+		byRerank  bool
+		modify    func(docs []ScoredDoc)
+		want      string
+	}{
+		{name: "lambda 为 1 且不限片段数时保持得分顺序", topK: 2, lambda: 1, want: "a,b"},
+		{name: "同一文档最多一个片段", topK: 3, lambda: 1, maxPerDoc: 1, want: "a,c,d"},
+		{name: "未关联文档的片段各自计数", topK: 5, lambda: 1, maxPerDoc: 1, want: "a,c,d,e"},
+		{name: "MMR 跳过近似重复的片段", topK: 2, lambda: 0.5, want: "a,c"},
+		{
+			name: "向量模型不一致时视为不相似", topK: 2, lambda: 0.5,
+			modify: func(docs []ScoredDoc) { docs[1].Doc.EmbeddingModel = "old-model" },
+			want:   "a,b",
+		},
+		{
+			name: "重排后按重排得分选择", topK: 2, lambda: 1, byRerank: true,
+			modify: func(docs []ScoredDoc) {
+				for i := range docs {
+					docs[i].RerankScore = float64(i)
+				}
+			},
+			want: "e,d",
+		},
+		{name: "候选不足 topK", topK: 10, lambda: 1, want: "a,b,c,d,e"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs := candidates()
+			if tt.modify != nil {
+				tt.modify(docs)
+			}
+			var ids []string
+			for _, d := range diversify(docs, tt.topK, tt.lambda, tt.maxPerDoc, tt.byRerank) {
+				ids = append(ids, d.Doc.ID)
+			}
+			if got := strings.Join(ids, ","); got != tt.want {
+				t.Errorf("diversify = %s，期望 %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeScores(t *testing.T) {
+	tests := []struct {
+		name   string
+		scores []float64
+		want   []float64
+	}{
+		{"min-max 归一化", []float64{0.0325, 0.0164, 0.0244}, []float64{1, 0, 0.4968944099378882}},
+		{"得分全部相同", []float64{0.3, 0.3}, []float64{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs := make([]ScoredDoc, len(tt.scores))
+			for i, s := range tt.scores {
+				docs[i].Score = s
+			}
+			got := normalizeScores(docs, false)
+			for i := range tt.want {
+				if diff := got[i] - tt.want[i]; diff > 1e-9 || diff < -1e-9 {
+					t.Errorf("normalizeScores = %v，期望 %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
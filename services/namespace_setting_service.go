@@ -0,0 +1,201 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrNamespaceSettingNotFound 命名空间没有单独的配置
+	ErrNamespaceSettingNotFound = errors.New("命名空间配置不存在")
+	// ErrInvalidNamespaceSetting 命名空间配置参数不合法
+	ErrInvalidNamespaceSetting = errors.New("命名空间配置参数错误")
+)
+
+// maxRefuseMessageLen 拒答话术的最大字符数
+const maxRefuseMessageLen = 500
+
+// NamespaceSettingService 命名空间配置服务：按命名空间覆盖回答策略，并绑定提示词模板或实验
+type NamespaceSettingService struct{}
+
+// NewNamespaceSettingService 创建新的命名空间配置服务实例
+func NewNamespaceSettingService() *NamespaceSettingService {
+	return &NamespaceSettingService{}
+}
+
+// List 获取全部命名空间配置，按命名空间排序
+func (s *NamespaceSettingService) List() ([]models.NamespaceSetting, error) {
+	settings := []models.NamespaceSetting{}
+	err := config.DB.Order("namespace").Find(&settings).Error
+	return settings, err
+}
+
+// Get 获取命名空间配置，没有单独配置时返回 ErrNamespaceSettingNotFound
+func (s *NamespaceSettingService) Get(namespace string) (*models.NamespaceSetting, error) {
+	var setting models.NamespaceSetting
+	if err := config.DB.Where("namespace = ?", namespace).First(&setting).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNamespaceSettingNotFound
+		}
+		return nil, err
+	}
+	return &setting, nil
+}
+
+// Put 校验并整体替换命名空间配置，不存在时创建
+func (s *NamespaceSettingService) Put(namespace string, req models.NamespaceSettingRequest) (*models.NamespaceSetting, error) {
+	namespace = strings.TrimSpace(namespace)
+	if namespace == "" {
+		return nil, fmt.Errorf("%w: namespace 不能为空", ErrInvalidNamespaceSetting)
+	}
+	if req.MinScore != nil {
+		if err := ValidateMinScore(*req.MinScore, config.RetrievalMode); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidNamespaceSetting, err)
+		}
+	}
+	if req.MinHits != nil && *req.MinHits < 1 {
+		return nil, fmt.Errorf("%w: min_hits 不能小于 1", ErrInvalidNamespaceSetting)
+	}
+	fallback := strings.ToLower(strings.TrimSpace(req.Fallback))
+	switch fallback {
+	case "", models.FallbackGeneralAnswer, models.FallbackRefuse, models.FallbackAskClarifying:
+	default:
+		return nil, fmt.Errorf("%w: 不支持的兜底策略 %s（可选 general_answer / refuse / ask_clarifying_question）",
+			ErrInvalidNamespaceSetting, req.Fallback)
+	}
+	message := strings.TrimSpace(req.RefuseMessage)
+	if len([]rune(message)) > maxRefuseMessageLen {
+		return nil, fmt.Errorf("%w: refuse_message 不能超过 %d 个字符", ErrInvalidNamespaceSetting, maxRefuseMessageLen)
+	}
+	if err := s.validatePromptBinding(req); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	setting := &models.NamespaceSetting{
+		Namespace:     namespace,
+		MinScore:      req.MinScore,
+		MinHits:       req.MinHits,
+		Fallback:      fallback,
+		RefuseMessage: message,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+
+		PromptTemplateID:   req.PromptTemplateID,
+		PromptExperimentID: req.PromptExperimentID,
+	}
+	columns := []string{"min_score", "min_hits", "fallback", "refuse_message",
+		"prompt_template_id", "prompt_experiment_id", "updated_at"}
+	err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "namespace"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Create(setting).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(namespace)
+}
+
+// validatePromptBinding 校验提示词绑定：模板与实验二选一，且必须存在
+func (s *NamespaceSettingService) validatePromptBinding(req models.NamespaceSettingRequest) error {
+	promptService := NewPromptTemplateService()
+	switch {
+	case req.PromptTemplateID != nil && req.PromptExperimentID != nil:
+		return fmt.Errorf("%w: prompt_template_id 与 prompt_experiment_id 只能设置一个", ErrInvalidNamespaceSetting)
+	case req.PromptTemplateID != nil:
+		if _, err := promptService.GetTemplate(*req.PromptTemplateID); err != nil {
+			if errors.Is(err, ErrPromptTemplateNotFound) {
+				return fmt.Errorf("%w: 提示词模板 #%d 不存在", ErrInvalidNamespaceSetting, *req.PromptTemplateID)
+			}
+			return err
+		}
+	case req.PromptExperimentID != nil:
+		if _, err := promptService.GetExperiment(*req.PromptExperimentID); err != nil {
+			if errors.Is(err, ErrPromptExperimentNotFound) {
+				return fmt.Errorf("%w: 提示词实验 #%d 不存在", ErrInvalidNamespaceSetting, *req.PromptExperimentID)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete 删除命名空间配置，之后该命名空间使用全局默认值
+func (s *NamespaceSettingService) Delete(namespace string) error {
+	res := config.DB.Where("namespace = ?", namespace).Delete(&models.NamespaceSetting{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNamespaceSettingNotFound
+	}
+	return nil
+}
+
+// AnswerPolicy 返回命名空间生效的回答策略：命名空间配置中为空的字段使用全局默认值；
+// namespace 为空（检索全部命名空间）时直接使用全局默认值
+func (s *NamespaceSettingService) AnswerPolicy(namespace string) (models.AnswerPolicy, error) {
+	policy := models.AnswerPolicy{
+		Namespace:     namespace,
+		MinScore:      config.RAGMinScore,
+		MinHits:       max(config.RAGMinHits, 1),
+		Fallback:      config.RAGFallback,
+		RefuseMessage: config.RAGRefuseMessage,
+	}
+	if namespace == "" {
+		return policy, nil
+	}
+
+	setting, err := s.Get(namespace)
+	if errors.Is(err, ErrNamespaceSettingNotFound) {
+		return policy, nil
+	}
+	if err != nil {
+		return policy, err
+	}
+	if setting.MinScore != nil {
+		policy.MinScore = *setting.MinScore
+	}
+	if setting.MinHits != nil {
+		policy.MinHits = *setting.MinHits
+	}
+	if setting.Fallback != "" {
+		policy.Fallback = setting.Fallback
+	}
+	if setting.RefuseMessage != "" {
+		policy.RefuseMessage = setting.RefuseMessage
+	}
+	return policy, nil
+}
+
+// ValidateMinScore 校验最低得分与检索模式是否匹配：最低得分是向量余弦相似度，取值范围为 0-1；
+// keyword 模式的片段没有向量相似度，设置了最低得分会把全部片段过滤掉
+func ValidateMinScore(minScore float64, mode string) error {
+	if minScore < 0 || minScore > 1 {
+		return fmt.Errorf("min_score 为向量余弦相似度，取值范围为 0-1，实际为 %g", minScore)
+	}
+	if minScore > 0 && mode == RetrievalModeKeyword {
+		return fmt.Errorf("keyword 检索模式没有向量相似度，min_score 只能为 0，实际为 %g", minScore)
+	}
+	return nil
+}
+
+// ApplyAnswerPolicy 过滤掉向量相似度（VectorScore）低于最低得分的片段；达到最低得分的片段不少于 MinHits 时返回 true。
+// Score 的含义随检索模式与融合方式变化（余弦、BM25、RRF），不能与固定的阈值比较；
+// hybrid 模式中只由关键词召回的片段由检索补算向量相似度，与向量召回的片段使用同一阈值
+func ApplyAnswerPolicy(scored []ScoredDoc, policy models.AnswerPolicy) ([]ScoredDoc, bool) {
+	hits := make([]ScoredDoc, 0, len(scored))
+	for _, s := range scored {
+		if s.VectorScore >= policy.MinScore {
+			hits = append(hits, s)
+		}
+	}
+	return hits, len(hits) > 0 && len(hits) >= policy.MinHits
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"AiDemo/models"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestValidateMinScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		minScore float64
+		mode     string
+		wantErr  bool
+	}{
+		{name: "向量模式", minScore: 0.3, mode: RetrievalModeVector},
+		{name: "混合模式", minScore: 0.3, mode: RetrievalModeHybrid},
+		{name: "关键词模式不设阈值", minScore: 0, mode: RetrievalModeKeyword},
+		{name: "关键词模式设置阈值", minScore: 0.3, mode: RetrievalModeKeyword, wantErr: true},
+		{name: "按 BM25 量级设置的阈值", minScore: 5, mode: RetrievalModeVector, wantErr: true},
+		{name: "负数", minScore: -0.1, mode: RetrievalModeVector, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateMinScore(tt.minScore, tt.mode); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateMinScore(%g, %s) = %v，期望错误: %v", tt.minScore, tt.mode, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyAnswerPolicy(t *testing.T) {
+	// Score 为 hybrid 的 RRF 融合分，远小于余弦阈值；阈值只看 VectorScore
+	scored := []ScoredDoc{
+		{Doc: models.Knowledge{ID: "k_1"}, Score: 0.0325, VectorScore: 0.82, RerankScore: 0.1},
+		{Doc: models.Knowledge{ID: "k_2"}, Score: 0.0318, VectorScore: 0.41},
+		{Doc: models.Knowledge{ID: "k_3"}, Score: 0.0164, KeywordScore: 7.5}, // 向量模型不一致，无法补算相似度
+	}
+	tests := []struct {
+		name       string
+		policy     models.AnswerPolicy
+		wantIDs    []string
+		wantEnough bool
+	}{
+		{name: "不设阈值", policy: models.AnswerPolicy{MinScore: 0, MinHits: 1}, wantIDs: []string{"k_1", "k_2", "k_3"}, wantEnough: true},
+		{name: "按向量相似度过滤", policy: models.AnswerPolicy{MinScore: 0.4, MinHits: 2}, wantIDs: []string{"k_1", "k_2"}, wantEnough: true},
+		{name: "命中不足", policy: models.AnswerPolicy{MinScore: 0.5, MinHits: 2}, wantIDs: []string{"k_1"}, wantEnough: false},
+		{name: "全部低于阈值", policy: models.AnswerPolicy{MinScore: 0.9, MinHits: 1}, wantIDs: []string{}, wantEnough: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, enough := ApplyAnswerPolicy(scored, tt.policy)
+			if enough != tt.wantEnough || len(hits) != len(tt.wantIDs) {
+				t.Fatalf("ApplyAnswerPolicy 返回 %d 个片段、enough = %v，期望 %v、%v", len(hits), enough, tt.wantIDs, tt.wantEnough)
+			}
+			for i, h := range hits {
+				if h.Doc.ID != tt.wantIDs[i] {
+					t.Errorf("第 %d 个片段 = %s，期望 %s", i, h.Doc.ID, tt.wantIDs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestApplyAnswerPolicyHybridKeywordOnly(t *testing.T) {
+	const model = "local-v1"
+	queryVec := []float64{1, 0, 0}
+	vectorJSON := func(v ...float64) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	vectorDocs := []ScoredDoc{
+		{Doc: models.Knowledge{ID: "k_vec", Vector: vectorJSON(0.9, 0.1, 0), EmbeddingModel: model}, Score: 0.99, VectorScore: 0.99},
+	}
+	keywordDocs := []ScoredDoc{
+		{Doc: models.Knowledge{ID: "k_related", Vector: vectorJSON(0.8, 0.6, 0), EmbeddingModel: model}, Score: 9.1, KeywordScore: 9.1},
+		{Doc: models.Knowledge{ID: "k_vec", Vector: vectorJSON(0.9, 0.1, 0), EmbeddingModel: model}, Score: 6.3, KeywordScore: 6.3},
+		{Doc: models.Knowledge{ID: "k_unrelated", Vector: vectorJSON(0, 1, 0), EmbeddingModel: model}, Score: 5.2, KeywordScore: 5.2},
+		{Doc: models.Knowledge{ID: "k_opposite", Vector: vectorJSON(-1, 0, 0), EmbeddingModel: model}, Score: 4.8, KeywordScore: 4.8},
+	}
+
+	fused := fuseRRF(10, vectorDocs, keywordDocs)
+	fillVectorScores(fused, queryVec, model)
+	want := map[string]float64{"k_vec": 0.99, "k_related": 0.8, "k_unrelated": 0, "k_opposite": 0}
+	for _, d := range fused {
+		if math.Abs(d.VectorScore-want[d.Doc.ID]) > 1e-9 {
+			t.Errorf("%s 的 VectorScore = %g，期望 %g", d.Doc.ID, d.VectorScore, want[d.Doc.ID])
+		}
+	}
+
+	// 只由关键词召回、但与问题相关的片段达到阈值，不相关的被过滤
+	hits, enough := ApplyAnswerPolicy(fused, models.AnswerPolicy{MinScore: 0.5, MinHits: 2})
+	if !enough || len(hits) != 2 {
+		t.Fatalf("ApplyAnswerPolicy 返回 %d 个片段、enough = %v，期望 k_vec 与 k_related", len(hits), enough)
+	}
+	for _, h := range hits {
+		if h.Doc.ID != "k_vec" && h.Doc.ID != "k_related" {
+			t.Errorf("不应命中 %s", h.Doc.ID)
+		}
+	}
+
+	// 不设阈值时负相似度的片段仍算命中
+	if hits, _ := ApplyAnswerPolicy(fused, models.AnswerPolicy{MinScore: 0, MinHits: 1}); len(hits) != len(fused) {
+		t.Errorf("不设阈值时命中 %d 个片段，期望 %d", len(hits), len(fused))
+	}
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"AiDemo/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultOllamaBaseURL Ollama 本地服务地址
+const DefaultOllamaBaseURL = "http://localhost:11434"
+
+// OllamaProvider Ollama /api/chat 接口实现
+type OllamaProvider struct {
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+// NewOllamaProvider 创建 Ollama 对话服务
+func NewOllamaProvider(baseURL, model string) *OllamaProvider {
+	if baseURL == "" {
+		baseURL = DefaultOllamaBaseURL
+	}
+	return &OllamaProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		model:   model,
+		client:  &http.Client{},
+	}
+}
+
+// Name 服务提供方名称
+func (p *OllamaProvider) Name() string {
+	return "ollama"
+}
+
+// Model 当前使用的模型 ID
+func (p *OllamaProvider) Model() string {
+	return p.model
+}
+
+// Chat 调用 /api/chat 获取回复
+func (p *OllamaProvider) Chat(ctx context.Context, messages []models.Message) (ChatResult, error) {
+	url := p.baseURL + "/api/chat"
+	utils.Debug("准备调用API: %s", url)
+
+	body := models.OllamaRequestBody{
+		Model:    p.model,
+		Messages: messages,
+		Stream:   false,
+	}
+
+	ctx, cancel := withTimeout(ctx, config.LLMCallTimeout)
+	defer cancel()
+
+	respBody, _, err := postJSON(ctx, p.client, url, "", body)
+	if err != nil {
+		return ChatResult{}, err
+	}
+
+	var response models.OllamaResponseBody
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		utils.Error("解析响应JSON失败: %v", err)
+		return ChatResult{}, err
+	}
+
+	if response.Message.Content == "" {
+		utils.Error("API返回空结果")
+		return ChatResult{}, fmt.Errorf("API返回空结果")
+	}
+
+	result := ChatResult{
+		Content: response.Message.Content,
+		Model:   p.model,
+		Usage:   ollamaUsage(response),
+	}
+	utils.Info("API调用成功，返回内容长度: %d, token: %d", len(result.Content), result.Usage.TotalTokens)
+	return result, nil
+}
+
+// ChatStream 以 stream=true 调用 /api/chat，逐行解析 NDJSON 并回调
+func (p *OllamaProvider) ChatStream(ctx context.Context, messages []models.Message, onDelta StreamDeltaFunc) (ChatResult, error) {
+	url := p.baseURL + "/api/chat"
+	utils.Debug("准备调用流式API: %s", url)
+
+	body := models.OllamaRequestBody{
+		Model:    p.model,
+		Messages: messages,
+		Stream:   true,
+	}
+
+	ctx, cancel := withTimeout(ctx, config.LLMStreamTimeout)
+	defer cancel()
+
+	resp, err := openStream(ctx, p.client, url, "", body)
+	if err != nil {
+		return ChatResult{}, err
+	}
+	defer closeBody(resp.Body)
+
+	result := ChatResult{Model: p.model}
+	var sb strings.Builder
+	scanner := newLineScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var chunk models.OllamaResponseBody
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			utils.Warning("解析流式响应块失败: %v", err)
+			continue
+		}
+		if delta := chunk.Message.Content; delta != "" {
+			sb.WriteString(delta)
+			if err := onDelta(delta); err != nil {
+				result.Content = sb.String()
+				return result, wrapContextError(ctx, err)
+			}
+		}
+		if chunk.Done {
+			// 最后一个块携带 token 统计
+			result.Usage = ollamaUsage(chunk)
+			break
+		}
+	}
+	result.Content = sb.String()
+	if err := scanner.Err(); err != nil {
+		utils.Error("读取流式响应失败: %v", err)
+		return result, wrapContextError(ctx, err)
+	}
+
+	utils.Info("流式API调用完成，返回内容长度: %d, token: %d", len(result.Content), result.Usage.TotalTokens)
+	return result, nil
+}
+
+// ollamaUsage 将 Ollama 的计数字段转换为统一的 token 用量
+func ollamaUsage(resp models.OllamaResponseBody) models.Usage {
+	return models.Usage{
+		PromptTokens:     resp.PromptEvalCount,
+		CompletionTokens: resp.EvalCount,
+		TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
+	}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"AiDemo/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestOllamaProviderChat(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		want       ChatResult
+		wantStatus int
+		wantErr    bool
+	}{
+		{
+			name:   "成功并换算用量",
+			status: http.StatusOK,
+			body:   `{"model":"qwen2","message":{"role":"assistant","content":"你好"},"done":true,"prompt_eval_count":12,"eval_count":4}`,
+			want:   ChatResult{Content: "你好", Model: "qwen2", Usage: models.Usage{PromptTokens: 12, CompletionTokens: 4, TotalTokens: 16}},
+		},
+		{
+			name:    "内容为空",
+			status:  http.StatusOK,
+			body:    `{"message":{"role":"assistant","content":""},"done":true}`,
+			wantErr: true,
+		},
+		{
+			name:       "模型不存在时 error 为字符串",
+			status:     http.StatusNotFound,
+			body:       `{"error":"model 'qwen2' not found, try pulling it first"}`,
+			wantStatus: http.StatusNotFound,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, got := newTestServer(t, tt.status, nil, tt.body)
+			p := NewOllamaProvider(srv.URL, "qwen2")
+
+			result, err := p.Chat(context.Background(), testMessages)
+			if got.URL.Path != "/api/chat" {
+				t.Errorf("请求路径 = %q，期望 /api/chat", got.URL.Path)
+			}
+			if auth := got.Header.Get("Authorization"); auth != "" {
+				t.Errorf("Ollama 不应携带 Authorization，实际为 %q", auth)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("期望错误，实际返回 %+v", result)
+				}
+				var upErr *UpstreamError
+				if tt.wantStatus != 0 {
+					if !errors.As(err, &upErr) || upErr.StatusCode != tt.wantStatus {
+						t.Fatalf("期望状态码 %d 的 *UpstreamError，实际为 %v", tt.wantStatus, err)
+					}
+					if !strings.Contains(upErr.Message, "not found") || upErr.Retryable() {
+						t.Errorf("UpstreamError = %+v", upErr)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Chat 返回错误: %v", err)
+			}
+			if result != tt.want {
+				t.Errorf("Chat = %+v，期望 %+v", result, tt.want)
+			}
+		})
+	}
+}
+
+func TestOllamaProviderChatStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantDeltas []string
+		wantUsage  models.Usage
+	}{
+		{
+			name: "done 块携带用量",
+			body: `{"message":{"role":"assistant","content":"你"},"done":false}` + "\n" +
+				"\n" +
+				`{"message":{"role":"assistant","content":"好"},"done":false}` + "\n" +
+				`{"message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":9,"eval_count":2}` + "\n" +
+				`{"message":{"role":"assistant","content":"done 之后的内容"},"done":false}` + "\n",
+			wantDeltas: []string{"你", "好"},
+			wantUsage:  models.Usage{PromptTokens: 9, CompletionTokens: 2, TotalTokens: 11},
+		},
+		{
+			name: "没有 done 块直接断开",
+			body: `{"message":{"role":"assistant","content":"部分"},"done":false}` + "\n" +
+				`not json` + "\n" +
+				`{"message":{"role":"assistant","content":"回答"},"done":false}`,
+			wantDeltas: []string{"部分", "回答"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, got := newTestServer(t, http.StatusOK, map[string]string{"Content-Type": "application/x-ndjson"}, tt.body)
+			p := NewOllamaProvider(srv.URL, "qwen2")
+
+			var deltas []string
+			result, err := p.ChatStream(context.Background(), testMessages, func(delta string) error {
+				deltas = append(deltas, delta)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ChatStream 返回错误: %v", err)
+			}
+
+			var body models.OllamaRequestBody
+			if err := json.NewDecoder(got.Body).Decode(&body); err != nil || !body.Stream {
+				t.Errorf("流式请求体 = %+v（%v），期望 stream=true", body, err)
+			}
+			if strings.Join(deltas, "|") != strings.Join(tt.wantDeltas, "|") {
+				t.Errorf("增量 = %q，期望 %q", deltas, tt.wantDeltas)
+			}
+			want := ChatResult{Content: strings.Join(tt.wantDeltas, ""), Model: "qwen2", Usage: tt.wantUsage}
+			if result != want {
+				t.Errorf("ChatStream = %+v，期望 %+v", result, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"AiDemo/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// openAIEmbeddingBatchSize 单次请求的最大文本条数
+const openAIEmbeddingBatchSize = 64
+
+// OpenAIEmbedder OpenAI 兼容的 /embeddings 接口实现
+type OpenAIEmbedder struct {
+	baseURL string
+	model   string
+	apiKey  string
+	dim     int
+	client  *http.Client
+}
+
+// NewOpenAIEmbedder 创建 OpenAI 兼容接口的向量化服务，dim > 0 时作为 dimensions 参数传递
+func NewOpenAIEmbedder(baseURL, model, apiKey string, dim int) *OpenAIEmbedder {
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	return &OpenAIEmbedder{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		model:   model,
+		apiKey:  apiKey,
+		dim:     dim,
+		client:  &http.Client{},
+	}
+}
+
+// Name 提供方名称
+func (e *OpenAIEmbedder) Name() string {
+	return "openai"
+}
+
+// Version 模型版本标识，指定维度时附带维度
+func (e *OpenAIEmbedder) Version() string {
+	if e.dim > 0 {
+		return fmt.Sprintf("%s-d%d", e.model, e.dim)
+	}
+	return e.model
+}
+
+// Dimension 向量维度，未指定时为 0（由模型决定）
+func (e *OpenAIEmbedder) Dimension() int {
+	return e.dim
+}
+
+// Embed 调用 /embeddings 批量向量化，超过单次上限时分批请求
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vecs := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += openAIEmbeddingBatchSize {
+		end := start + openAIEmbeddingBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := e.embedBatch(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vecs = append(vecs, batch...)
+	}
+	return vecs, nil
+}
+
+// embedBatch 单次请求向量化，按响应中的 index 还原输入顺序
+func (e *OpenAIEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	url := e.baseURL + "/embeddings"
+	body := models.EmbeddingRequestBody{
+		Model:      e.model,
+		Input:      texts,
+		Dimensions: e.dim,
+	}
+
+	ctx, cancel := withTimeout(ctx, config.LLMCallTimeout)
+	defer cancel()
+
+	respBody, _, err := postJSON(ctx, e.client, url, e.apiKey, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var response models.EmbeddingResponseBody
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		utils.Error("解析向量化响应JSON失败: %v", err)
+		return nil, err
+	}
+
+	vecs := make([][]float64, len(texts))
+	for _, d := range response.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("向量化响应下标越界: %d", d.Index)
+		}
+		vecs[d.Index] = d.Embedding
+	}
+	for i, v := range vecs {
+		if len(v) == 0 {
+			return nil, fmt.Errorf("向量化响应缺少第 %d 条结果", i)
+		}
+	}
+	return vecs, nil
+}
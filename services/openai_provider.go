@@ -0,0 +1,161 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"AiDemo/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultOpenAIBaseURL OpenAI 官方接口地址
+const DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAIProvider OpenAI 兼容的 /chat/completions 接口实现
+type OpenAIProvider struct {
+	name    string
+	baseURL string
+	model   string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewOpenAIProvider 创建 OpenAI 兼容接口的对话服务
+func NewOpenAIProvider(baseURL, model, apiKey string) *OpenAIProvider {
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	return &OpenAIProvider{
+		name:    "openai",
+		baseURL: strings.TrimRight(baseURL, "/"),
+		model:   model,
+		apiKey:  apiKey,
+		client:  &http.Client{},
+	}
+}
+
+// Name 服务提供方名称
+func (p *OpenAIProvider) Name() string {
+	return p.name
+}
+
+// Model 当前使用的模型 ID
+func (p *OpenAIProvider) Model() string {
+	return p.model
+}
+
+// Chat 调用 /chat/completions 获取回复
+func (p *OpenAIProvider) Chat(ctx context.Context, messages []models.Message) (ChatResult, error) {
+	url := p.baseURL + "/chat/completions"
+	utils.Debug("准备调用API: %s", url)
+
+	body := models.RequestBody{
+		Model:    p.model,
+		Messages: messages,
+	}
+
+	ctx, cancel := withTimeout(ctx, config.LLMCallTimeout)
+	defer cancel()
+
+	respBody, _, err := postJSON(ctx, p.client, url, p.apiKey, body)
+	if err != nil {
+		return ChatResult{}, err
+	}
+
+	var response models.ResponseBody
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		utils.Error("解析响应JSON失败: %v", err)
+		return ChatResult{}, err
+	}
+
+	if len(response.Choices) > 0 {
+		result := ChatResult{
+			Content: response.Choices[0].Message.Content,
+			Model:   p.responseModel(response.Model),
+		}
+		if response.Usage != nil {
+			result.Usage = *response.Usage
+		}
+		utils.Info("API调用成功，返回内容长度: %d, token: %d", len(result.Content), result.Usage.TotalTokens)
+		return result, nil
+	}
+
+	utils.Error("API返回空结果")
+	return ChatResult{}, fmt.Errorf("API返回空结果")
+}
+
+// ChatStream 以 stream=true 调用 /chat/completions，解析 data: 块并逐段回调
+func (p *OpenAIProvider) ChatStream(ctx context.Context, messages []models.Message, onDelta StreamDeltaFunc) (ChatResult, error) {
+	url := p.baseURL + "/chat/completions"
+	utils.Debug("准备调用流式API: %s", url)
+
+	body := models.RequestBody{
+		Model:    p.model,
+		Messages: messages,
+		Stream:   true,
+		// 要求最后一个块携带 usage
+		StreamOptions: &models.StreamOptions{IncludeUsage: true},
+	}
+
+	ctx, cancel := withTimeout(ctx, config.LLMStreamTimeout)
+	defer cancel()
+
+	resp, err := openStream(ctx, p.client, url, p.apiKey, body)
+	if err != nil {
+		return ChatResult{}, err
+	}
+	defer closeBody(resp.Body)
+
+	result := ChatResult{Model: p.model}
+	var sb strings.Builder
+	scanner := newLineScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk models.StreamResponseBody
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			utils.Warning("解析流式响应块失败: %v", err)
+			continue
+		}
+		if chunk.Usage != nil {
+			result.Usage = *chunk.Usage
+		}
+		result.Model = p.responseModel(chunk.Model)
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta.Content
+		sb.WriteString(delta)
+		if err := onDelta(delta); err != nil {
+			result.Content = sb.String()
+			return result, wrapContextError(ctx, err)
+		}
+	}
+	result.Content = sb.String()
+	if err := scanner.Err(); err != nil {
+		utils.Error("读取流式响应失败: %v", err)
+		return result, wrapContextError(ctx, err)
+	}
+
+	utils.Info("流式API调用完成，返回内容长度: %d, token: %d", len(result.Content), result.Usage.TotalTokens)
+	return result, nil
+}
+
+// responseModel 优先使用上游返回的模型名，未返回时使用配置的模型 ID
+func (p *OpenAIProvider) responseModel(model string) string {
+	if model == "" {
+		return p.model
+	}
+	return model
+}
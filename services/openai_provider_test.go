@@ -0,0 +1,306 @@
+package services
+
+import (
+	"AiDemo/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testMessages = []models.Message{{Role: "user", Content: "你好"}}
+
+// newTestServer 启动返回固定状态码、响应头与响应体的本地替身，并记录收到的请求
+func newTestServer(t *testing.T, status int, header map[string]string, body string) (*httptest.Server, *http.Request) {
+	t.Helper()
+	got := &http.Request{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*got = *r.Clone(context.Background())
+		data, _ := io.ReadAll(r.Body)
+		got.Body = io.NopCloser(strings.NewReader(string(data)))
+		for k, v := range header {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+func TestOpenAIProviderChat(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		header     map[string]string
+		body       string
+		want       ChatResult
+		wantStatus int           // 期望的 UpstreamError 状态码，0 表示期望成功或非上游错误
+		wantRetry  time.Duration // 期望的 Retry-After
+		wantErr    bool
+	}{
+		{
+			name:   "成功并返回用量",
+			status: http.StatusOK,
+			body:   `{"model":"gpt-test-0613","choices":[{"message":{"role":"assistant","content":"你好！"}}],"usage":{"prompt_tokens":5,"completion_tokens":3,"total_tokens":8}}`,
+			want:   ChatResult{Content: "你好！", Model: "gpt-test-0613", Usage: models.Usage{PromptTokens: 5, CompletionTokens: 3, TotalTokens: 8}},
+		},
+		{
+			name:   "上游未返回模型与用量",
+			status: http.StatusOK,
+			body:   `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`,
+			want:   ChatResult{Content: "ok", Model: "gpt-test"},
+		},
+		{
+			name:       "429 携带 Retry-After",
+			status:     http.StatusTooManyRequests,
+			header:     map[string]string{"Retry-After": "7"},
+			body:       `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`,
+			wantStatus: http.StatusTooManyRequests,
+			wantRetry:  7 * time.Second,
+			wantErr:    true,
+		},
+		{
+			name:       "500 非 JSON 错误体",
+			status:     http.StatusInternalServerError,
+			body:       "upstream exploded",
+			wantStatus: http.StatusInternalServerError,
+			wantErr:    true,
+		},
+		{
+			name:    "choices 为空",
+			status:  http.StatusOK,
+			body:    `{"choices":[]}`,
+			wantErr: true,
+		},
+		{
+			name:    "响应不是 JSON",
+			status:  http.StatusOK,
+			body:    "<html>",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, got := newTestServer(t, tt.status, tt.header, tt.body)
+			p := NewOpenAIProvider(srv.URL+"/", "gpt-test", "sk-test")
+
+			result, err := p.Chat(context.Background(), testMessages)
+			if got.URL.Path != "/chat/completions" {
+				t.Errorf("请求路径 = %q，期望 /chat/completions", got.URL.Path)
+			}
+			if auth := got.Header.Get("Authorization"); auth != "Bearer sk-test" {
+				t.Errorf("Authorization = %q", auth)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("期望错误，实际返回 %+v", result)
+				}
+				var upErr *UpstreamError
+				if tt.wantStatus == 0 {
+					if errors.As(err, &upErr) {
+						t.Fatalf("期望非上游错误，实际为 %v", err)
+					}
+					return
+				}
+				if !errors.As(err, &upErr) {
+					t.Fatalf("期望 *UpstreamError，实际为 %T: %v", err, err)
+				}
+				if upErr.StatusCode != tt.wantStatus || upErr.RetryAfter != tt.wantRetry || !upErr.Retryable() {
+					t.Errorf("UpstreamError = %+v", upErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Chat 返回错误: %v", err)
+			}
+			if result != tt.want {
+				t.Errorf("Chat = %+v，期望 %+v", result, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenAIProviderChatErrorBody(t *testing.T) {
+	srv, _ := newTestServer(t, http.StatusUnauthorized, nil,
+		`{"error":{"message":"Incorrect API key","type":"invalid_request_error","code":401}}`)
+	_, err := NewOpenAIProvider(srv.URL, "gpt-test", "bad").Chat(context.Background(), testMessages)
+
+	var upErr *UpstreamError
+	if !errors.As(err, &upErr) {
+		t.Fatalf("期望 *UpstreamError，实际为 %v", err)
+	}
+	want := UpstreamError{StatusCode: 401, Code: "401", Type: "invalid_request_error", Message: "Incorrect API key"}
+	if *upErr != want {
+		t.Errorf("UpstreamError = %+v，期望 %+v", *upErr, want)
+	}
+	if upErr.Retryable() {
+		t.Error("401 不应重试")
+	}
+}
+
+func TestOpenAIProviderChatStream(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantDeltas  []string
+		wantModel   string
+		wantUsage   models.Usage
+		stopAfter   int // 第几个增量后由回调中止，0 表示不中止
+		wantErr     bool
+		wantContent string
+	}{
+		{
+			name: "以 [DONE] 结束并携带用量",
+			body: "data: {\"model\":\"gpt-test-0613\",\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"你\"}}]}\n\n" +
+				": keep-alive\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"好\"}}]}\n\n" +
+				"data: {\"model\":\"gpt-test-0613\",\"choices\":[],\"usage\":{\"prompt_tokens\":4,\"completion_tokens\":2,\"total_tokens\":6}}\n\n" +
+				"data: [DONE]\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"[DONE] 之后的内容\"}}]}\n\n",
+			wantDeltas:  []string{"你", "好"},
+			wantModel:   "gpt-test-0613",
+			wantUsage:   models.Usage{PromptTokens: 4, CompletionTokens: 2, TotalTokens: 6},
+			wantContent: "你好",
+		},
+		{
+			name: "没有 [DONE] 直接断开",
+			body: "data: {\"choices\":[{\"delta\":{\"content\":\"部分\"}}]}\n\n" +
+				"data:{\"choices\":[{\"delta\":{\"content\":\"回答\"}}]}\n",
+			wantDeltas:  []string{"部分", "回答"},
+			wantModel:   "gpt-test",
+			wantContent: "部分回答",
+		},
+		{
+			name: "跳过无法解析的块",
+			body: "data: {not json}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"ok\"}}]}\n\n" +
+				"data: [DONE]\n\n",
+			wantDeltas:  []string{"ok"},
+			wantModel:   "gpt-test",
+			wantContent: "ok",
+		},
+		{
+			name: "回调返回错误时中止并返回部分内容",
+			body: "data: {\"choices\":[{\"delta\":{\"content\":\"一\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"二\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"三\"}}]}\n\n",
+			wantDeltas:  []string{"一", "二"},
+			wantModel:   "gpt-test",
+			stopAfter:   2,
+			wantErr:     true,
+			wantContent: "一二",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, got := newTestServer(t, http.StatusOK, map[string]string{"Content-Type": "text/event-stream"}, tt.body)
+			p := NewOpenAIProvider(srv.URL, "gpt-test", "sk-test")
+
+			var deltas []string
+			stopErr := errors.New("客户端已断开")
+			result, err := p.ChatStream(context.Background(), testMessages, func(delta string) error {
+				deltas = append(deltas, delta)
+				if tt.stopAfter > 0 && len(deltas) == tt.stopAfter {
+					return stopErr
+				}
+				return nil
+			})
+
+			var body models.RequestBody
+			if err := json.NewDecoder(got.Body).Decode(&body); err != nil {
+				t.Fatalf("解析请求体失败: %v", err)
+			}
+			if !body.Stream || body.StreamOptions == nil || !body.StreamOptions.IncludeUsage {
+				t.Errorf("流式请求体 = %+v，期望 stream=true 且 include_usage=true", body)
+			}
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("ChatStream 错误 = %v，期望错误: %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, stopErr) {
+				t.Errorf("期望返回回调的错误，实际为 %v", err)
+			}
+			if strings.Join(deltas, "|") != strings.Join(tt.wantDeltas, "|") {
+				t.Errorf("增量 = %q，期望 %q", deltas, tt.wantDeltas)
+			}
+			want := ChatResult{Content: tt.wantContent, Model: tt.wantModel, Usage: tt.wantUsage}
+			if result != want {
+				t.Errorf("ChatStream = %+v，期望 %+v", result, want)
+			}
+		})
+	}
+}
+
+func TestOpenAIProviderChatStreamUpstreamError(t *testing.T) {
+	srv, _ := newTestServer(t, http.StatusServiceUnavailable, map[string]string{"Retry-After": "3"},
+		`{"error":{"message":"overloaded","type":"server_error"}}`)
+	called := false
+	_, err := NewOpenAIProvider(srv.URL, "gpt-test", "").ChatStream(context.Background(), testMessages, func(string) error {
+		called = true
+		return nil
+	})
+
+	var upErr *UpstreamError
+	if !errors.As(err, &upErr) || upErr.StatusCode != http.StatusServiceUnavailable || upErr.RetryAfter != 3*time.Second {
+		t.Fatalf("期望 503 的 *UpstreamError，实际为 %v", err)
+	}
+	if called {
+		t.Error("上游返回错误时不应回调增量")
+	}
+}
+
+func TestOpenAIProviderCanceled(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := NewOpenAIProvider(srv.URL, "gpt-test", "").Chat(ctx, testMessages)
+
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("期望 *TimeoutError，实际为 %T: %v", err, err)
+	}
+}
+
+func TestNewChatProvider(t *testing.T) {
+	tests := []struct {
+		provider string
+		wantName string
+		wantErr  bool
+	}{
+		{provider: "", wantName: "doubao"},
+		{provider: "Doubao", wantName: "doubao"},
+		{provider: "openai", wantName: "openai"},
+		{provider: "ollama", wantName: "ollama"},
+		{provider: "claude", wantErr: true},
+	}
+	for _, tt := range tests {
+		p, err := NewChatProvider(tt.provider, "", "m", "")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewChatProvider(%q) 期望错误", tt.provider)
+			}
+			continue
+		}
+		if err != nil || p.Name() != tt.wantName || p.Model() != "m" {
+			t.Errorf("NewChatProvider(%q) = %v, %v", tt.provider, p, err)
+		}
+	}
+
+	if p := NewDoubaoProvider("", "m", ""); p.baseURL != DefaultDoubaoBaseURL {
+		t.Errorf("豆包默认地址 = %q", p.baseURL)
+	}
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"AiDemo/utils"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrPromptTemplateNotFound 提示词模板不存在
+	ErrPromptTemplateNotFound = errors.New("提示词模板不存在")
+	// ErrPromptExperimentNotFound 提示词实验不存在
+	ErrPromptExperimentNotFound = errors.New("提示词实验不存在")
+	// ErrInvalidPromptTemplate 提示词模板或实验参数不合法
+	ErrInvalidPromptTemplate = errors.New("提示词模板参数错误")
+	// ErrPromptInUse 模板或实验仍被命名空间或实验引用，不能删除
+	ErrPromptInUse = errors.New("提示词模板或实验仍被引用")
+)
+
+// BuiltinPromptTemplateName 内置默认模板（DefaultRAGPromptTemplate）的名称，模板 ID 为 0
+const BuiltinPromptTemplateName = "builtin"
+
+// PromptTemplateService 提示词模板服务：管理版本化的模板与 A/B 实验，并为命名空间选择本次回答使用的模板
+type PromptTemplateService struct{}
+
+// NewPromptTemplateService 创建新的提示词模板服务实例
+func NewPromptTemplateService() *PromptTemplateService {
+	return &PromptTemplateService{}
+}
+
+// ListTemplates 获取模板列表，name 不为空时只返回该名称的各个版本；按名称与版本倒序排列
+func (s *PromptTemplateService) ListTemplates(name string) ([]models.PromptTemplate, error) {
+	templates := []models.PromptTemplate{}
+	db := config.DB.Order("name, version DESC")
+	if name != "" {
+		db = db.Where("name = ?", name)
+	}
+	err := db.Find(&templates).Error
+	return templates, err
+}
+
+// GetTemplate 根据 ID 获取模板
+func (s *PromptTemplateService) GetTemplate(id uint) (*models.PromptTemplate, error) {
+	var tmpl models.PromptTemplate
+	if err := config.DB.First(&tmpl, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPromptTemplateNotFound
+		}
+		return nil, err
+	}
+	return &tmpl, nil
+}
+
+// CreateTemplate 创建模板；已有同名模板时保存为该名称的下一个版本
+func (s *PromptTemplateService) CreateTemplate(req models.PromptTemplateRequest) (*models.PromptTemplate, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, fmt.Errorf("%w: name 不能为空", ErrInvalidPromptTemplate)
+	}
+	if req.Name == BuiltinPromptTemplateName {
+		return nil, fmt.Errorf("%w: %s 为内置模板名称", ErrInvalidPromptTemplate, BuiltinPromptTemplateName)
+	}
+	return s.saveVersion(req)
+}
+
+// PublishVersion 以模板 id 的名称发布新版本，原版本保持不变
+func (s *PromptTemplateService) PublishVersion(id uint, req models.PromptTemplateRequest) (*models.PromptTemplate, error) {
+	tmpl, err := s.GetTemplate(id)
+	if err != nil {
+		return nil, err
+	}
+	req.Name = tmpl.Name
+	return s.saveVersion(req)
+}
+
+// saveVersion 校验模板内容并保存为同名模板的下一个版本
+func (s *PromptTemplateService) saveVersion(req models.PromptTemplateRequest) (*models.PromptTemplate, error) {
+	tmpl := &models.PromptTemplate{
+		Name:                req.Name,
+		Description:         strings.TrimSpace(req.Description),
+		SystemRole:          strings.TrimSpace(req.SystemRole),
+		CitationInstruction: strings.TrimSpace(req.CitationInstruction),
+		KnowledgeIntro:      req.KnowledgeIntro,
+		QuestionPrefix:      req.QuestionPrefix,
+		JoinSeparator:       req.JoinSeparator,
+	}
+	if tmpl.SystemRole == "" {
+		return nil, fmt.Errorf("%w: system_role 不能为空", ErrInvalidPromptTemplate)
+	}
+	if tmpl.KnowledgeIntro == "" {
+		tmpl.KnowledgeIntro = DefaultRAGPromptTemplate.KnowledgeIntro
+	}
+	if tmpl.QuestionPrefix == "" {
+		tmpl.QuestionPrefix = DefaultRAGPromptTemplate.QuestionPrefix
+	}
+	if tmpl.JoinSeparator == "" {
+		tmpl.JoinSeparator = DefaultRAGPromptTemplate.JoinSeparator
+	}
+	if intro := fmt.Sprintf(tmpl.KnowledgeIntro, 1, "标题"); strings.Contains(intro, "%!") {
+		return nil, fmt.Errorf("%w: knowledge_intro 须依次包含 %%d（引用编号）与 %%s（片段标题）", ErrInvalidPromptTemplate)
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := tx.Model(&models.PromptTemplate{}).Where("name = ?", tmpl.Name).
+			Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		tmpl.Version = latest + 1
+		return tx.Create(tmpl).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	utils.Info("提示词模板 %s 已发布版本 v%d（#%d）", tmpl.Name, tmpl.Version, tmpl.ID)
+	return tmpl, nil
+}
+
+// DeleteTemplate 删除模板版本；仍被命名空间或实验引用时返回 ErrPromptInUse
+func (s *PromptTemplateService) DeleteTemplate(id uint) error {
+	if _, err := s.GetTemplate(id); err != nil {
+		return err
+	}
+	var bound int64
+	if err := config.DB.Model(&models.NamespaceSetting{}).Where("prompt_template_id = ?", id).Count(&bound).Error; err != nil {
+		return err
+	}
+	if bound > 0 {
+		return fmt.Errorf("%w: 模板 #%d 已绑定到 %d 个命名空间", ErrPromptInUse, id, bound)
+	}
+	experiments, err := s.ListExperiments()
+	if err != nil {
+		return err
+	}
+	for _, exp := range experiments {
+		for _, v := range exp.Variants {
+			if v.TemplateID == id {
+				return fmt.Errorf("%w: 模板 #%d 在实验 #%d（%s）中使用", ErrPromptInUse, id, exp.ID, exp.Name)
+			}
+		}
+	}
+	return config.DB.Delete(&models.PromptTemplate{}, id).Error
+}
+
+// ListExperiments 获取全部实验
+func (s *PromptTemplateService) ListExperiments() ([]models.PromptExperiment, error) {
+	experiments := []models.PromptExperiment{}
+	err := config.DB.Order("id").Find(&experiments).Error
+	return experiments, err
+}
+
+// GetExperiment 根据 ID 获取实验
+func (s *PromptTemplateService) GetExperiment(id uint) (*models.PromptExperiment, error) {
+	var exp models.PromptExperiment
+	if err := config.DB.First(&exp, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPromptExperimentNotFound
+		}
+		return nil, err
+	}
+	return &exp, nil
+}
+
+// CreateExperiment 创建实验
+func (s *PromptTemplateService) CreateExperiment(req models.PromptExperimentRequest) (*models.PromptExperiment, error) {
+	if err := s.validateExperiment(req); err != nil {
+		return nil, err
+	}
+	exp := &models.PromptExperiment{
+		Name:        strings.TrimSpace(req.Name),
+		Description: strings.TrimSpace(req.Description),
+		Variants:    req.Variants,
+	}
+	if err := config.DB.Create(exp).Error; err != nil {
+		return nil, err
+	}
+	return exp, nil
+}
+
+// UpdateExperiment 整体替换实验的名称与分流配置。已按会话固定的分流会随权重变化重新分配
+func (s *PromptTemplateService) UpdateExperiment(id uint, req models.PromptExperimentRequest) (*models.PromptExperiment, error) {
+	exp, err := s.GetExperiment(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateExperiment(req); err != nil {
+		return nil, err
+	}
+	exp.Name = strings.TrimSpace(req.Name)
+	exp.Description = strings.TrimSpace(req.Description)
+	exp.Variants = req.Variants
+	if err := config.DB.Save(exp).Error; err != nil {
+		return nil, err
+	}
+	return exp, nil
+}
+
+// DeleteExperiment 删除实验；仍绑定到命名空间时返回 ErrPromptInUse
+func (s *PromptTemplateService) DeleteExperiment(id uint) error {
+	if _, err := s.GetExperiment(id); err != nil {
+		return err
+	}
+	var bound int64
+	if err := config.DB.Model(&models.NamespaceSetting{}).Where("prompt_experiment_id = ?", id).Count(&bound).Error; err != nil {
+		return err
+	}
+	if bound > 0 {
+		return fmt.Errorf("%w: 实验 #%d 已绑定到 %d 个命名空间", ErrPromptInUse, id, bound)
+	}
+	return config.DB.Delete(&models.PromptExperiment{}, id).Error
+}
+
+// validateExperiment 校验实验：至少一个模板，权重为正，模板存在且不重复
+func (s *PromptTemplateService) validateExperiment(req models.PromptExperimentRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("%w: name 不能为空", ErrInvalidPromptTemplate)
+	}
+	if len(req.Variants) == 0 {
+		return fmt.Errorf("%w: variants 至少包含一个模板", ErrInvalidPromptTemplate)
+	}
+	seen := map[uint]struct{}{}
+	for _, v := range req.Variants {
+		if v.Weight <= 0 {
+			return fmt.Errorf("%w: 模板 #%d 的 weight 必须大于 0", ErrInvalidPromptTemplate, v.TemplateID)
+		}
+		if _, ok := seen[v.TemplateID]; ok {
+			return fmt.Errorf("%w: 模板 #%d 重复", ErrInvalidPromptTemplate, v.TemplateID)
+		}
+		seen[v.TemplateID] = struct{}{}
+		if _, err := s.GetTemplate(v.TemplateID); err != nil {
+			if errors.Is(err, ErrPromptTemplateNotFound) {
+				return fmt.Errorf("%w: 模板 #%d 不存在", ErrInvalidPromptTemplate, v.TemplateID)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Select 为命名空间选择本次回答使用的模板：绑定实验时按权重分流（携带会话 ID 时同一会话固定使用同一模板），
+// 绑定模板时直接使用，未绑定或引用已失效时使用内置默认模板
+func (s *PromptTemplateService) Select(namespace, sessionID string) (RAGPromptTemplate, models.PromptSelection, error) {
+	builtin := models.PromptSelection{TemplateName: BuiltinPromptTemplateName}
+	if namespace == "" {
+		return DefaultRAGPromptTemplate, builtin, nil
+	}
+	setting, err := NewNamespaceSettingService().Get(namespace)
+	if errors.Is(err, ErrNamespaceSettingNotFound) {
+		return DefaultRAGPromptTemplate, builtin, nil
+	}
+	if err != nil {
+		return DefaultRAGPromptTemplate, builtin, err
+	}
+
+	var templateID, experimentID uint
+	switch {
+	case setting.PromptExperimentID != nil:
+		exp, err := s.GetExperiment(*setting.PromptExperimentID)
+		if err != nil {
+			return s.fallbackToBuiltin(namespace, err)
+		}
+		experimentID = exp.ID
+		templateID = pickVariant(exp, sessionID).TemplateID
+	case setting.PromptTemplateID != nil:
+		templateID = *setting.PromptTemplateID
+	default:
+		return DefaultRAGPromptTemplate, builtin, nil
+	}
+
+	tmpl, err := s.GetTemplate(templateID)
+	if err != nil {
+		return s.fallbackToBuiltin(namespace, err)
+	}
+	return templateFromModel(tmpl), models.PromptSelection{
+		TemplateID:   tmpl.ID,
+		TemplateName: tmpl.Name,
+		Version:      tmpl.Version,
+		ExperimentID: experimentID,
+	}, nil
+}
+
+// fallbackToBuiltin 绑定的模板或实验已不存在时记录警告并使用内置默认模板，其他错误直接返回
+func (s *PromptTemplateService) fallbackToBuiltin(namespace string, err error) (RAGPromptTemplate, models.PromptSelection, error) {
+	builtin := models.PromptSelection{TemplateName: BuiltinPromptTemplateName}
+	if errors.Is(err, ErrPromptTemplateNotFound) || errors.Is(err, ErrPromptExperimentNotFound) {
+		utils.Warning("命名空间 %s 绑定的%v，使用内置默认模板", namespace, err)
+		return DefaultRAGPromptTemplate, builtin, nil
+	}
+	return DefaultRAGPromptTemplate, builtin, err
+}
+
+// pickVariant 按权重选择实验中的模板。携带会话 ID 时按实验 ID 与会话 ID 的哈希选择，保证同一会话结果稳定
+func pickVariant(exp *models.PromptExperiment, sessionID string) models.PromptVariant {
+	total := 0
+	for _, v := range exp.Variants {
+		total += v.Weight
+	}
+	var n int
+	if sessionID != "" {
+		h := fnv.New32a()
+		fmt.Fprintf(h, "%d:%s", exp.ID, sessionID)
+		n = int(h.Sum32() % uint32(total))
+	} else {
+		n = rand.IntN(total)
+	}
+	for _, v := range exp.Variants {
+		if n < v.Weight {
+			return v
+		}
+		n -= v.Weight
+	}
+	return exp.Variants[len(exp.Variants)-1]
+}
+
+// templateFromModel 将数据库中的模板转换为构建提示词使用的模板
+func templateFromModel(t *models.PromptTemplate) RAGPromptTemplate {
+	return RAGPromptTemplate{
+		SystemRole:          t.SystemRole,
+		CitationInstruction: t.CitationInstruction,
+		KnowledgeIntro:      t.KnowledgeIntro,
+		QuestionPrefix:      t.QuestionPrefix,
+		JoinSeparator:       t.JoinSeparator,
+	}
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"AiDemo/utils"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 查询扩展策略
+const (
+	QueryStrategyNone       = "none"        // 直接使用原问题检索
+	QueryStrategyMultiQuery = "multi_query" // 大模型生成多个改写问题，分别检索后按 RRF 融合
+	QueryStrategyHyDE       = "hyde"        // 大模型先写一段假设回答，用假设回答的向量检索
+)
+
+// QueryExpansion 查询扩展的结果，供调试输出
+type QueryExpansion struct {
+	Strategy           string   `json:"strategy"`
+	Queries            []string `json:"queries,omitempty"`             // multi_query 生成的改写问题（不含原问题）
+	HypotheticalAnswer string   `json:"hypothetical_answer,omitempty"` // hyde 生成的假设回答
+}
+
+// searchQuery 一次召回使用的查询，向量检索与关键词检索可以使用不同的文本
+type searchQuery struct {
+	vector  string
+	keyword string
+}
+
+// queryListMarker 模型输出中每行开头的编号或列表符号，如 "1." "2、" "- "
+var queryListMarker = regexp.MustCompile(`^\s*(?:\d+[.、)）]|[-*•])\s*`)
+
+// ParseQueryStrategy 校验查询扩展策略，为空时返回配置的默认策略
+func ParseQueryStrategy(strategy string) (string, error) {
+	strategy = strings.ToLower(strings.TrimSpace(strategy))
+	if strategy == "" {
+		strategy = config.QueryStrategy
+	}
+	switch strategy {
+	case QueryStrategyNone, QueryStrategyMultiQuery, QueryStrategyHyDE:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("不支持的查询扩展策略: %s（可选 none / multi_query / hyde）", strategy)
+	}
+}
+
+// expandQuery 按策略生成召回使用的查询，扩展调用的用量计入 sessionID。扩展失败时记录警告并退化为原问题，调用方已取消时返回错误
+func expandQuery(ctx context.Context, strategy, query, sessionID string) ([]searchQuery, *QueryExpansion, error) {
+	original := []searchQuery{{vector: query, keyword: query}}
+	if strategy == QueryStrategyNone {
+		return original, nil, nil
+	}
+
+	expansion := &QueryExpansion{Strategy: strategy}
+	var err error
+	switch strategy {
+	case QueryStrategyMultiQuery:
+		expansion.Queries, err = generateQueryVariants(ctx, sessionID, query, config.MultiQueryCount)
+	case QueryStrategyHyDE:
+		expansion.HypotheticalAnswer, err = generateHypotheticalAnswer(ctx, sessionID, query)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, wrapContextError(ctx, ctx.Err())
+		}
+		utils.Warning("查询扩展[%s]失败，使用原问题检索: %v", strategy, err)
+		return original, expansion, nil
+	}
+
+	if expansion.HypotheticalAnswer != "" {
+		// 假设回答与知识片段的表述更接近，用于向量检索；关键词检索仍使用原问题，避免假设内容中的无关词项
+		return []searchQuery{{vector: expansion.HypotheticalAnswer, keyword: query}}, expansion, nil
+	}
+	queries := original
+	for _, q := range expansion.Queries {
+		queries = append(queries, searchQuery{vector: q, keyword: q})
+	}
+	return queries, expansion, nil
+}
+
+// generateQueryVariants 请求大模型生成 n 个不同表述的改写问题，去掉编号、重复项与原问题
+func generateQueryVariants(ctx context.Context, sessionID, query string, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	messages := []models.Message{
+		{Role: "system", Content: fmt.Sprintf(
+			"你负责扩展检索问题。请为用户的问题生成 %d 个表述不同但含义相同的检索问题，"+
+				"尽量使用不同的用词、同义词和角度，保持原问题的语言。每行输出一个问题，不要编号，不要输出其他内容。", n)},
+		{Role: "user", Content: query},
+	}
+	result, err := GetChatProvider().Chat(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	RecordUsage(sessionID, "expansion", "system", result)
+
+	seen := map[string]struct{}{strings.TrimSpace(query): {}}
+	var variants []string
+	for _, line := range strings.Split(result.Content, "\n") {
+		line = strings.TrimSpace(queryListMarker.ReplaceAllString(line, ""))
+		if line == "" {
+			continue
+		}
+		if _, ok := seen[line]; ok {
+			continue
+		}
+		seen[line] = struct{}{}
+		variants = append(variants, line)
+		if len(variants) == n {
+			break
+		}
+	}
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("模型未生成改写问题: %s", result.Content)
+	}
+	return variants, nil
+}
+
+// generateHypotheticalAnswer 请求大模型为问题写一段假设回答（HyDE）
+func generateHypotheticalAnswer(ctx context.Context, sessionID, query string) (string, error) {
+	messages := []models.Message{
+		{Role: "system", Content: "请针对用户的问题写一段可能出现在知识库文档中的回答，100-200 字，" +
+			"直接给出正文，不需要保证完全准确，不要说明这是假设，也不要反问。"},
+		{Role: "user", Content: query},
+	}
+	result, err := GetChatProvider().Chat(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	RecordUsage(sessionID, "expansion", "system", result)
+
+	answer := strings.TrimSpace(result.Content)
+	if answer == "" {
+		return "", fmt.Errorf("模型未生成假设回答")
+	}
+	return answer, nil
+}
+
+// fuseQueryResults 按 RRF 融合多个查询各自的召回结果，向量与关键词得分取各查询中的最大值
+func fuseQueryResults(topK int, lists [][]ScoredDoc) []ScoredDoc {
+	fused := map[string]*ScoredDoc{}
+	var order []string
+	for _, docs := range lists {
+		for rank, d := range docs {
+			entry, ok := fused[d.Doc.ID]
+			if !ok {
+				entry = &ScoredDoc{Doc: d.Doc}
+				fused[d.Doc.ID] = entry
+				order = append(order, d.Doc.ID)
+			}
+			entry.Score += 1.0 / float64(rrfK+rank+1)
+			entry.VectorScore = max(entry.VectorScore, d.VectorScore)
+			entry.KeywordScore = max(entry.KeywordScore, d.KeywordScore)
+		}
+	}
+
+	result := make([]ScoredDoc, 0, len(order))
+	for _, id := range order {
+		result = append(result, *fused[id])
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Score > result[j].Score })
+	if len(result) > topK {
+		result = result[:topK]
+	}
+	return result
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"AiDemo/models"
+	"context"
+	"strings"
+)
+
+// rewriteMaxMessageLen 改写追问时每条历史消息发送的最大字符数
+const rewriteMaxMessageLen = 500
+
+// rewriteSystemPrompt 追问改写的系统提示词
+const rewriteSystemPrompt = "你负责改写检索问题。请结合对话历史，将用户的最新问题改写为一个无需上下文即可理解的独立问题：" +
+	"补全代词、序数（如“第二个”）和省略的指代对象，保持原意和语言，不要回答问题。" +
+	"如果最新问题本身已经完整，原样输出。只输出改写后的问题。"
+
+// RewriteQuery 结合最近的对话将追问改写为可独立检索的问题，没有历史时直接返回原问题。
+// 不完整的回复与兜底回答（拒答、澄清、普通对话）不含知识内容，改写时跳过，只保留用户当时的提问
+func RewriteQuery(ctx context.Context, sessionID string, history []models.ChatMessage, query string) (string, error) {
+	history = rewriteHistory(history)
+	if len(history) == 0 {
+		return query, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("【对话历史】\n")
+	for _, m := range history {
+		role := "用户"
+		if m.Role == "assistant" {
+			role = "助手"
+		}
+		content := []rune(strings.TrimSpace(m.Content))
+		if len(content) > rewriteMaxMessageLen {
+			content = append(content[:rewriteMaxMessageLen], '…')
+		}
+		sb.WriteString(role + "：" + string(content) + "\n")
+	}
+	sb.WriteString("\n【最新问题】\n")
+	sb.WriteString(query)
+
+	messages := []models.Message{
+		{Role: "system", Content: rewriteSystemPrompt},
+		{Role: "user", Content: sb.String()},
+	}
+	result, err := GetChatProvider().Chat(ctx, messages)
+	if err != nil {
+		return query, err
+	}
+	RecordUsage(sessionID, "rewrite", "system", result)
+
+	rewritten := strings.Trim(strings.TrimSpace(result.Content), "\"“”")
+	if rewritten == "" {
+		return query, nil
+	}
+	return rewritten, nil
+}
+
+// rewriteHistory 过滤掉不完整的回复与兜底回答
+func rewriteHistory(history []models.ChatMessage) []models.ChatMessage {
+	var kept []models.ChatMessage
+	for _, m := range history {
+		if m.Role == "assistant" && (m.Incomplete || m.FallbackPolicy != "") {
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
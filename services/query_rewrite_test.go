@@ -0,0 +1,28 @@
+package services
+
+import (
+	"AiDemo/models"
+	"testing"
+)
+
+func TestRewriteHistory(t *testing.T) {
+	history := []models.ChatMessage{
+		{ID: 1, Role: "user", Content: "Go 的并发模型是什么？"},
+		{ID: 2, Role: "assistant", Content: "Go 使用 goroutine 与 channel [1]。"},
+		{ID: 3, Role: "user", Content: "公司的报销流程？"},
+		{ID: 4, Role: "assistant", Content: "抱歉，知识库中没有找到相关内容。", FallbackPolicy: models.FallbackRefuse},
+		{ID: 5, Role: "user", Content: "那 channel 呢？"},
+		{ID: 6, Role: "assistant", Content: "channel 用于", Incomplete: true},
+	}
+
+	got := rewriteHistory(history)
+	want := []uint{1, 2, 3, 5}
+	if len(got) != len(want) {
+		t.Fatalf("rewriteHistory 保留 %d 条消息，期望 %d 条", len(got), len(want))
+	}
+	for i, m := range got {
+		if m.ID != want[i] {
+			t.Errorf("第 %d 条消息 ID = %d，期望 %d", i, m.ID, want[i])
+		}
+	}
+}
@@ -8,18 +8,20 @@ import (
 
 // RAGPromptTemplate RAG Prompt 模板配置
 type RAGPromptTemplate struct {
-	SystemRole     string // 系统角色描述
-	KnowledgeIntro string // 知识片段介绍语
-	QuestionPrefix string // 问题前缀
-	JoinSeparator  string // 知识片段分隔符
+	SystemRole          string // 系统角色描述
+	CitationInstruction string // 引用要求，为空时不要求模型标注引用
+	KnowledgeIntro      string // 知识片段介绍语，%d 为引用编号，%s 为片段标题
+	QuestionPrefix      string // 问题前缀
+	JoinSeparator       string // 知识片段分隔符
 }
 
 // DefaultRAGPromptTemplate 默认 RAG Prompt 模板
 var DefaultRAGPromptTemplate = RAGPromptTemplate{
-	SystemRole:     "你是一个专业助手，请只基于以下知识回答，如果知识中没有相关内容，请明确说明。",
-	KnowledgeIntro: "【知识片段 %d - %s】",
-	QuestionPrefix: "\n\n问题：",
-	JoinSeparator:  "\n\n",
+	SystemRole:          "你是一个专业助手，请只基于以下知识回答，如果知识中没有相关内容，请明确说明。",
+	CitationInstruction: "每个知识片段以 [编号] 开头。回答中使用了某个片段的内容时，请在相应语句末尾用 [编号] 标注来源，如 [1] 或 [1, 3]；只能引用下面给出的编号。",
+	KnowledgeIntro:      "[%d] %s",
+	QuestionPrefix:      "\n\n问题：",
+	JoinSeparator:       "\n\n",
 }
 
 // BuildRAGPrompt 根据检索到的文档构建 RAG Prompt
@@ -27,7 +29,8 @@ func BuildRAGPrompt(query string, docs []models.Knowledge) string {
 	return BuildRAGPromptWithTemplate(query, docs, DefaultRAGPromptTemplate)
 }
 
-// BuildRAGPromptWithTemplate 使用自定义模板构建 RAG Prompt
+// BuildRAGPromptWithTemplate 使用自定义模板构建 RAG Prompt。
+// 知识片段按 docs 顺序从 1 开始编号，编号即回答中的引用编号（见 ExtractCitations）
 func BuildRAGPromptWithTemplate(query string, docs []models.Knowledge, template RAGPromptTemplate) string {
 	if len(docs) == 0 {
 		return template.SystemRole + template.QuestionPrefix + query
@@ -39,13 +42,20 @@ func BuildRAGPromptWithTemplate(query string, docs []models.Knowledge, template
 		if title == "" {
 			title = "未命名"
 		}
+		if d.HeadingPath != "" {
+			title += " / " + d.HeadingPath
+		}
 		intro := fmt.Sprintf(template.KnowledgeIntro, i+1, title)
 		knowledgeParts = append(knowledgeParts, intro+"\n"+d.Content)
 	}
 
 	knowledgeText := strings.Join(knowledgeParts, template.JoinSeparator)
 
-	return template.SystemRole + "\n\n" + knowledgeText + template.QuestionPrefix + query
+	header := template.SystemRole
+	if template.CitationInstruction != "" {
+		header += "\n" + template.CitationInstruction
+	}
+	return header + "\n\n" + knowledgeText + template.QuestionPrefix + query
 }
 
 func joinDocs(docs []models.Knowledge) string {
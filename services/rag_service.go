@@ -3,83 +3,401 @@ package services
 import (
 	"AiDemo/config"
 	"AiDemo/models"
+	"AiDemo/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"math"
+	"sync/atomic"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 const (
 	// DefaultTopK 默认检索文档数量
 	DefaultTopK = 3
 
-	// MinSimilarityThreshold 最小相似度阈值
+	// MinSimilarityThreshold 向量索引返回结果的最小相似度；回答时的最低得分与最少命中数见命名空间的回答策略
 	MinSimilarityThreshold = 0.0
+
+	// EmbedBatchSize 入库时每次向量化请求的片段数
+	EmbedBatchSize = 32
 )
 
-// SaveKnowledge 文档入库，自动切分+批量向量化
-func SaveKnowledge(title, content, source, namespace string) ([]*models.Knowledge, error) {
-	chunks := ChunkText(content, DefaultChunkSize)
+// KnowledgeInput 文档入库参数
+type KnowledgeInput struct {
+	Title     string
+	Content   string
+	Source    string
+	Namespace string
+	Tags      []string          // 自定义标签，写入每个片段，可用于检索过滤
+	Metadata  map[string]string // 文档自定义元数据
+	Chunking  ChunkOptions      // 切分策略与大小，零值使用配置的默认值
+}
 
-	embeddingModel := GetEmbeddingModelVersion()
-	vecs, err := EmbedTextBatch(chunks)
+// SaveKnowledge 文档入库：按切分策略切分+批量向量化，文档与全部片段在同一事务中写入。
+// 同一命名空间下已有相同内容的文档时不重复入库，直接返回已有文档与片段
+func SaveKnowledge(ctx context.Context, in KnowledgeInput) (*models.Document, []*models.Knowledge, error) {
+	doc, chunks, _, err := saveDocument(ctx, generateDocumentID(), in, nil, nil)
+	return doc, chunks, err
+}
+
+// ingestProgress 向量化进度回调，processed 为已完成向量化的片段数
+type ingestProgress func(processed, total int)
+
+// ingestFinish 在写入文档与片段的同一事务中执行的附加操作（如标记入库任务完成）
+type ingestFinish func(tx *gorm.DB, doc *models.Document) error
+
+// saveDocument 以指定的文档 ID 入库，progress 与 finish 可为空。
+// 同一命名空间下已有相同内容的文档时返回已有文档与片段，duplicate 为 true，finish 仍会执行
+func saveDocument(ctx context.Context, id string, in KnowledgeInput, progress ingestProgress, finish ingestFinish) (*models.Document, []*models.Knowledge, bool, error) {
+	doc := newDocument(id, in)
+
+	// 先检查一次，避免为重复内容调用向量化服务
+	existing, err := findDuplicateDocument(config.DB, doc.Namespace, doc.Checksum, "")
+	if err != nil {
+		return nil, nil, false, err
+	}
+	var chunks []*models.Knowledge
+	if existing == nil {
+		if chunks, err = buildChunks(ctx, doc, in.Chunking, progress); err != nil {
+			return nil, nil, false, err
+		}
+	}
+	return storeDocument(doc, chunks, finish)
+}
+
+// newDocument 以入库参数构造版本为 1 的新文档
+func newDocument(id string, in KnowledgeInput) *models.Document {
+	now := time.Now()
+	doc := &models.Document{
+		ID:        id,
+		Version:   1,
+		CreatedAt: now,
+	}
+	applyDocumentInput(doc, in, now)
+	return doc
+}
+
+// storeDocument 在同一事务中写入文档与片段并更新索引；同一命名空间下已有相同内容的文档时不写入，
+// 返回已有文档与片段，duplicate 为 true
+func storeDocument(doc *models.Document, chunks []*models.Knowledge, finish ingestFinish) (*models.Document, []*models.Knowledge, bool, error) {
+	doc.ChunkCount = len(chunks)
+
+	var existing *models.Document
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// 向量化期间可能有相同内容的文档先完成入库
+		var err error
+		if existing, err = findDuplicateDocument(tx, doc.Namespace, doc.Checksum, ""); err != nil {
+			return err
+		}
+		if existing != nil {
+			if finish != nil {
+				return finish(tx, existing)
+			}
+			return nil
+		}
+
+		if err := tx.Create(doc).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(chunks).Error; err != nil {
+			return err
+		}
+		if finish != nil {
+			return finish(tx, doc)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if existing != nil {
+		chunks, err := documentChunks(existing.ID)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		utils.Info("命名空间 %s 下已有相同内容的文档 %s，跳过入库", existing.Namespace, existing.ID)
+		return existing, chunks, true, nil
+	}
+
+	for _, k := range chunks {
+		indexKnowledge(*k)
+	}
+	return doc, chunks, false, nil
+}
+
+// applyDocumentInput 将入库参数写入文档并计算原文校验和
+func applyDocumentInput(doc *models.Document, in KnowledgeInput, now time.Time) {
+	doc.Title = in.Title
+	doc.Source = in.Source
+	doc.Namespace = in.Namespace
+	doc.Content = in.Content
+	doc.Checksum = contentHash(in.Content)
+	doc.Tags = models.StringList{}
+	doc.Tags = append(doc.Tags, in.Tags...)
+	doc.Metadata = models.StringMap{}
+	for k, v := range in.Metadata {
+		doc.Metadata[k] = v
+	}
+	doc.UpdatedAt = now
+}
+
+// buildChunks 切分文档原文并分批向量化，返回尚未写入数据库的有序片段；每批完成后回调 progress
+func buildChunks(ctx context.Context, doc *models.Document, opts ChunkOptions, progress ingestProgress) ([]*models.Knowledge, error) {
+	chunker, err := NewChunker(opts)
 	if err != nil {
 		return nil, err
 	}
+	chunks := chunker.Chunk(doc.Content)
+	if len(chunks) == 0 {
+		return nil, ErrEmptyContent
+	}
+	if progress != nil {
+		progress(0, len(chunks))
+	}
 
-	var results []*models.Knowledge
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = embeddingText(chunk.HeadingPath, chunk.Content)
+	}
+	embeddingModel := GetEmbeddingModelVersion()
+	vecs := make([][]float64, 0, len(chunks))
+	for start := 0; start < len(texts); start += EmbedBatchSize {
+		batch, err := EmbedTextBatch(ctx, texts[start:min(start+EmbedBatchSize, len(texts))])
+		if err != nil {
+			return nil, err
+		}
+		vecs = append(vecs, batch...)
+		if progress != nil {
+			progress(len(vecs), len(chunks))
+		}
+	}
 
+	results := make([]*models.Knowledge, 0, len(chunks))
 	for i, chunk := range chunks {
 		vecBytes, err := json.Marshal(vecs[i])
 		if err != nil {
 			return nil, err
 		}
+		results = append(results, newChunk(doc, i, chunk, string(vecBytes), embeddingModel))
+	}
+	return results, nil
+}
 
-		chunkTitle := title
-		if len(chunks) > 1 {
-			chunkTitle = title + " (片段 " + itoa(i+1) + "/" + itoa(len(chunks)) + ")"
-		}
+// newChunk 构造文档的第 index 个片段，vector 为 JSON 格式的向量
+func newChunk(doc *models.Document, index int, chunk Chunk, vector, embeddingModel string) *models.Knowledge {
+	return &models.Knowledge{
+		ID:             generateKnowledgeID(),
+		DocumentID:     doc.ID,
+		ChunkIndex:     index,
+		Title:          doc.Title,
+		Content:        chunk.Content,
+		ContentHash:    contentHash(chunk.Content),
+		HeadingPath:    chunk.HeadingPath,
+		Vector:         vector,
+		Source:         doc.Source,
+		Namespace:      doc.Namespace,
+		Tags:           doc.Tags,
+		EmbeddingModel: embeddingModel,
+		CreatedAt:      doc.UpdatedAt,
+		UpdatedAt:      doc.UpdatedAt,
+	}
+}
+
+// RetrieveResult 检索结果及查询扩展信息
+type RetrieveResult struct {
+	Docs      []ScoredDoc
+	Strategy  string          // 实际使用的查询扩展策略，keyword 模式下 hyde 退化为 none
+	Expansion *QueryExpansion // 未启用查询扩展时为 nil
+}
+
+// RetrieveRelevantDocsWithScores 按检索模式返回带分数的结果，见 Retrieve
+func RetrieveRelevantDocsWithScores(ctx context.Context, query string, opts RetrieveOptions) ([]ScoredDoc, error) {
+	result, err := Retrieve(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result.Docs, nil
+}
 
-		now := time.Now()
-		k := &models.Knowledge{
-			ID:             generateKnowledgeID(),
-			Title:          chunkTitle,
-			Content:        chunk,
-			Vector:         string(vecBytes),
-			Source:         source,
-			Namespace:      namespace,
-			EmbeddingModel: embeddingModel,
-			CreatedAt:      now,
-			UpdatedAt:      now,
+// Retrieve 按检索模式返回带分数的结果：
+// vector 为向量检索，keyword 为 BM25 关键词检索，hybrid 为两路各取候选后按 RRF 融合。
+// 启用查询扩展时，multi_query 对原问题与各改写问题分别召回后按 RRF 融合，hyde 用假设回答做向量检索（keyword 模式下跳过）。
+// 启用重排或多样化时先过量召回 RERANK_OVERFETCH × topK 个候选，按原问题重排后按 MMR 与单文档片段上限选出 topK
+func Retrieve(ctx context.Context, query string, opts RetrieveOptions) (*RetrieveResult, error) {
+	if opts.TopK <= 0 {
+		opts.TopK = DefaultTopK
+	}
+	mode, err := ParseRetrievalMode(opts.Mode)
+	if err != nil {
+		return nil, err
+	}
+	reranker, err := NewReranker(opts.Reranker)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := reranker.(*LLMReranker); ok {
+		r.SessionID = opts.SessionID
+	}
+	strategy, err := ParseQueryStrategy(opts.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	if strategy == QueryStrategyHyDE && mode == RetrievalModeKeyword {
+		// 假设回答只用于向量检索，keyword 模式下生成了也不会被使用
+		utils.Info("keyword 检索模式不使用 hyde 假设回答，跳过查询扩展")
+		strategy = QueryStrategyNone
+	}
+
+	lambda := config.MMRLambda
+	if opts.MMRLambda != nil {
+		lambda = *opts.MMRLambda
+	}
+	maxPerDoc := config.MaxChunksPerDoc
+	if opts.MaxChunksPerDoc != nil {
+		maxPerDoc = *opts.MaxChunksPerDoc
+	}
+	diversifying := lambda < 1 || maxPerDoc > 0
+
+	// 重排与多样化都需要在更大的候选集上进行
+	fetchK := opts.TopK
+	if (reranker != nil || diversifying) && config.RerankOverfetch > 1 {
+		fetchK = opts.TopK * config.RerankOverfetch
+	}
+
+	queries, expansion, err := expandQuery(ctx, strategy, query, opts.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	lists := make([][]ScoredDoc, 0, len(queries))
+	for _, q := range queries {
+		docs, err := retrieveCandidates(ctx, q, mode, opts.Filter, fetchK)
+		if err != nil {
+			return nil, err
 		}
+		lists = append(lists, docs)
+	}
+	candidates := lists[0]
+	if len(lists) > 1 {
+		candidates = fuseQueryResults(fetchK, lists)
+	}
+	candidates = dedupeByContentHash(candidates)
+	for i := range candidates {
+		candidates[i].RetrievalScore = candidates[i].Score
+	}
 
-		if err := config.DB.Create(k).Error; err != nil {
+	reranked := false
+	if reranker != nil && len(candidates) > 0 {
+		if candidates, reranked, err = rerankCandidates(ctx, reranker, query, candidates); err != nil {
 			return nil, err
 		}
+	}
+	if diversifying {
+		candidates = diversify(candidates, opts.TopK, lambda, maxPerDoc, reranked)
+	} else if len(candidates) > opts.TopK {
+		candidates = candidates[:opts.TopK]
+	}
+	return &RetrieveResult{Docs: candidates, Strategy: strategy, Expansion: expansion}, nil
+}
 
-		results = append(results, k)
+// retrieveCandidates 按检索模式召回 topK 个候选
+func retrieveCandidates(ctx context.Context, query searchQuery, mode string, filter models.SearchFilter, topK int) ([]ScoredDoc, error) {
+	switch mode {
+	case RetrievalModeKeyword:
+		return keywordSearch(filter, query.keyword, topK)
+	case RetrievalModeVector:
+		return vectorSearch(ctx, query.vector, filter, topK)
 	}
 
-	return results, nil
+	depth := hybridCandidateDepth(topK)
+	vectorFilter := filter
+	queryVec, err := queryVector(ctx, query.vector, &vectorFilter)
+	if err != nil {
+		return nil, err
+	}
+	vectorDocs := []ScoredDoc{}
+	if queryVec != nil {
+		if vectorDocs, err = defaultVectorStore.Search(queryVec, vectorFilter, depth); err != nil {
+			return nil, err
+		}
+	}
+	keywordDocs, err := keywordSearch(filter, query.keyword, depth)
+	if err != nil {
+		return nil, err
+	}
+	fused := fuseRRF(topK, vectorDocs, keywordDocs)
+	fillVectorScores(fused, queryVec, vectorFilter.EmbeddingModel)
+	return fused, nil
+}
+
+// fillVectorScores 为只由关键词召回的候选补算与查询向量的余弦相似度（负值记为 0），
+// 使回答策略的最低得分对 hybrid 的全部候选同样适用；片段的向量模型与 model 不一致时无法比较，保持为 0
+func fillVectorScores(docs []ScoredDoc, queryVec []float64, model string) {
+	if queryVec == nil {
+		return
+	}
+	for i := range docs {
+		d := &docs[i]
+		if d.VectorScore != 0 || d.Doc.Vector == "" || d.Doc.EmbeddingModel != model {
+			continue
+		}
+		var vec []float64
+		if err := json.Unmarshal([]byte(d.Doc.Vector), &vec); err != nil {
+			continue
+		}
+		d.VectorScore = max(cosineSimilarity(queryVec, vec), 0)
+	}
 }
 
-// RetrieveRelevantDocsWithScores 返回带相似度分数的结果
-func RetrieveRelevantDocsWithScores(query, namespace string, topK int) ([]ScoredDoc, error) {
-	if topK <= 0 {
-		topK = DefaultTopK
+// dedupeByContentHash 内容完全相同的片段只保留排名最靠前的一个，避免重复内容挤占结果
+func dedupeByContentHash(candidates []ScoredDoc) []ScoredDoc {
+	seen := make(map[string]struct{}, len(candidates))
+	result := candidates[:0]
+	for _, c := range candidates {
+		if c.Doc.ContentHash != "" {
+			if _, ok := seen[c.Doc.ContentHash]; ok {
+				continue
+			}
+			seen[c.Doc.ContentHash] = struct{}{}
+		}
+		result = append(result, c)
 	}
+	return result
+}
 
-	queryVec, err := EmbedText(query)
+// vectorSearch 向量检索。查询向量由当前模型生成，过滤条件指定了其他向量模型时没有可比较的片段
+func vectorSearch(ctx context.Context, query string, filter models.SearchFilter, topK int) ([]ScoredDoc, error) {
+	queryVec, err := queryVector(ctx, query, &filter)
 	if err != nil {
 		return nil, err
 	}
+	if queryVec == nil {
+		return []ScoredDoc{}, nil
+	}
+	return defaultVectorStore.Search(queryVec, filter, topK)
+}
 
-	return defaultVectorStore.Search(queryVec, namespace, topK)
+// queryVector 用当前向量模型生成查询向量，并将 filter 限定为当前模型；
+// 过滤条件指定了其他向量模型时返回 nil
+func queryVector(ctx context.Context, query string, filter *models.SearchFilter) ([]float64, error) {
+	active := GetEmbeddingModelVersion()
+	if filter.EmbeddingModel == "" {
+		filter.EmbeddingModel = active
+	} else if filter.EmbeddingModel != active {
+		utils.Warning("过滤条件指定的向量模型 %s 与当前模型 %s 不一致，跳过向量检索", filter.EmbeddingModel, active)
+		return nil, nil
+	}
+	return EmbedText(ctx, query)
 }
 
 // RetrieveRelevantDocs 根据查询语句检索相关文档
-func RetrieveRelevantDocs(query string, topK int) ([]models.Knowledge, error) {
-	scored, err := RetrieveRelevantDocsWithScores(query, "", topK)
+func RetrieveRelevantDocs(ctx context.Context, query string, topK int) ([]models.Knowledge, error) {
+	scored, err := RetrieveRelevantDocsWithScores(ctx, query, RetrieveOptions{TopK: topK})
 	if err != nil {
 		return nil, err
 	}
@@ -91,8 +409,8 @@ func RetrieveRelevantDocs(query string, topK int) ([]models.Knowledge, error) {
 }
 
 // RetrieveRelevantDocsByNamespace 根据命名空间检索相关文档
-func RetrieveRelevantDocsByNamespace(query string, namespace string, topK int) ([]models.Knowledge, error) {
-	scored, err := RetrieveRelevantDocsWithScores(query, namespace, topK)
+func RetrieveRelevantDocsByNamespace(ctx context.Context, query string, namespace string, topK int) ([]models.Knowledge, error) {
+	scored, err := RetrieveRelevantDocsWithScores(ctx, query, RetrieveOptions{Filter: models.SearchFilter{Namespace: namespace}, TopK: topK})
 	if err != nil {
 		return nil, err
 	}
@@ -103,8 +421,52 @@ func RetrieveRelevantDocsByNamespace(query string, namespace string, topK int) (
 	return result, nil
 }
 
+// indexKnowledge 片段写入后同步关键词索引与向量索引
+func indexKnowledge(docs ...models.Knowledge) {
+	for _, d := range docs {
+		defaultKeywordIndex.Add(d.ID, d.Namespace, keywordText(d))
+	}
+	indexVectors(docs...)
+}
+
+// unindexKnowledge 片段删除后从关键词索引与向量索引中移除
+func unindexKnowledge(ids ...string) {
+	for _, id := range ids {
+		defaultKeywordIndex.Remove(id)
+	}
+	unindexVectors(ids...)
+}
+
+// contentHash 内容的 SHA-256（十六进制），用作文档校验和与片段去重键
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// embeddingText 参与向量化的文本：标题路径为片段提供章节上下文
+func embeddingText(headingPath, content string) string {
+	if headingPath == "" {
+		return content
+	}
+	return headingPath + "\n" + content
+}
+
+// knowledgeIDPrefix 片段 ID 前缀，用于区分片段 ID 与文档 ID（doc_…）
+const knowledgeIDPrefix = "k_"
+
 func generateKnowledgeID() string {
-	return "k_" + itoa(int(time.Now().UnixNano()))
+	return knowledgeIDPrefix + itoa(int(idSeq.Add(1)))
+}
+
+func generateDocumentID() string {
+	return "doc_" + itoa(int(idSeq.Add(1)))
+}
+
+// idSeq 以纳秒时间戳为起点递增，同一批生成的 ID 不会重复
+var idSeq atomic.Int64
+
+func init() {
+	idSeq.Store(time.Now().UnixNano())
 }
 
 // 计算余弦相似度
@@ -141,3 +503,6 @@ func itoa(i int) string {
 }
 
 var ErrNoKnowledge = errors.New("no knowledge found")
+
+// ErrEmptyContent 文档内容为空，切分后没有片段
+var ErrEmptyContent = errors.New("文档内容为空")
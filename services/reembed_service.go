@@ -0,0 +1,362 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"AiDemo/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultReembedBatchSize 向量重建默认批大小
+const DefaultReembedBatchSize = 32
+
+// ErrReembedRunning 已有重建任务在执行
+var ErrReembedRunning = errors.New("已有向量重建任务在执行")
+
+// 同一时间只允许一个重建任务执行：以 reembed_jobs 中的 running 记录为准，命令行与服务进程之间同样互斥。
+// 执行中的任务定期刷新 updated_at，超过 reembedLeaseTimeout 未刷新的 running 记录视为进程已退出，可以续跑
+const (
+	reembedHeartbeat    = 5 * time.Second
+	reembedLeaseTimeout = 30 * time.Second
+)
+
+// ReembedService 向量重建服务：嵌入模型变更后，将旧模型生成的向量分批重新生成。
+// 已重建的片段不再匹配过期条件，因此任务中断后从剩余的过期片段继续即可，无需额外游标
+type ReembedService struct{}
+
+// NewReembedService 创建新的向量重建服务实例
+func NewReembedService() *ReembedService {
+	return &ReembedService{}
+}
+
+// CountStaleKnowledge 统计向量模型版本与 embeddingModel 不一致的知识片段数，namespace 为空时统计全部
+func CountStaleKnowledge(namespace, embeddingModel string) (int64, error) {
+	var count int64
+	err := staleKnowledgeQuery(namespace, embeddingModel).Count(&count).Error
+	return count, err
+}
+
+// staleKnowledgeQuery 构造过期片段查询
+func staleKnowledgeQuery(namespace, embeddingModel string) *gorm.DB {
+	db := config.DB.Model(&models.Knowledge{}).
+		Where("(embedding_model IS NULL OR embedding_model <> ?)", embeddingModel)
+	if namespace != "" {
+		db = db.Where("namespace = ?", namespace)
+	}
+	return db
+}
+
+// Status 返回当前向量模型、剩余过期片段数与最近一次任务
+func (s *ReembedService) Status(namespace string) (*models.ReembedStatus, error) {
+	active := GetEmbeddingModelVersion()
+	stale, err := CountStaleKnowledge(namespace, active)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &models.ReembedStatus{ActiveModel: active, StaleCount: stale}
+	var job models.ReembedJob
+	err = config.DB.Order("id DESC").First(&job).Error
+	switch {
+	case err == nil:
+		status.Job = &job
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+	return status, nil
+}
+
+// GetJob 根据 ID 获取重建任务
+func (s *ReembedService) GetJob(id uint) (*models.ReembedJob, error) {
+	var job models.ReembedJob
+	if err := config.DB.First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Start 在后台发起（或续跑）重建任务，立即返回任务快照
+func (s *ReembedService) Start(namespace string, batchSize int) (*models.ReembedJob, error) {
+	job, err := s.claim(namespace, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := *job
+	go s.execute(context.Background(), job)
+	return &snapshot, nil
+}
+
+// Run 在当前 goroutine 中执行（或续跑）重建任务直到结束，供命令行使用；ctx 取消时任务标记为中断
+func (s *ReembedService) Run(ctx context.Context, namespace string, batchSize int) (*models.ReembedJob, error) {
+	job, err := s.claim(namespace, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	s.execute(ctx, job)
+	if job.Status != models.ReembedStatusCompleted {
+		return job, errors.New(job.Error)
+	}
+	return job, nil
+}
+
+// ResumeReembedJobs 启动时续跑上次未完成的重建任务
+func ResumeReembedJobs() {
+	var job models.ReembedJob
+	err := config.DB.Where("status IN ?", []string{models.ReembedStatusRunning, models.ReembedStatusInterrupted}).
+		Order("id DESC").First(&job).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.Error("查询未完成的向量重建任务失败: %v", err)
+		}
+		return
+	}
+
+	// 上次进程退出前刚刷新过心跳的任务，等租约过期后再续跑，期间若有其他进程接手则不再重复执行
+	wait := reembedLeaseTimeout - time.Since(job.UpdatedAt)
+	if job.Status != models.ReembedStatusRunning || wait < 0 {
+		wait = 0
+	}
+	utils.Info("发现未完成的向量重建任务 #%d，%s 后继续执行", job.ID, wait.Round(time.Second))
+	time.AfterFunc(wait, func() {
+		if _, err := NewReembedService().Start(job.Namespace, job.BatchSize); err != nil {
+			if errors.Is(err, ErrReembedRunning) {
+				utils.Info("向量重建任务 #%d 已由其他进程执行，跳过续跑", job.ID)
+				return
+			}
+			utils.Error("续跑向量重建任务失败: %v", err)
+		}
+	})
+}
+
+// claim 占用执行权，复用同一目标模型与命名空间下未完成的任务，否则新建任务。
+// 执行权由 acquire 中的一条条件 UPDATE 决定，多个进程同时发起时只有一个能成功
+func (s *ReembedService) claim(namespace string, batchSize int) (*models.ReembedJob, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultReembedBatchSize
+	}
+	target := GetEmbeddingModelVersion()
+
+	var unfinished []models.ReembedJob
+	if err := config.DB.Where("status IN ?", []string{models.ReembedStatusRunning, models.ReembedStatusInterrupted}).
+		Order("id DESC").Find(&unfinished).Error; err != nil {
+		return nil, err
+	}
+	var job *models.ReembedJob
+	for i := range unfinished {
+		j := &unfinished[i]
+		if j.Status == models.ReembedStatusRunning && time.Since(j.UpdatedAt) < reembedLeaseTimeout {
+			return nil, ErrReembedRunning
+		}
+		if job == nil && j.TargetModel == target && j.Namespace == namespace {
+			job = j
+		}
+	}
+
+	created := false
+	if job == nil {
+		stale, err := CountStaleKnowledge(namespace, target)
+		if err != nil {
+			return nil, err
+		}
+		// 新任务先以可续跑状态写入，抢占执行权成功后才切换为 running
+		job = &models.ReembedJob{
+			Status:      models.ReembedStatusInterrupted,
+			Namespace:   namespace,
+			TargetModel: target,
+			Total:       int(stale),
+		}
+		if err := config.DB.Create(job).Error; err != nil {
+			return nil, err
+		}
+		created = true
+	}
+
+	if err := s.acquire(job, batchSize); err != nil {
+		if created {
+			if delErr := config.DB.Delete(&models.ReembedJob{}, job.ID).Error; delErr != nil {
+				utils.Warning("删除未执行的向量重建任务 #%d 失败: %v", job.ID, delErr)
+			}
+		}
+		return nil, err
+	}
+
+	// 目标模型或范围已变化的旧任务不再续跑
+	if err := config.DB.Model(&models.ReembedJob{}).
+		Where("id <> ? AND status IN ?", job.ID, []string{models.ReembedStatusRunning, models.ReembedStatusInterrupted}).
+		UpdateColumns(map[string]interface{}{
+			"status":     models.ReembedStatusFailed,
+			"error":      "已被新的重建任务取代",
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// acquire 以一条条件 UPDATE 将任务切换为 running：任务本身不在执行（或租约已过期），
+// 且没有其他租约有效的 running 任务时才会更新成功，否则返回 ErrReembedRunning
+func (s *ReembedService) acquire(job *models.ReembedJob, batchSize int) error {
+	now := time.Now()
+	expired := now.Add(-reembedLeaseTimeout)
+	res := config.DB.Model(&models.ReembedJob{}).
+		Where("id = ? AND (status <> ? OR updated_at < ?)", job.ID, models.ReembedStatusRunning, expired).
+		Where("NOT EXISTS (SELECT 1 FROM reembed_jobs AS other WHERE other.id <> ? AND other.status = ? AND other.updated_at >= ?)",
+			job.ID, models.ReembedStatusRunning, expired).
+		UpdateColumns(map[string]interface{}{
+			"status":     models.ReembedStatusRunning,
+			"batch_size": batchSize,
+			"error":      "",
+			"updated_at": now,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrReembedRunning
+	}
+	job.Status = models.ReembedStatusRunning
+	job.BatchSize = batchSize
+	job.Error = ""
+	job.UpdatedAt = now
+	return nil
+}
+
+// execute 分批重建直到没有过期片段，每批完成后持久化进度
+func (s *ReembedService) execute(ctx context.Context, job *models.ReembedJob) {
+	stop := s.heartbeat(job.ID)
+	defer stop()
+
+	if job.StartedAt == nil {
+		now := time.Now()
+		job.StartedAt = &now
+	}
+	utils.Info("向量重建任务 #%d 开始: 目标模型=%s, 命名空间=%q, 进度 %d/%d",
+		job.ID, job.TargetModel, job.Namespace, job.Processed, job.Total)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			s.finish(job, models.ReembedStatusInterrupted, err)
+			return
+		}
+
+		n, err := s.reembedBatch(ctx, job)
+		if err != nil {
+			status := models.ReembedStatusFailed
+			if ctx.Err() != nil {
+				status = models.ReembedStatusInterrupted
+			}
+			s.finish(job, status, err)
+			return
+		}
+		if n == 0 {
+			s.finish(job, models.ReembedStatusCompleted, nil)
+			return
+		}
+
+		job.Processed += n
+		if job.Processed > job.Total {
+			job.Total = job.Processed
+		}
+		if err := config.DB.Save(job).Error; err != nil {
+			utils.Error("保存向量重建进度失败: %v", err)
+		}
+		utils.Info("向量重建任务 #%d 进度: %d/%d", job.ID, job.Processed, job.Total)
+	}
+}
+
+// heartbeat 定期刷新任务的 updated_at，表明任务仍在执行，返回停止函数
+func (s *ReembedService) heartbeat(id uint) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(reembedHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := config.DB.Model(&models.ReembedJob{}).Where("id = ? AND status = ?", id, models.ReembedStatusRunning).
+					Update("updated_at", time.Now()).Error; err != nil {
+					utils.Warning("刷新向量重建任务 #%d 心跳失败: %v", id, err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// reembedBatch 取一批过期片段重新向量化并写回，返回本批处理的片段数
+func (s *ReembedService) reembedBatch(ctx context.Context, job *models.ReembedJob) (int, error) {
+	var batch []models.Knowledge
+	err := staleKnowledgeQuery(job.Namespace, job.TargetModel).
+		Select("id", "content", "heading_path", "namespace").Order("id").Limit(job.BatchSize).Find(&batch).Error
+	if err != nil || len(batch) == 0 {
+		return 0, err
+	}
+
+	texts := make([]string, len(batch))
+	for i, k := range batch {
+		texts[i] = embeddingText(k.HeadingPath, k.Content)
+	}
+	vecs, err := EmbedTextBatch(ctx, texts)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range batch {
+			k := &batch[i]
+			vecBytes, err := json.Marshal(vecs[i])
+			if err != nil {
+				return err
+			}
+			k.Vector = string(vecBytes)
+			k.EmbeddingModel = job.TargetModel
+			k.UpdatedAt = now
+			if err := tx.Model(&models.Knowledge{}).Where("id = ?", k.ID).Updates(map[string]interface{}{
+				"vector":          k.Vector,
+				"embedding_model": k.EmbeddingModel,
+				"updated_at":      k.UpdatedAt,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	indexVectors(batch...)
+	return len(batch), nil
+}
+
+// finish 记录任务结束状态
+func (s *ReembedService) finish(job *models.ReembedJob, status string, err error) {
+	job.Status = status
+	if err != nil {
+		job.Error = err.Error()
+	}
+	if status == models.ReembedStatusCompleted {
+		now := time.Now()
+		job.FinishedAt = &now
+	}
+	if saveErr := config.DB.Save(job).Error; saveErr != nil {
+		utils.Error("保存向量重建任务状态失败: %v", saveErr)
+	}
+	resetStaleVectorCheck()
+
+	switch status {
+	case models.ReembedStatusCompleted:
+		utils.Info("向量重建任务 #%d 完成: 共重建 %d 个片段", job.ID, job.Processed)
+	case models.ReembedStatusInterrupted:
+		utils.Warning("向量重建任务 #%d 已中断，进度 %d/%d，可稍后续跑: %v", job.ID, job.Processed, job.Total, err)
+	default:
+		utils.Error("向量重建任务 #%d 失败，进度 %d/%d: %v", job.ID, job.Processed, job.Total, err)
+	}
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"AiDemo/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// 重排器名称
+const (
+	RerankerNone    = "none"    // 不重排
+	RerankerLexical = "lexical" // 本地词项重合度重排
+	RerankerLLM     = "llm"     // 大模型打分重排
+)
+
+// Reranker 检索结果重排：对过量召回的候选重新打分，按新分数降序返回。
+// 实现只写入 RerankScore，Score 与 RetrievalScore 保留检索得分
+type Reranker interface {
+	Name() string
+	Rerank(ctx context.Context, query string, docs []ScoredDoc) ([]ScoredDoc, error)
+}
+
+// NewReranker 根据名称创建重排器，none 返回 nil；为空时使用配置的默认重排器
+func NewReranker(name string) (Reranker, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = config.Reranker
+	}
+	switch name {
+	case RerankerNone:
+		return nil, nil
+	case RerankerLexical:
+		return &LexicalReranker{}, nil
+	case RerankerLLM:
+		return &LLMReranker{MaxContentRunes: config.RerankMaxContent}, nil
+	default:
+		return nil, fmt.Errorf("不支持的重排器: %s（可选 none / lexical / llm）", name)
+	}
+}
+
+// sortReranked 按重排得分降序排序，同分时保持原检索顺序
+func sortReranked(docs []ScoredDoc) []ScoredDoc {
+	sort.SliceStable(docs, func(i, j int) bool { return docs[i].RerankScore > docs[j].RerankScore })
+	return docs
+}
+
+// LexicalReranker 本地词项重合度重排：查询词项在片段标题与正文中的覆盖率，
+// 词项按长度加权，使 SKU、错误码等长编码的命中比单个二元组更重要
+type LexicalReranker struct{}
+
+// Name 重排器名称
+func (r *LexicalReranker) Name() string {
+	return RerankerLexical
+}
+
+// Rerank 按覆盖率重新打分，得分范围 [0, 1]
+func (r *LexicalReranker) Rerank(ctx context.Context, query string, docs []ScoredDoc) ([]ScoredDoc, error) {
+	queryTerms := map[string]float64{}
+	var total float64
+	for _, t := range TokenizeKeywords(query) {
+		if _, ok := queryTerms[t]; ok {
+			continue
+		}
+		w := float64(utf8.RuneCountInString(t))
+		queryTerms[t] = w
+		total += w
+	}
+
+	for i := range docs {
+		var matched float64
+		if total > 0 {
+			docTerms := map[string]struct{}{}
+			for _, t := range TokenizeKeywords(keywordText(docs[i].Doc)) {
+				docTerms[t] = struct{}{}
+			}
+			for t, w := range queryTerms {
+				if _, ok := docTerms[t]; ok {
+					matched += w
+				}
+			}
+			matched /= total
+		}
+		docs[i].RerankScore = matched
+	}
+	return sortReranked(docs), nil
+}
+
+// LLMReranker 大模型打分重排：一次调用对全部候选的相关性打 0-10 分
+type LLMReranker struct {
+	MaxContentRunes int    // 每个候选发送给模型的最大字符数
+	SessionID       string // 打分调用的用量计入的会话，为空时不关联会话
+}
+
+// Name 重排器名称
+func (r *LLMReranker) Name() string {
+	return RerankerLLM
+}
+
+// llmRerankScore 大模型返回的单条打分
+type llmRerankScore struct {
+	ID    int     `json:"id"`
+	Score float64 `json:"score"`
+}
+
+// Rerank 请求大模型打分，得分归一化到 [0, 1]；模型未给出分数的候选记为 0
+func (r *LLMReranker) Rerank(ctx context.Context, query string, docs []ScoredDoc) ([]ScoredDoc, error) {
+	var sb strings.Builder
+	sb.WriteString("问题：" + query + "\n\n候选片段：\n")
+	for i, d := range docs {
+		content := d.Doc.Content
+		if r.MaxContentRunes > 0 && utf8.RuneCountInString(content) > r.MaxContentRunes {
+			content = string([]rune(content)[:r.MaxContentRunes]) + "…"
+		}
+		sb.WriteString(fmt.Sprintf("[%d] %s\n%s\n\n", i+1, d.Doc.Title, content))
+	}
+
+	messages := []models.Message{
+		{Role: "system", Content: "你是检索结果的相关性评估器。请判断每个候选片段对回答问题的帮助程度，" +
+			"按 0-10 打分（10 表示直接包含答案，0 表示无关）。只输出 JSON 数组，不要输出其他内容，" +
+			`格式如：[{"id":1,"score":8},{"id":2,"score":0}]`},
+		{Role: "user", Content: sb.String()},
+	}
+
+	result, err := GetChatProvider().Chat(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	RecordUsage(r.SessionID, "rerank", "system", result)
+
+	scores, err := parseLLMRerankScores(result.Content)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]float64, len(scores))
+	for _, s := range scores {
+		byID[s.ID] = s.Score
+	}
+	for i := range docs {
+		docs[i].RerankScore = byID[i+1] / 10
+	}
+	return sortReranked(docs), nil
+}
+
+// parseLLMRerankScores 从模型输出中提取 JSON 数组（容忍代码块包裹与前后说明文字）
+func parseLLMRerankScores(content string) ([]llmRerankScore, error) {
+	start := strings.Index(content, "[")
+	end := strings.LastIndex(content, "]")
+	if start < 0 || end <= start {
+		return nil, fmt.Errorf("重排结果不是 JSON 数组: %s", content)
+	}
+	var scores []llmRerankScore
+	if err := json.Unmarshal([]byte(content[start:end+1]), &scores); err != nil {
+		return nil, fmt.Errorf("解析重排结果失败: %w", err)
+	}
+	return scores, nil
+}
+
+// rerankCandidates 执行重排，返回的布尔值表示是否按重排得分排序；
+// 重排失败时记录警告并保留检索顺序，调用方已取消时返回错误
+func rerankCandidates(ctx context.Context, reranker Reranker, query string, docs []ScoredDoc) ([]ScoredDoc, bool, error) {
+	original := append([]ScoredDoc(nil), docs...)
+	reranked, err := reranker.Rerank(ctx, query, docs)
+	if err == nil {
+		return reranked, true, nil
+	}
+	if ctx.Err() != nil {
+		return nil, false, wrapContextError(ctx, ctx.Err())
+	}
+	utils.Warning("重排器[%s]执行失败，保留检索顺序: %v", reranker.Name(), err)
+	return original, false, nil
+}
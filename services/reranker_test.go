@@ -0,0 +1,57 @@
+package services
+
+import (
+	"AiDemo/models"
+	"context"
+	"errors"
+	"testing"
+)
+
+// failingReranker 总是返回错误的重排器替身
+type failingReranker struct{}
+
+func (failingReranker) Name() string { return "failing" }
+
+func (failingReranker) Rerank(ctx context.Context, query string, docs []ScoredDoc) ([]ScoredDoc, error) {
+	for i := range docs {
+		docs[i].RerankScore = 1
+	}
+	return nil, errors.New("上游不可用")
+}
+
+func TestLexicalRerankerKeepsRetrievalScore(t *testing.T) {
+	docs := []ScoredDoc{
+		{Doc: models.Knowledge{ID: "a", Title: "发货时间", Content: "下单后 48 小时内发货"}, Score: 0.9},
+		{Doc: models.Knowledge{ID: "b", Title: "退货政策", Content: "SKU-1024 支持七天无理由退货"}, Score: 0.5},
+	}
+	got, err := (&LexicalReranker{}).Rerank(context.Background(), "SKU-1024 怎么退货", docs)
+	if err != nil {
+		t.Fatalf("Rerank 返回错误: %v", err)
+	}
+	if got[0].Doc.ID != "b" || got[1].Doc.ID != "a" {
+		t.Fatalf("重排顺序 = %s,%s，期望 b,a", got[0].Doc.ID, got[1].Doc.ID)
+	}
+	if got[0].Score != 0.5 || got[1].Score != 0.9 {
+		t.Errorf("重排改写了检索得分: %v, %v", got[0].Score, got[1].Score)
+	}
+	if got[0].RerankScore <= 0 || got[0].RerankScore > 1 || got[1].RerankScore != 0 {
+		t.Errorf("重排得分 = %v, %v", got[0].RerankScore, got[1].RerankScore)
+	}
+}
+
+func TestRerankCandidatesFailure(t *testing.T) {
+	docs := []ScoredDoc{{Doc: models.Knowledge{ID: "a"}, Score: 0.03}, {Doc: models.Knowledge{ID: "b"}, Score: 0.02}}
+	got, reranked, err := rerankCandidates(context.Background(), failingReranker{}, "q", docs)
+	if err != nil || reranked {
+		t.Fatalf("重排失败时应保留检索顺序，实际 reranked=%v, err=%v", reranked, err)
+	}
+	if got[0].Doc.ID != "a" || got[0].RerankScore != 0 || got[0].Score != 0.03 {
+		t.Errorf("保留的结果 = %+v", got[0])
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := rerankCandidates(ctx, failingReranker{}, "q", docs); err == nil {
+		t.Error("调用方已取消时应返回错误")
+	}
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"AiDemo/models"
+	"AiDemo/utils"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// RetryPolicy 重试策略：指数退避 + 全抖动
+type RetryPolicy struct {
+	MaxRetries int           // 最大重试次数（不含首次调用）
+	BaseDelay  time.Duration // 首次退避基准时长
+	MaxDelay   time.Duration // 单次退避上限
+}
+
+// ResilientProvider 为任意 ChatProvider 增加重试与熔断能力
+type ResilientProvider struct {
+	inner   ChatProvider
+	retry   RetryPolicy
+	breaker *CircuitBreaker
+}
+
+// NewResilientProvider 包装对话服务
+func NewResilientProvider(inner ChatProvider, retry RetryPolicy, breaker *CircuitBreaker) *ResilientProvider {
+	return &ResilientProvider{
+		inner:   inner,
+		retry:   retry,
+		breaker: breaker,
+	}
+}
+
+// Name 服务提供方名称
+func (p *ResilientProvider) Name() string {
+	return p.inner.Name()
+}
+
+// Model 当前使用的模型 ID
+func (p *ResilientProvider) Model() string {
+	return p.inner.Model()
+}
+
+// Breaker 返回熔断器，供健康检查读取状态
+func (p *ResilientProvider) Breaker() *CircuitBreaker {
+	return p.breaker
+}
+
+// Chat 带重试与熔断的非流式调用
+func (p *ResilientProvider) Chat(ctx context.Context, messages []models.Message) (ChatResult, error) {
+	var reply ChatResult
+	err := p.do(ctx, func() (bool, error) {
+		var err error
+		reply, err = p.inner.Chat(ctx, messages)
+		return true, err
+	})
+	return reply, err
+}
+
+// ChatStream 带重试与熔断的流式调用；已向调用方推送过增量后不再重试，避免内容重复
+func (p *ResilientProvider) ChatStream(ctx context.Context, messages []models.Message, onDelta StreamDeltaFunc) (ChatResult, error) {
+	var reply ChatResult
+	err := p.do(ctx, func() (bool, error) {
+		started := false
+		var err error
+		reply, err = p.inner.ChatStream(ctx, messages, func(delta string) error {
+			started = true
+			return onDelta(delta)
+		})
+		return !started, err
+	})
+	return reply, err
+}
+
+// do 执行一次带重试的调用，call 返回本次失败是否仍允许重试
+func (p *ResilientProvider) do(ctx context.Context, call func() (bool, error)) error {
+	for attempt := 0; ; attempt++ {
+		if err := p.breaker.Allow(); err != nil {
+			utils.Warning("大模型调用被熔断器拒绝: %v", err)
+			return err
+		}
+
+		canRetry, err := call()
+		p.record(err)
+		if err == nil {
+			return nil
+		}
+
+		if !canRetry || attempt >= p.retry.MaxRetries || !isRetryable(ctx, err) {
+			return err
+		}
+
+		delay, ok := p.backoff(ctx, attempt, err)
+		if !ok {
+			utils.Warning("上游要求 %s 后重试，超过退避上限或请求剩余时间，不再重试: %v", delay.Round(time.Millisecond), err)
+			return err
+		}
+		utils.Warning("大模型调用失败，%s 后进行第 %d 次重试: %v", delay.Round(time.Millisecond), attempt+1, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return wrapContextError(ctx, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// record 将调用结果计入熔断器：服务端错误、超时与网络错误视为失败，客户端取消与 4xx 不计入
+func (p *ResilientProvider) record(err error) {
+	if err == nil {
+		p.breaker.Success()
+		return
+	}
+
+	var upErr *UpstreamError
+	var canceledErr *CanceledError
+	switch {
+	case errors.As(err, &canceledErr):
+		p.breaker.Release()
+	case errors.As(err, &upErr) && upErr.StatusCode < 500:
+		p.breaker.Release()
+	default:
+		p.breaker.Failure()
+	}
+}
+
+// backoff 计算第 attempt 次重试前的等待时长：指数退避 + 全抖动，且不短于 Retry-After。
+// Retry-After 超过 MaxDelay 或请求剩余时间时返回 false，调用方直接返回上游错误，避免长时间占用请求
+func (p *ResilientProvider) backoff(ctx context.Context, attempt int, err error) (time.Duration, bool) {
+	ceiling := p.retry.BaseDelay << attempt
+	if ceiling <= 0 || (p.retry.MaxDelay > 0 && ceiling > p.retry.MaxDelay) {
+		ceiling = p.retry.MaxDelay
+	}
+
+	var delay time.Duration
+	if ceiling > 0 {
+		delay = time.Duration(rand.Int63n(int64(ceiling) + 1))
+	}
+
+	var upErr *UpstreamError
+	if errors.As(err, &upErr) && upErr.RetryAfter > delay {
+		delay = upErr.RetryAfter
+		if p.retry.MaxDelay > 0 && delay > p.retry.MaxDelay {
+			return delay, false
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return delay, false
+	}
+	return delay, true
+}
+
+// isRetryable 只重试 429/5xx 与连接类传输错误；超时、取消以及响应解析失败、空结果等确定性错误不重试
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var upErr *UpstreamError
+	if errors.As(err, &upErr) {
+		return upErr.Retryable()
+	}
+
+	var timeoutErr *TimeoutError
+	var canceledErr *CanceledError
+	if errors.As(err, &timeoutErr) || errors.As(err, &canceledErr) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"AiDemo/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// flakyProvider 依次返回预设错误的对话服务替身，错误用完后返回成功
+type flakyProvider struct {
+	errs  []error
+	calls int
+}
+
+func (p *flakyProvider) Name() string  { return "flaky" }
+func (p *flakyProvider) Model() string { return "flaky-model" }
+
+func (p *flakyProvider) Chat(ctx context.Context, messages []models.Message) (ChatResult, error) {
+	p.calls++
+	if p.calls <= len(p.errs) {
+		return ChatResult{}, p.errs[p.calls-1]
+	}
+	return ChatResult{Content: "ok"}, nil
+}
+
+func (p *flakyProvider) ChatStream(ctx context.Context, messages []models.Message, onDelta StreamDeltaFunc) (ChatResult, error) {
+	p.calls++
+	if err := onDelta("部分"); err != nil {
+		return ChatResult{}, err
+	}
+	if p.calls <= len(p.errs) {
+		return ChatResult{Content: "部分"}, p.errs[p.calls-1]
+	}
+	return ChatResult{Content: "部分"}, nil
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"429", &UpstreamError{StatusCode: 429}, true},
+		{"503", &UpstreamError{StatusCode: 503}, true},
+		{"400", &UpstreamError{StatusCode: 400}, false},
+		{"401", &UpstreamError{StatusCode: 401}, false},
+		{"连接被拒绝", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"响应被截断", fmt.Errorf("读取响应: %w", io.ErrUnexpectedEOF), true},
+		{"超时", &TimeoutError{Err: context.DeadlineExceeded}, false},
+		{"取消", &CanceledError{Err: context.Canceled}, false},
+		{"JSON 解析失败", json.Unmarshal([]byte("<html>"), &struct{}{}), false},
+		{"空结果", fmt.Errorf("API返回空结果"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(context.Background(), tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v，期望 %v", tt.err, got, tt.want)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if isRetryable(ctx, &UpstreamError{StatusCode: 503}) {
+		t.Error("调用方已取消时不应重试")
+	}
+}
+
+func TestResilientProviderRetry(t *testing.T) {
+	retryable := &UpstreamError{StatusCode: 502}
+	tests := []struct {
+		name      string
+		errs      []error
+		stream    bool
+		wantCalls int
+		wantErr   bool
+		wantState CircuitState
+	}{
+		{name: "重试后成功", errs: []error{retryable, retryable}, wantCalls: 3, wantState: CircuitClosed},
+		{name: "超过最大重试次数", errs: []error{retryable, retryable, retryable}, wantCalls: 3, wantErr: true, wantState: CircuitOpen},
+		{name: "确定性错误不重试", errs: []error{fmt.Errorf("API返回空结果")}, wantCalls: 1, wantErr: true, wantState: CircuitClosed},
+		{name: "4xx 不重试也不计入熔断", errs: []error{&UpstreamError{StatusCode: 400}}, wantCalls: 1, wantErr: true, wantState: CircuitClosed},
+		{name: "流式已推送增量后不重试", errs: []error{retryable}, stream: true, wantCalls: 1, wantErr: true, wantState: CircuitClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &flakyProvider{errs: tt.errs}
+			p := NewResilientProvider(inner, RetryPolicy{MaxRetries: 2}, NewCircuitBreaker("flaky", 3, time.Minute))
+
+			var err error
+			if tt.stream {
+				_, err = p.ChatStream(context.Background(), testMessages, func(string) error { return nil })
+			} else {
+				_, err = p.Chat(context.Background(), testMessages)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("错误 = %v，期望错误: %v", err, tt.wantErr)
+			}
+			if inner.calls != tt.wantCalls {
+				t.Errorf("调用次数 = %d，期望 %d", inner.calls, tt.wantCalls)
+			}
+			if got := p.Breaker().Stats().State; got != tt.wantState.String() {
+				t.Errorf("熔断器状态 = %s，期望 %s", got, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestResilientProviderCircuitOpen(t *testing.T) {
+	inner := &flakyProvider{}
+	breaker := NewCircuitBreaker("flaky", 1, time.Minute)
+	breaker.Failure()
+
+	_, err := NewResilientProvider(inner, RetryPolicy{MaxRetries: 2}, breaker).Chat(context.Background(), testMessages)
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) {
+		t.Fatalf("期望 *CircuitOpenError，实际为 %v", err)
+	}
+	if inner.calls != 0 {
+		t.Errorf("熔断中不应调用上游，实际调用 %d 次", inner.calls)
+	}
+}
+
+func TestResilientProviderRetryAfterTooLong(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		timeout time.Duration
+	}{
+		{name: "超过退避上限", policy: RetryPolicy{MaxRetries: 2, MaxDelay: 10 * time.Millisecond}},
+		{name: "超过请求剩余时间", policy: RetryPolicy{MaxRetries: 2}, timeout: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			inner := &flakyProvider{errs: []error{&UpstreamError{StatusCode: 429, RetryAfter: time.Hour}}}
+			p := NewResilientProvider(inner, tt.policy, NewCircuitBreaker("flaky", 3, time.Minute))
+
+			start := time.Now()
+			_, err := p.Chat(ctx, testMessages)
+			var upErr *UpstreamError
+			if !errors.As(err, &upErr) || upErr.StatusCode != 429 {
+				t.Fatalf("期望直接返回 429 的 *UpstreamError，实际为 %v", err)
+			}
+			if inner.calls != 1 || time.Since(start) > 100*time.Millisecond {
+				t.Errorf("调用 %d 次，耗时 %s，期望不等待 Retry-After 直接返回", inner.calls, time.Since(start))
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// applySearchFilter 将过滤条件转换为 SQL 条件，在解码向量之前排除不相关的片段
+func applySearchFilter(db *gorm.DB, f models.SearchFilter) *gorm.DB {
+	if f.Namespace != "" {
+		db = db.Where("namespace = ?", f.Namespace)
+	}
+	if f.Source != "" {
+		db = db.Where("source = ?", f.Source)
+	}
+	if f.TitlePrefix != "" {
+		db = db.Where("title LIKE ? ESCAPE '\\'", escapeLike(f.TitlePrefix)+"%")
+	}
+	if f.CreatedAfter != nil {
+		db = db.Where("created_at >= ?", f.CreatedAfter.Local())
+	}
+	if f.CreatedBefore != nil {
+		db = db.Where("created_at < ?", f.CreatedBefore.Local())
+	}
+	if f.EmbeddingModel != "" {
+		db = db.Where("embedding_model = ?", f.EmbeddingModel)
+	}
+	for _, tag := range f.Tags {
+		db = db.Where("EXISTS (SELECT 1 FROM json_each(knowledges.tags) WHERE json_each.value = ?)", tag)
+	}
+	return db
+}
+
+// filteredKnowledgeIDs 返回满足过滤条件的片段 ID 集合，供内存索引在检索前限定范围
+func filteredKnowledgeIDs(f models.SearchFilter) (map[string]struct{}, error) {
+	var ids []string
+	if err := applySearchFilter(config.DB.Model(&models.Knowledge{}), f).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	allowed := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		allowed[id] = struct{}{}
+	}
+	return allowed, nil
+}
+
+// escapeLike 转义 LIKE 通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -8,8 +8,12 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrSessionNotFound 会话不存在或已删除
+var ErrSessionNotFound = errors.New("会话不存在")
+
 // SessionService 会话服务
 type SessionService struct{}
 
@@ -39,13 +43,35 @@ func (s *SessionService) GetSession(sessionID string) (*models.Session, error) {
 	var session models.Session
 	if err := config.DB.Where("id = ? AND deleted_at IS NULL", sessionID).First(&session).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("会话不存在")
+			return nil, ErrSessionNotFound
 		}
 		return nil, err
 	}
 	return &session, nil
 }
 
+// GetOrCreateSession 获取客户端指定的会话，不存在时以该 ID 创建（并发请求只会创建一次）；
+// sessionID 为空时创建新会话。已软删除的会话照常返回，与直接写入消息的行为一致
+func (s *SessionService) GetOrCreateSession(sessionID, name string) (*models.Session, error) {
+	if sessionID == "" {
+		return s.CreateSession(name)
+	}
+	now := time.Now()
+	session := &models.Session{ID: sessionID, Name: name, CreatedAt: now, UpdatedAt: now}
+	res := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(session)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected > 0 {
+		utils.Info("会话 %s 不存在，已按客户端指定的 ID 创建", sessionID)
+		return session, nil
+	}
+	if err := config.DB.Where("id = ?", sessionID).First(session).Error; err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
 // GetAllSessions 获取所有会话（包含消息数量）
 func (s *SessionService) GetAllSessions() ([]models.SessionWithMessageCount, error) {
 	var sessions []models.SessionWithMessageCount
@@ -75,6 +101,16 @@ func (s *SessionService) UpdateSession(sessionID string, name string) error {
 		}).Error
 }
 
+// UpdateSummary 保存会话摘要及其覆盖到的最后一条消息 ID
+func (s *SessionService) UpdateSummary(sessionID string, summary string, untilID uint) error {
+	return config.DB.Model(&models.Session{}).
+		Where("id = ? AND deleted_at IS NULL", sessionID).
+		Updates(map[string]interface{}{
+			"summary":          summary,
+			"summary_until_id": untilID,
+		}).Error
+}
+
 // DeleteSession 软删除会话
 func (s *SessionService) DeleteSession(sessionID string) error {
 	now := time.Now()
@@ -113,13 +149,119 @@ func (s *SessionService) GetHistory(sessionID string) []models.Message {
 
 // AddMessage 添加消息到会话
 func (s *SessionService) AddMessage(sessionID string, role, content string) error {
-	message := &models.ChatMessage{
+	return s.SaveMessage(&models.ChatMessage{
 		SessionID: sessionID,
 		Role:      role,
 		Content:   content,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	})
+}
+
+// AddAssistantMessage 保存模型回复及其 token 用量；incomplete 表示流式回复被中断
+func (s *SessionService) AddAssistantMessage(sessionID string, result ChatResult, incomplete bool) error {
+	return s.SaveMessage(assistantMessage(sessionID, result, incomplete))
+}
+
+// AddRAGQuery 保存 RAG 提问，rewritten 为改写后的独立问题（与原问题相同时不记录）
+func (s *SessionService) AddRAGQuery(sessionID, query, rewritten string) error {
+	if rewritten == query {
+		rewritten = ""
+	}
+	return s.SaveMessage(&models.ChatMessage{
+		SessionID:      sessionID,
+		Role:           "user",
+		Content:        query,
+		RewrittenQuery: rewritten,
+	})
+}
+
+// AddRAGAnswer 保存 RAG 回答、检索到的知识片段 ID 及使用的提示词模板（未构建知识提示词时为 nil），
+// fallback 为兜底回答触发的策略，正常回答为空
+func (s *SessionService) AddRAGAnswer(sessionID string, result ChatResult, incomplete bool, sourceIDs []string, prompt *models.PromptSelection, fallback string) error {
+	message := assistantMessage(sessionID, result, incomplete)
+	message.SourceIDs = sourceIDs
+	message.FallbackPolicy = fallback
+	if prompt != nil {
+		message.PromptTemplateID = prompt.TemplateID
+		message.PromptExperimentID = prompt.ExperimentID
 	}
+	return s.SaveMessage(message)
+}
+
+// assistantMessage 构造模型回复消息
+func assistantMessage(sessionID string, result ChatResult, incomplete bool) *models.ChatMessage {
+	return &models.ChatMessage{
+		SessionID:        sessionID,
+		Role:             "assistant",
+		Content:          result.Content,
+		Incomplete:       incomplete,
+		Model:            result.Model,
+		PromptTokens:     result.Usage.PromptTokens,
+		CompletionTokens: result.Usage.CompletionTokens,
+		TotalTokens:      result.Usage.TotalTokens,
+	}
+}
+
+// GetRecentMessages 获取会话最近的 n 条消息，按时间正序
+func (s *SessionService) GetRecentMessages(sessionID string, n int) ([]models.ChatMessage, error) {
+	var messages []models.ChatMessage
+	if n <= 0 {
+		return messages, nil
+	}
+	err := config.DB.Where("session_id = ? AND deleted_at IS NULL", sessionID).
+		Order("id DESC").Limit(n).Find(&messages).Error
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, err
+}
+
+// AttachSources 按消息记录的片段 ID 补全来源信息，编号与回答中的引用编号一致；已删除的片段跳过
+func (s *SessionService) AttachSources(messages []models.ChatMessage) error {
+	var ids []string
+	for _, m := range messages {
+		ids = append(ids, m.SourceIDs...)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var chunks []models.Knowledge
+	err := config.DB.Select("id", "document_id", "title", "heading_path", "source", "content").
+		Where("id IN ?", ids).Find(&chunks).Error
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]models.Knowledge, len(chunks))
+	for _, k := range chunks {
+		byID[k.ID] = k
+	}
+
+	for i := range messages {
+		for n, id := range messages[i].SourceIDs {
+			k, ok := byID[id]
+			if !ok {
+				continue
+			}
+			messages[i].Sources = append(messages[i].Sources, models.Citation{
+				ID:          n + 1,
+				KnowledgeID: k.ID,
+				DocumentID:  k.DocumentID,
+				Title:       k.Title,
+				HeadingPath: k.HeadingPath,
+				Source:      k.Source,
+				Snippet:     citationSnippet(k.Content),
+				Valid:       true,
+			})
+		}
+	}
+	return nil
+}
+
+// SaveMessage 保存消息并刷新会话的更新时间
+func (s *SessionService) SaveMessage(message *models.ChatMessage) error {
+	now := time.Now()
+	message.CreatedAt = now
+	message.UpdatedAt = now
 
 	if err := config.DB.Create(message).Error; err != nil {
 		return err
@@ -127,6 +269,6 @@ func (s *SessionService) AddMessage(sessionID string, role, content string) erro
 
 	// 更新会话的更新时间
 	return config.DB.Model(&models.Session{}).
-		Where("id = ?", sessionID).
-		Update("updated_at", time.Now()).Error
+		Where("id = ?", message.SessionID).
+		Update("updated_at", now).Error
 }
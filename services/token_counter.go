@@ -0,0 +1,48 @@
+package services
+
+import (
+	"AiDemo/models"
+	"unicode"
+)
+
+// messageOverheadTokens 每条消息的格式开销（角色标记、分隔符等）
+const messageOverheadTokens = 4
+
+// EstimateTokens 近似估算文本的 token 数：
+// 中日韩字符按每字 1 个 token 计，其余字符（拉丁字母、数字、标点、空白）按每 4 个字符 1 个 token 计
+func EstimateTokens(text string) int {
+	tokens := 0
+	latin := 0
+	for _, r := range text {
+		if isCJK(r) {
+			tokens++
+			continue
+		}
+		latin++
+	}
+	return tokens + (latin+3)/4
+}
+
+// EstimateMessageTokens 估算单条消息的 token 数（含格式开销）
+func EstimateMessageTokens(msg models.Message) int {
+	return EstimateTokens(msg.Content) + messageOverheadTokens
+}
+
+// EstimateMessagesTokens 估算一组消息的 token 数
+func EstimateMessagesTokens(messages []models.Message) int {
+	total := 0
+	for _, m := range messages {
+		total += EstimateMessageTokens(m)
+	}
+	return total
+}
+
+// isCJK 判断是否为中日韩文字
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r) ||
+		(r >= 0x3000 && r <= 0x303F) || // 中文标点
+		(r >= 0xFF00 && r <= 0xFFEF) // 全角字符
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"AiDemo/config"
+	"AiDemo/models"
+	"AiDemo/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UsageService token 用量与费用统计服务
+type UsageService struct{}
+
+// NewUsageService 创建新的用量统计服务实例
+func NewUsageService() *UsageService {
+	return &UsageService{}
+}
+
+// EstimateCost 按价格表估算费用，未配置单价的模型返回 0
+func EstimateCost(model string, usage models.Usage) float64 {
+	price, ok := config.PriceTable[model]
+	if !ok {
+		return 0
+	}
+	return float64(usage.PromptTokens)/1000*price.Prompt +
+		float64(usage.CompletionTokens)/1000*price.Completion
+}
+
+// Record 记录一次大模型调用的用量
+func (s *UsageService) Record(sessionID, endpoint, role string, result ChatResult) (*models.UsageRecord, error) {
+	now := time.Now()
+	record := &models.UsageRecord{
+		SessionID:        sessionID,
+		Endpoint:         endpoint,
+		Role:             role,
+		Model:            result.Model,
+		PromptTokens:     result.Usage.PromptTokens,
+		CompletionTokens: result.Usage.CompletionTokens,
+		TotalTokens:      result.Usage.TotalTokens,
+		Cost:             EstimateCost(result.Model, result.Usage),
+		Day:              now.Format("2006-01-02"),
+		CreatedAt:        now,
+	}
+
+	if err := config.DB.Create(record).Error; err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// RecordUsage 记录用量，失败仅记日志，不影响主流程
+func RecordUsage(sessionID, endpoint, role string, result ChatResult) float64 {
+	record, err := NewUsageService().Record(sessionID, endpoint, role, result)
+	if err != nil {
+		utils.Error("记录token用量失败: %v", err)
+		return EstimateCost(result.Model, result.Usage)
+	}
+	return record.Cost
+}
+
+// Report 生成用量报表：总计以及按会话、角色、模型、日期的汇总
+func (s *UsageService) Report(query models.UsageQuery) (*models.UsageReport, error) {
+	report := &models.UsageReport{Currency: config.PriceCurrency}
+
+	totals, err := s.summarize(query, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(totals) > 0 {
+		report.Total = totals[0]
+	}
+	report.Total.Key = "total"
+
+	if report.BySession, err = s.summarize(query, "session_id"); err != nil {
+		return nil, err
+	}
+	if report.ByRole, err = s.summarize(query, "role"); err != nil {
+		return nil, err
+	}
+	if report.ByModel, err = s.summarize(query, "model"); err != nil {
+		return nil, err
+	}
+	if report.ByDay, err = s.summarize(query, "day"); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// summarize 按指定列分组汇总，groupColumn 为空时返回总计；按日期汇总时按日期排序，其余按 token 数降序
+func (s *UsageService) summarize(query models.UsageQuery, groupColumn string) ([]models.UsageSummary, error) {
+	const aggregates = "COUNT(*) AS requests, " +
+		"COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, COALESCE(SUM(completion_tokens), 0) AS completion_tokens, " +
+		"COALESCE(SUM(total_tokens), 0) AS total_tokens, COALESCE(SUM(cost), 0) AS cost"
+
+	summaries := []models.UsageSummary{}
+	db := s.filter(query)
+	if groupColumn == "" {
+		db = db.Select(aggregates)
+	} else {
+		db = db.Select(groupColumn + " AS key, " + aggregates).Group(groupColumn)
+		if groupColumn == "day" {
+			db = db.Order("day ASC")
+		} else {
+			db = db.Order("total_tokens DESC")
+		}
+	}
+	err := db.Scan(&summaries).Error
+	return summaries, err
+}
+
+// filter 按查询条件构造基础查询
+func (s *UsageService) filter(query models.UsageQuery) *gorm.DB {
+	db := config.DB.Model(&models.UsageRecord{})
+	if query.SessionID != "" {
+		db = db.Where("session_id = ?", query.SessionID)
+	}
+	if query.From != "" {
+		db = db.Where("day >= ?", query.From)
+	}
+	if query.To != "" {
+		db = db.Where("day <= ?", query.To)
+	}
+	return db
+}
@@ -3,33 +3,39 @@ package services
 import (
 	"AiDemo/config"
 	"AiDemo/models"
+	"AiDemo/utils"
 	"encoding/json"
+	"sort"
+	"sync"
+	"time"
 )
 
 // ScoredDoc 检索结果
 type ScoredDoc struct {
-	Doc   models.Knowledge
-	Score float64
+	Doc            models.Knowledge
+	Score          float64 // 检索得分：单路检索时为该路得分，混合检索或多查询融合时为 RRF 融合得分，重排不改写
+	RetrievalScore float64 // 与 Score 相同，保留给调试输出
+	RerankScore    float64 // 重排得分（0-1），未重排时为 0
+	VectorScore    float64 // 与查询向量的余弦相似度；hybrid 中只由关键词召回的候选为补算值，无法计算时为 0
+	KeywordScore   float64 // 关键词检索的 BM25 得分，未命中为 0
 }
 
-// VectorStore 向量存储抽象，便于未来替换 Milvus/pgvector/Qdrant
+// VectorStore 向量存储抽象，便于未来替换 Milvus/pgvector/Qdrant。
+// filter.EmbeddingModel 为查询向量所属的模型版本，不同版本的向量处于不同空间，不参与比较
 type VectorStore interface {
-	Search(queryVec []float64, namespace string, topK int) ([]ScoredDoc, error)
+	Search(queryVec []float64, filter models.SearchFilter, topK int) ([]ScoredDoc, error)
 }
 
 // SQLiteVectorStore 基于 SQLite/GORM 的默认实现
 type SQLiteVectorStore struct{}
 
-// Search 按余弦相似度检索
-func (s *SQLiteVectorStore) Search(queryVec []float64, namespace string, topK int) ([]ScoredDoc, error) {
+// Search 按过滤条件在 SQL 中筛选后计算余弦相似度，跳过向量模型版本过期的片段
+func (s *SQLiteVectorStore) Search(queryVec []float64, filter models.SearchFilter, topK int) ([]ScoredDoc, error) {
 	var all []models.Knowledge
-	db := config.DB
-	if namespace != "" {
-		db = db.Where("namespace = ?", namespace)
-	}
-	if err := db.Find(&all).Error; err != nil {
+	if err := applySearchFilter(config.DB, filter).Find(&all).Error; err != nil {
 		return nil, err
 	}
+	warnStaleVectors(filter.Namespace, filter.EmbeddingModel)
 	if len(all) == 0 {
 		return []ScoredDoc{}, nil
 	}
@@ -45,7 +51,7 @@ func (s *SQLiteVectorStore) Search(queryVec []float64, namespace string, topK in
 		}
 		sim := cosineSimilarity(queryVec, vec)
 		if sim >= MinSimilarityThreshold {
-			scored = append(scored, ScoredDoc{Doc: d, Score: sim})
+			scored = append(scored, ScoredDoc{Doc: d, Score: sim, VectorScore: sim})
 		}
 	}
 
@@ -53,16 +59,8 @@ func (s *SQLiteVectorStore) Search(queryVec []float64, namespace string, topK in
 		return []ScoredDoc{}, nil
 	}
 
-	// 选择排序，按相似度降序取 TopK
-	for i := 0; i < len(scored)-1; i++ {
-		maxIdx := i
-		for j := i + 1; j < len(scored); j++ {
-			if scored[j].Score > scored[maxIdx].Score {
-				maxIdx = j
-			}
-		}
-		scored[i], scored[maxIdx] = scored[maxIdx], scored[i]
-	}
+	// 按相似度降序取 TopK
+	sort.Slice(scored, func(i, j int) bool { return scored[i].Score > scored[j].Score })
 
 	if topK > 0 && len(scored) > topK {
 		scored = scored[:topK]
@@ -71,4 +69,40 @@ func (s *SQLiteVectorStore) Search(queryVec []float64, namespace string, topK in
 	return scored, nil
 }
 
+// staleVectorCheckInterval 过期向量的统计间隔，避免每次检索都对知识表执行 COUNT
+const staleVectorCheckInterval = time.Minute
+
+var (
+	staleCheckMu   sync.Mutex
+	staleCheckedAt = map[string]time.Time{} // 命名空间 + 向量模型 -> 上次统计时间
+)
+
+// warnStaleVectors 存在过期向量时记录警告，提示执行重建；同一命名空间与模型每个统计间隔内最多统计一次
+func warnStaleVectors(namespace, embeddingModel string) {
+	key := namespace + "\x00" + embeddingModel
+	staleCheckMu.Lock()
+	if time.Since(staleCheckedAt[key]) < staleVectorCheckInterval {
+		staleCheckMu.Unlock()
+		return
+	}
+	staleCheckedAt[key] = time.Now()
+	staleCheckMu.Unlock()
+
+	stale, err := CountStaleKnowledge(namespace, embeddingModel)
+	if err != nil {
+		utils.Warning("统计过期向量失败: %v", err)
+		return
+	}
+	if stale > 0 {
+		utils.Warning("命名空间[%s]有 %d 个知识片段的向量模型不是 %s，检索时已跳过，请执行向量重建", namespace, stale, embeddingModel)
+	}
+}
+
+// resetStaleVectorCheck 重建任务结束后清除统计时间，下次检索时重新统计
+func resetStaleVectorCheck() {
+	staleCheckMu.Lock()
+	defer staleCheckMu.Unlock()
+	clear(staleCheckedAt)
+}
+
 var defaultVectorStore VectorStore = &SQLiteVectorStore{}
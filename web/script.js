@@ -152,7 +152,13 @@ async function loadSessionMessages(sessionId) {
             if (message.role === 'user') {
                 addMessageToChat('你: ' + message.content, 'user');
             } else if (message.role === 'assistant') {
-                addMessageToChat('AI: ' + message.content, 'ai');
+                const suffix = message.incomplete ? '（回复已中断）' : '';
+                addMessageToChat('AI: ' + message.content + suffix, 'ai');
+                // RAG 回答附带检索到的知识片段
+                if (Array.isArray(message.sources) && message.sources.length > 0) {
+                    const sources = message.sources.map(s => `[${s.id}] ${s.title}${s.source ? "（" + s.source + "）" : ""}`);
+                    addMessageToChat("检索来源: " + sources.join(" | "), "system-message");
+                }
             }
         });
 
@@ -203,7 +209,8 @@ async function sendMessage() {
         let payload = {
             message,
             role,
-            session_id: currentSessionId
+            session_id: currentSessionId,
+            stream: true
         };
 
         // 如果选择 RAG 模式，则走 /rag/chat
@@ -212,9 +219,11 @@ async function sendMessage() {
             payload = {
                 query: message,
                 mode: "rag",
+                session_id: currentSessionId,
                 namespace: namespace || undefined,
                 top_k: topK,
-                debug: debug
+                debug: debug,
+                stream: true
             };
         } else if (mode === "normal") {
             // 明确 normal，还是走 /chat，但便于后续扩展
@@ -229,15 +238,29 @@ async function sendMessage() {
 
         if (!response.ok) throw new Error("HTTP " + response.status);
 
-        const data = await response.json();
+        // 流式接收：delta 逐段追加，done 携带完整响应
+        let answer = "";
+        let data = {};
+        aiEl.textContent = "AI: ";
+        await readSSE(response, (event, payload) => {
+            if (event === "delta") {
+                if (answer === "") aiEl.classList.remove('typing');
+                answer += payload.content;
+                aiEl.textContent = "AI: " + answer;
+                scrollToBottom();
+            } else if (event === "done") {
+                data = payload;
+            } else if (event === "error") {
+                throw new Error(payload.error || "流式响应出错");
+            }
+        });
 
         // 移除打字效果
         aiEl.classList.remove('typing');
-
-        // 更新AI回复
-        aiEl.textContent = "AI: ";
-        const answer = data.reply || data.answer || "出错了，请稍后再试";
-        typeText(aiEl, answer);
+        if (!answer) {
+            aiEl.textContent = "AI: " + (data.reply || data.answer || "出错了，请稍后再试");
+        }
+        waitingForAIResponse = false;
 
         // 如果是 RAG 模式且开启 debug，附带命中文档信息
         if (mode === "rag" && debug && data.hit_docs && Array.isArray(data.hit_docs)) {
@@ -251,9 +274,22 @@ async function sendMessage() {
             addMessageToChat(info, "system-message");
         }
 
+        // 显示引用来源，无效引用（未提供的片段编号）单独标出
+        if (mode === "rag" && Array.isArray(data.citations) && data.citations.length > 0) {
+            const sources = data.citations.map(c => c.valid
+                ? `[${c.id}] ${c.title}${c.source ? "（" + c.source + "）" : ""}`
+                : `[${c.id}] 无效引用`);
+            addMessageToChat("引用来源: " + sources.join(" | "), "system-message");
+        }
+
         // 显示兜底信息
         if (mode === "rag" && data.fallback) {
-            addMessageToChat("提示：知识库无命中，已退化为普通对话。", "system-message");
+            const policyText = {
+                general_answer: "已退化为普通对话",
+                refuse: "已按策略拒答",
+                ask_clarifying_question: "已请求补充问题细节"
+            }[data.fallback_policy] || "已退化为普通对话";
+            addMessageToChat("提示：知识库命中不足，" + policyText + "。", "system-message");
         }
 
         // 刷新会话列表
@@ -267,6 +303,35 @@ async function sendMessage() {
     }
 }
 
+// 读取 SSE 响应流，按事件回调（event 名称, 解析后的 JSON 数据）
+async function readSSE(response, onEvent) {
+    const reader = response.body.getReader();
+    const decoder = new TextDecoder("utf-8");
+    let buffer = "";
+
+    while (true) {
+        const { value, done } = await reader.read();
+        if (done) break;
+        buffer += decoder.decode(value, { stream: true });
+
+        // 事件之间以空行分隔
+        let idx;
+        while ((idx = buffer.indexOf("\n\n")) >= 0) {
+            const raw = buffer.slice(0, idx);
+            buffer = buffer.slice(idx + 2);
+
+            let event = "message";
+            const dataLines = [];
+            raw.split("\n").forEach(line => {
+                if (line.startsWith("event:")) event = line.slice(6).trim();
+                else if (line.startsWith("data:")) dataLines.push(line.slice(5));
+            });
+            if (dataLines.length === 0) continue;
+            onEvent(event, JSON.parse(dataLines.join("\n")));
+        }
+    }
+}
+
 // 知识入库
 async function ingestKnowledge() {
     const titleEl = document.getElementById("ingest-title");
@@ -298,9 +363,12 @@ async function ingestKnowledge() {
 
         if (!resp.ok) throw new Error("HTTP " + resp.status);
 
-        const data = await resp.json();
-        const chunks = data.chunks || (data.knowledges ? data.knowledges.length : 0);
-        alert(`入库成功，片段数：${chunks}`);
+        // 入库为异步任务，轮询任务进度直到结束
+        const job = await waitForIngestJob(await resp.json());
+        if (job.status !== "completed") throw new Error(job.error || job.status);
+        alert(job.duplicate
+            ? `已存在相同内容的文档（${job.document_id}），未重复入库`
+            : `入库成功，片段数：${job.total_chunks}`);
 
         // 清空表单
         titleEl.value = "";
@@ -313,6 +381,17 @@ async function ingestKnowledge() {
     }
 }
 
+// 轮询入库任务，直到完成或失败
+async function waitForIngestJob(job) {
+    while (job.status === "queued" || job.status === "running") {
+        await new Promise(resolve => setTimeout(resolve, 1000));
+        const resp = await fetch(`/rag/jobs/${job.id}`);
+        if (!resp.ok) throw new Error("HTTP " + resp.status);
+        job = await resp.json();
+    }
+    return job;
+}
+
 // 添加消息到聊天框
 function addMessageToChat(content, type) {
     const chatBox = document.getElementById("chat-box");
@@ -329,22 +408,6 @@ function clearChatBox() {
     chatBox.innerHTML = '';
 }
 
-// 打字效果
-function typeText(element, text) {
-    let i = 0;
-    const prefix = "AI: ";
-    (function type() {
-        if (i < text.length) {
-            element.textContent = prefix + text.substring(0, i + 1);
-            i++;
-            scrollToBottom();
-            setTimeout(type, 30);
-        } else {
-            waitingForAIResponse = false;
-        }
-    })();
-}
-
 // 滚动到底部
 function scrollToBottom() {
     const chatBox = document.getElementById("chat-box");